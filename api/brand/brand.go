@@ -0,0 +1,56 @@
+// Package brand passes the brand clients call the gateway for on to the services behind it, which show each brand
+// only the races enabled for it.
+package brand
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const (
+	// Header is the header clients name the brand they're calling for with.
+	Header = "X-Brand"
+	// metadataKey is the metadata the brand is passed on to services as.
+	metadataKey = "x-brand"
+	// overrideMetadataKey is the metadata admins read races across every brand with, which clients of the gateway
+	// must never be able to set.
+	overrideMetadataKey = "x-all-brands"
+)
+
+// HeaderMatcher forwards the brand header on as metadata, alongside the headers the gateway forwards by default, bar
+// any attempting to set the admin override.
+func HeaderMatcher(key string) (string, bool) {
+	if http.CanonicalHeaderKey(key) == Header {
+		return metadataKey, true
+	}
+
+	forwarded, ok := runtime.DefaultHeaderMatcher(key)
+	if !ok || isOverride(forwarded) {
+		return "", false
+	}
+
+	return forwarded, true
+}
+
+// Handler strips any header setting the admin override from requests handed on to next, including those forwarded
+// as they are, such as by gRPC-Web calls.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key := range r.Header {
+			if isOverride(key) {
+				r.Header.Del(key)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isOverride reports whether a header, or the metadata it's forwarded as, sets the admin override.
+func isOverride(key string) bool {
+	key = strings.ToLower(key)
+
+	return key == overrideMetadataKey || strings.HasSuffix(key, "-"+overrideMetadataKey)
+}
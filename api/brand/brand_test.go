@@ -0,0 +1,46 @@
+package brand
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderMatcher(t *testing.T) {
+	tests := map[string]struct {
+		want string
+		ok   bool
+	}{
+		"X-Brand":                    {metadataKey, true},
+		"x-brand":                    {metadataKey, true},
+		"Authorization":              {"grpcgateway-Authorization", true},
+		"Grpc-Metadata-X-Trace":      {"X-Trace", true},
+		"X-All-Brands":               {"", false},
+		"Grpc-Metadata-X-All-Brands": {"", false},
+		"X-Trace":                    {"", false},
+	}
+
+	for key, test := range tests {
+		if got, ok := HeaderMatcher(key); got != test.want || ok != test.ok {
+			t.Errorf("%s: got %q, %t, want %q, %t", key, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestHandlerStripsOverride(t *testing.T) {
+	var got http.Header
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/racing.Racing/ListRaces", nil)
+	r.Header.Set("X-All-Brands", "true")
+	r.Header.Set("Grpc-Metadata-X-All-Brands", "true")
+	r.Header.Set(Header, "neds")
+
+	Handler(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(got) != 1 || got.Get(Header) != "neds" {
+		t.Errorf("handed on headers %v, want only %s", got, Header)
+	}
+}
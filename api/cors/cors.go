@@ -0,0 +1,120 @@
+// Package cors lets browser apps served from other origins call the gateway, answering their preflight requests.
+//
+// See: https://fetch.spec.whatwg.org/#http-cors-protocol
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is which cross origin requests are allowed.
+type Config struct {
+	// AllowedOrigins lists the origins allowed, such as https://www.example.com. An origin may hold a single * as a
+	// wildcard, such as https://*.example.com, and * alone allows every origin.
+	AllowedOrigins []string
+	// AllowedMethods lists the methods preflight requests may ask to use.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers preflight requests may ask to set.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers browsers should let apps read.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache the answer to a preflight request.
+	MaxAge time.Duration
+}
+
+// Handler adds the CORS headers allowing cross origin requests to responses from next, answering preflight requests
+// itself. Requests from origins which aren't allowed are handed on untouched, for browsers to refuse.
+func Handler(config Config, next http.Handler) http.Handler {
+	allowedMethods := make(map[string]bool, len(config.AllowedMethods))
+	for _, method := range config.AllowedMethods {
+		allowedMethods[strings.ToUpper(method)] = true
+	}
+
+	allowedHeaders := make(map[string]bool, len(config.AllowedHeaders))
+	for _, header := range config.AllowedHeaders {
+		allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Responses differ by origin, so mustn't be cached as though they didn't.
+		w.Header().Add("Vary", "Origin")
+
+		if !allowsOrigin(config.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		preflightMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && preflightMethod != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if allowsPreflight(allowedMethods, allowedHeaders, preflightMethod, r.Header.Get("Access-Control-Request-Headers")) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+				if len(config.AllowedHeaders) > 0 {
+					w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+				}
+				if config.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+				}
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if len(config.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowsOrigin reports whether an origin matches any of those allowed.
+func allowsOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+
+		if i := strings.Index(pattern, "*"); i >= 0 {
+			prefix, suffix := pattern[:i], pattern[i+1:]
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// allowsPreflight reports whether the method and headers a preflight request asks to use are all allowed.
+func allowsPreflight(allowedMethods, allowedHeaders map[string]bool, method, headers string) bool {
+	if !allowedMethods[strings.ToUpper(method)] {
+		return false
+	}
+
+	for _, header := range strings.Split(headers, ",") {
+		if header = strings.TrimSpace(header); header != "" && !allowedHeaders[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,126 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	config := Config{
+		AllowedOrigins: []string{"https://www.example.com", "https://*.neds.com.au"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-Brand", "X-Grpc-Web"},
+		ExposedHeaders: []string{"ETag", "Grpc-Status"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	tests := map[string]struct {
+		// origins replaces the origins allowed, when set.
+		origins         []string
+		method          string
+		origin          string
+		preflightMethod string
+		preflightHeader string
+		wantNext        bool
+		wantAllowed     bool
+	}{
+		"same origin":             {method: http.MethodGet, wantNext: true},
+		"allowed origin":          {method: http.MethodGet, origin: "https://www.example.com", wantNext: true, wantAllowed: true},
+		"allowed in another case": {method: http.MethodGet, origin: "HTTPS://WWW.Example.com", wantNext: true, wantAllowed: true},
+		"matching a wildcard":     {method: http.MethodPost, origin: "https://app.neds.com.au", wantNext: true, wantAllowed: true},
+		"empty wildcard":          {method: http.MethodGet, origin: "https://.neds.com.au", wantNext: true},
+		"bare wildcard domain":    {method: http.MethodGet, origin: "https://neds.com.au", wantNext: true},
+		"another scheme":          {method: http.MethodGet, origin: "http://app.neds.com.au", wantNext: true},
+		"another suffix":          {method: http.MethodGet, origin: "https://app.neds.com.au.evil.com", wantNext: true},
+		"other origin":            {method: http.MethodGet, origin: "https://evil.com", wantNext: true},
+		"every origin":            {origins: []string{"*"}, method: http.MethodGet, origin: "https://evil.com", wantNext: true, wantAllowed: true},
+		"preflight": {
+			method: http.MethodOptions, origin: "https://app.neds.com.au",
+			preflightMethod: "POST", preflightHeader: "content-type, X-Brand",
+			wantAllowed: true,
+		},
+		"preflight without headers": {
+			method: http.MethodOptions, origin: "https://www.example.com", preflightMethod: "get",
+			wantAllowed: true,
+		},
+		"preflight of another method": {
+			method: http.MethodOptions, origin: "https://www.example.com", preflightMethod: "DELETE",
+		},
+		"preflight of another header": {
+			method: http.MethodOptions, origin: "https://www.example.com",
+			preflightMethod: "POST", preflightHeader: "Content-Type, Authorization",
+		},
+		"preflight from another origin": {
+			method: http.MethodOptions, origin: "https://evil.com", preflightMethod: "GET",
+			wantNext: true,
+		},
+		"options without preflight": {method: http.MethodOptions, origin: "https://www.example.com", wantNext: true, wantAllowed: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := config
+			if test.origins != nil {
+				config.AllowedOrigins = test.origins
+			}
+
+			next := false
+			h := Handler(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next = true
+			}))
+
+			r := httptest.NewRequest(test.method, "/v1/races", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.preflightMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", test.preflightMethod)
+			}
+			if test.preflightHeader != "" {
+				r.Header.Set("Access-Control-Request-Headers", test.preflightHeader)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if next != test.wantNext {
+				t.Errorf("handed on is %t, want %t", next, test.wantNext)
+			}
+
+			allowed := w.Header().Get("Access-Control-Allow-Origin")
+			if got := allowed != ""; got != test.wantAllowed {
+				t.Fatalf("allowed origin %q, want allowed %t", allowed, test.wantAllowed)
+			}
+			if test.wantAllowed && allowed != test.origin {
+				t.Errorf("allowed origin %q, want %q", allowed, test.origin)
+			}
+			if test.origin != "" && w.Header().Get("Vary") != "Origin" {
+				t.Errorf("responses vary by %v, want Origin first", w.Header()["Vary"])
+			}
+
+			preflight := test.preflightMethod != "" && !test.wantNext
+			if preflight && w.Code != http.StatusNoContent {
+				t.Errorf("preflight answered with %d, want 204", w.Code)
+			}
+
+			switch {
+			case preflight && test.wantAllowed:
+				if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+					t.Errorf("allowed methods %q", got)
+				}
+				if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-Brand, X-Grpc-Web" {
+					t.Errorf("allowed headers %q", got)
+				}
+				if got := w.Header().Get("Access-Control-Max-Age"); got != "600" {
+					t.Errorf("preflight cached for %q, want 600", got)
+				}
+			case test.wantAllowed:
+				if got := w.Header().Get("Access-Control-Expose-Headers"); got != "ETag, Grpc-Status" {
+					t.Errorf("exposed headers %q", got)
+				}
+			}
+		})
+	}
+}
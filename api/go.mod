@@ -3,6 +3,7 @@ module git.neds.sh/matty/entain/api
 go 1.16
 
 require (
+	git.neds.sh/matty/entain/tokenbucket v0.0.0
 	github.com/golang/protobuf v1.4.3
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.3.0
 	google.golang.org/genproto v0.0.0-20210226172003-ab064af71705
@@ -10,3 +11,5 @@ require (
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.1.0
 	google.golang.org/protobuf v1.25.1-0.20201208041424-160c7477e0e8
 )
+
+replace git.neds.sh/matty/entain/tokenbucket => ../tokenbucket
@@ -0,0 +1,358 @@
+// Package grpcweb serves the gRPC-Web protocol, so that browser apps can call services through the gateway with
+// generated gRPC-Web clients, rather than their JSON routes.
+//
+// Calls are proxied onto the upstream serving them as they are, without being decoded. Only unary and server
+// streaming calls are supported, as browsers can't stream requests, and only methods which also have a JSON route,
+// so that admin methods left off the gateway stay off it.
+//
+// See: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	contentType     = "application/grpc-web"
+	textContentType = "application/grpc-web-text"
+
+	// maxRequestSize is the largest request body accepted.
+	maxRequestSize = 4 << 20
+
+	// Flags of the frames bodies are made up of.
+	dataFrame    = 0x00
+	trailerFrame = 0x80
+)
+
+// IsGRPCWebRequest reports whether a request is a gRPC-Web call.
+func IsGRPCWebRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), contentType)
+}
+
+// Handler serves gRPC-Web calls.
+type Handler struct {
+	// methods maps the full method names callable, such as /racing.Racing/ListRaces, onto the connection to the
+	// upstream serving them.
+	methods map[string]*grpc.ClientConn
+}
+
+// NewHandler creates a handler of calls to the methods of the given services, which are keyed on their full names,
+// such as racing.Racing.
+func NewHandler(services map[string]*grpc.ClientConn) (*Handler, error) {
+	h := &Handler{methods: make(map[string]*grpc.ClientConn)}
+
+	for service, conn := range services {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			return nil, fmt.Errorf("finding service %s: %w", service, err)
+		}
+
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", service)
+		}
+
+		methods := sd.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			if md.IsStreamingClient() || !hasRoute(md) {
+				continue
+			}
+
+			h.methods["/"+service+"/"+string(md.Name())] = conn
+		}
+	}
+
+	return h, nil
+}
+
+// hasRoute reports whether a method has a JSON route on the gateway.
+func hasRoute(md protoreflect.MethodDescriptor) bool {
+	rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	return ok && rule != nil && rule.GetPattern() != nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, ok := h.methods[r.URL.Path]
+	if !ok {
+		http.Error(w, "unknown gRPC-Web method", http.StatusNotFound)
+		return
+	}
+
+	text := strings.HasPrefix(r.Header.Get("Content-Type"), textContentType)
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	req, err := readRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := outgoingContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	rw := &responseWriter{w: w, text: text}
+	if text {
+		w.Header().Set("Content-Type", textContentType+"+proto")
+	} else {
+		w.Header().Set("Content-Type", contentType+"+proto")
+	}
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, r.URL.Path, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		writeHeader(w, nil)
+		rw.writeTrailer(status.Convert(err), nil)
+		return
+	}
+
+	err = send(stream, req)
+	if err == nil {
+		err = receive(stream, rw)
+	}
+
+	// Calls failing before any response has been written still have their header, which the trailer follows.
+	if !rw.started {
+		header, _ := stream.Header()
+		writeHeader(w, header)
+	}
+	rw.writeTrailer(status.Convert(err), stream.Trailer())
+}
+
+// send sends the request message, closing the stream for sending.
+func send(stream grpc.ClientStream, req []byte) error {
+	if err := stream.SendMsg(req); err != nil && err != io.EOF {
+		return err
+	}
+
+	return stream.CloseSend()
+}
+
+// receive writes each response message received as a frame, preceded by the call's header.
+func receive(stream grpc.ClientStream, rw *responseWriter) error {
+	for {
+		var msg []byte
+		err := stream.RecvMsg(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !rw.started {
+			header, _ := stream.Header()
+			writeHeader(rw.w, header)
+			rw.started = true
+		}
+
+		if err := rw.writeFrame(dataFrame, msg); err != nil {
+			return status.Error(codes.Canceled, "writing response: "+err.Error())
+		}
+	}
+}
+
+// readRequest reads the single request message of a call from its framed body.
+func readRequest(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading request frame: %w", err)
+	}
+
+	if prefix[0] != dataFrame {
+		return nil, fmt.Errorf("unsupported request frame flags %#x", prefix[0])
+	}
+
+	msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, fmt.Errorf("reading request message: %w", err)
+	}
+
+	// Anything beyond the single message is ignored, bar checking it isn't oversized.
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+
+	return msg, nil
+}
+
+// outgoingContext returns the context of a call, forwarding on the request's headers as metadata and honouring any
+// grpc-timeout it gives.
+func outgoingContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	md := metadata.MD{}
+	for key, values := range r.Header {
+		// Headers describing the HTTP request itself, rather than the call, are left behind.
+		switch key = strings.ToLower(key); key {
+		case "connection", "content-length", "content-type", "grpc-timeout", "host", "keep-alive", "te", "trailer",
+			"transfer-encoding", "upgrade", "user-agent", "accept-encoding":
+			continue
+		}
+
+		md.Append(key, values...)
+	}
+
+	ctx := metadata.NewOutgoingContext(r.Context(), md)
+
+	if timeout := r.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, d)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return ctx, cancel, nil
+}
+
+// parseTimeout parses a grpc-timeout header, such as 100m for 100 milliseconds.
+func parseTimeout(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// writeHeader writes the header metadata of a call as the headers of its response.
+func writeHeader(w http.ResponseWriter, header metadata.MD) {
+	for key, values := range header {
+		if key == "content-type" {
+			continue
+		}
+
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// responseWriter writes the frames of a response, base64 encoding them for the text protocol.
+type responseWriter struct {
+	w       http.ResponseWriter
+	text    bool
+	started bool
+}
+
+func (rw *responseWriter) writeFrame(flags byte, data []byte) error {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	copy(frame[5:], data)
+
+	if rw.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+
+	if _, err := rw.w.Write(frame); err != nil {
+		return err
+	}
+
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// writeTrailer writes the status and trailer metadata of a call as the trailer frame ending its response.
+func (rw *responseWriter) writeTrailer(st *status.Status, trailer metadata.MD) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&buf, "grpc-message: %s\r\n", encodeMessage(st.Message()))
+	}
+	if len(st.Proto().GetDetails()) > 0 {
+		if details, err := proto.Marshal(st.Proto()); err == nil {
+			fmt.Fprintf(&buf, "grpc-status-details-bin: %s\r\n", base64.RawStdEncoding.EncodeToString(details))
+		}
+	}
+
+	for key, values := range trailer {
+		for _, v := range values {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, v)
+		}
+	}
+
+	_ = rw.writeFrame(trailerFrame, buf.Bytes())
+}
+
+// encodeMessage percent encodes a status message, as gRPC asks.
+func encodeMessage(msg string) string {
+	return strings.ReplaceAll(url.PathEscape(msg), "%20", " ")
+}
+
+// rawCodec passes messages through as they're encoded, so calls can be proxied without being decoded.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T as raw bytes", v)
+	}
+
+	return msg, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal raw bytes into %T", v)
+	}
+
+	*msg = append((*msg)[:0], data...)
+
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,305 @@
+package grpcweb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/api/proto/racing"
+)
+
+// stubRacing serves race 1, and exports it in two parts.
+type stubRacing struct {
+	racing.UnimplementedRacingServer
+}
+
+func (stubRacing) GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.Race, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-brand", strings.Join(md.Get("x-brand"), ",")))
+
+	if in.Id != 1 {
+		return nil, status.Error(codes.NotFound, "race not found")
+	}
+
+	return &racing.Race{Id: 1, Name: "Melbourne Cup"}, nil
+}
+
+func (stubRacing) ExportRaces(_ *racing.ExportRacesRequest, stream racing.Racing_ExportRacesServer) error {
+	for _, part := range []string{"id,name\n", "1,Melbourne Cup\n"} {
+		if err := stream.Send(&httpbody.HttpBody{ContentType: "text/csv", Data: []byte(part)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newTestHandler creates a handler calling the racing service through an in-memory connection.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	racing.RegisterRacingServer(srv, stubRacing{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	)
+	if err != nil {
+		t.Fatalf("dialing racing: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	h, err := NewHandler(map[string]*grpc.ClientConn{"racing.Racing": conn})
+	if err != nil {
+		t.Fatalf("creating handler: %s", err)
+	}
+
+	return h
+}
+
+// frame frames a message as a gRPC-Web body does.
+func frame(flags byte, data []byte) []byte {
+	w := httptest.NewRecorder()
+	_ = (&responseWriter{w: w}).writeFrame(flags, data)
+
+	return w.Body.Bytes()
+}
+
+// parseFrames splits a response body into the messages of its data frames and the trailer of its trailer frame,
+// decoding the text protocol's base64 a quantum at a time, as each frame is encoded on its own.
+func parseFrames(t *testing.T, body []byte, text bool) ([][]byte, string) {
+	t.Helper()
+
+	if text {
+		var decoded []byte
+		for i := 0; i+4 <= len(body); i += 4 {
+			buf, err := base64.StdEncoding.DecodeString(string(body[i : i+4]))
+			if err != nil {
+				t.Fatalf("decoding body: %s", err)
+			}
+			decoded = append(decoded, buf...)
+		}
+		body = decoded
+	}
+
+	var msgs [][]byte
+	for len(body) > 0 {
+		if body[0] == trailerFrame {
+			return msgs, string(body[5:])
+		}
+
+		msg, err := readRequest(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("reading frame: %s", err)
+		}
+
+		msgs = append(msgs, msg)
+		body = body[5+len(msg):]
+	}
+
+	t.Fatal("response has no trailer")
+	return nil, ""
+}
+
+func TestHandler(t *testing.T) {
+	h := newTestHandler(t)
+
+	race1, err := proto.Marshal(&racing.GetRaceRequest{Id: 1})
+	if err != nil {
+		t.Fatalf("marshalling request: %s", err)
+	}
+	race2, err := proto.Marshal(&racing.GetRaceRequest{Id: 2})
+	if err != nil {
+		t.Fatalf("marshalling request: %s", err)
+	}
+
+	tests := map[string]struct {
+		method      string
+		msg         []byte
+		text        bool
+		timeout     string
+		wantStatus  int
+		wantMsgs    int
+		wantTrailer string
+	}{
+		"unary":          {"/racing.Racing/GetRace", race1, false, "", http.StatusOK, 1, "grpc-status: 0\r\n"},
+		"text":           {"/racing.Racing/GetRace", race1, true, "", http.StatusOK, 1, "grpc-status: 0\r\n"},
+		"failing":        {"/racing.Racing/GetRace", race2, false, "", http.StatusOK, 0, "grpc-status: 5\r\ngrpc-message: race not found\r\n"},
+		"streaming":      {"/racing.Racing/ExportRaces", nil, false, "", http.StatusOK, 2, "grpc-status: 0\r\n"},
+		"with a timeout": {"/racing.Racing/GetRace", race1, false, "1S", http.StatusOK, 1, "grpc-status: 0\r\n"},
+		"bad timeout":    {"/racing.Racing/GetRace", race1, false, "soon", http.StatusBadRequest, 0, ""},
+		"no route":       {"/racing.Racing/TransitionRace", nil, false, "", http.StatusNotFound, 0, ""},
+		"unknown method": {"/racing.Racing/Nope", nil, false, "", http.StatusNotFound, 0, ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := frame(dataFrame, test.msg)
+			contentType := contentType + "+proto"
+			if test.text {
+				body = []byte(base64.StdEncoding.EncodeToString(body))
+				contentType = textContentType
+			}
+
+			r := httptest.NewRequest(http.MethodPost, test.method, bytes.NewReader(body))
+			r.Header.Set("Content-Type", contentType)
+			r.Header.Set("X-Brand", "neds")
+			if test.timeout != "" {
+				r.Header.Set("Grpc-Timeout", test.timeout)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+
+			if test.text != strings.HasPrefix(w.Header().Get("Content-Type"), textContentType) {
+				t.Errorf("got content type %s", w.Header().Get("Content-Type"))
+			}
+
+			msgs, trailer := parseFrames(t, w.Body.Bytes(), test.text)
+			if len(msgs) != test.wantMsgs {
+				t.Errorf("got %d messages, want %d", len(msgs), test.wantMsgs)
+			}
+			if trailer != test.wantTrailer {
+				t.Errorf("got trailer %q, want %q", trailer, test.wantTrailer)
+			}
+
+			if test.method == "/racing.Racing/GetRace" {
+				// The brand is forwarded on as metadata, and the header racing answers with is sent back.
+				if got := w.Header().Get("X-Brand"); got != "neds" {
+					t.Errorf("racing was called for brand %q, want neds", got)
+				}
+
+				race := &racing.Race{}
+				if len(msgs) == 1 && (proto.Unmarshal(msgs[0], race) != nil || race.Name != "Melbourne Cup") {
+					t.Errorf("got race %v", race)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	msg, err := readRequest(bytes.NewReader(append(frame(dataFrame, []byte("race")), "ignored"...)))
+	if err != nil || string(msg) != "race" {
+		t.Errorf("read %q, %v, want race", msg, err)
+	}
+
+	if msg, err := readRequest(bytes.NewReader(frame(dataFrame, nil))); err != nil || len(msg) != 0 {
+		t.Errorf("read %q, %v, want an empty message", msg, err)
+	}
+
+	for name, body := range map[string][]byte{
+		"empty":           nil,
+		"short prefix":    {0, 0, 0},
+		"short message":   frame(dataFrame, []byte("race"))[:7],
+		"trailer":         frame(trailerFrame, []byte("grpc-status: 0\r\n")),
+		"compressed data": frame(0x01, []byte("race")),
+	} {
+		if _, err := readRequest(bytes.NewReader(body)); err == nil {
+			t.Errorf("%s: read a request, want an error", name)
+		}
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	want := []byte{0x00, 0, 0, 0, 4, 'r', 'a', 'c', 'e'}
+
+	w := httptest.NewRecorder()
+	if err := (&responseWriter{w: w}).writeFrame(dataFrame, []byte("race")); err != nil || !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("wrote %v, %v, want %v", w.Body.Bytes(), err, want)
+	}
+
+	w = httptest.NewRecorder()
+	if err := (&responseWriter{w: w, text: true}).writeFrame(dataFrame, []byte("race")); err != nil || w.Body.String() != base64.StdEncoding.EncodeToString(want) {
+		t.Errorf("wrote %s, %v, want %s", w.Body, err, base64.StdEncoding.EncodeToString(want))
+	}
+	if !w.Flushed {
+		t.Error("frame wasn't flushed")
+	}
+}
+
+func TestWriteTrailer(t *testing.T) {
+	st, err := status.New(codes.Unavailable, "racing is 100% unavailable").WithDetails(&errdetails.RetryInfo{})
+	if err != nil {
+		t.Fatalf("adding details: %s", err)
+	}
+
+	for _, text := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		(&responseWriter{w: w, text: text}).writeTrailer(st, metadata.Pairs("x-revision", "3"))
+
+		msgs, trailer := parseFrames(t, w.Body.Bytes(), text)
+		if len(msgs) != 0 {
+			t.Errorf("got messages %q before the trailer", msgs)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(trailer, "\r\n"), "\r\n")
+		if len(lines) != 4 || lines[0] != "grpc-status: 14" || lines[1] != "grpc-message: racing is 100%25 unavailable" || lines[3] != "x-revision: 3" {
+			t.Fatalf("got trailer %q", trailer)
+		}
+
+		details, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(lines[2], "grpc-status-details-bin: "))
+		if err != nil {
+			t.Fatalf("decoding details: %s", err)
+		}
+
+		got := &statuspb.Status{}
+		if err := proto.Unmarshal(details, got); err != nil {
+			t.Fatalf("unmarshalling details: %s", err)
+		}
+		if !proto.Equal(got, st.Proto()) {
+			t.Errorf("got status %v, want %v", got, st.Proto())
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1H":   time.Hour,
+		"2M":   2 * time.Minute,
+		"3S":   3 * time.Second,
+		"100m": 100 * time.Millisecond,
+		"250u": 250 * time.Microsecond,
+		"5n":   5 * time.Nanosecond,
+		"0S":   0,
+	}
+
+	for s, want := range tests {
+		if got, err := parseTimeout(s); err != nil || got != want {
+			t.Errorf("parseTimeout(%q) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "S", "10", "10s", "10x", "-1S", "1.5S", "ten S"} {
+		if _, err := parseTimeout(s); err == nil {
+			t.Errorf("parseTimeout(%q) succeeded, want an error", s)
+		}
+	}
+}
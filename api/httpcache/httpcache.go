@@ -0,0 +1,178 @@
+// Package httpcache lets clients cache the races they read through the gateway, tagging responses with strong ETags
+// they can make conditional GETs with.
+//
+// Racing sends the version races are at alongside the races it reads, so the ETag of a response is derived from
+// the version and the request, and known before the response is marshalled. Requests whose If-None-Match holds the
+// ETag are answered with a 304, sparing the response from being marshalled at all.
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/api/brand"
+	"git.neds.sh/matty/entain/api/jurisdiction"
+)
+
+const (
+	// versionMetadataKey is the header metadata racing sends the version of races as.
+	versionMetadataKey = "x-races-version"
+	// nextStartMetadataKey is the header metadata racing sends the next advertised start time of a race yet to jump
+	// as, should there be one.
+	nextStartMetadataKey = "x-races-next-start"
+)
+
+// timeRelativeParams are the query parameters reading races relative to when they're read, whose responses change
+// as time passes without races changing. Filter expressions only compare against fixed times.
+var timeRelativeParams = []string{"filter.starts_within", "filter.startsWithin"}
+
+// errNotModified is returned by the forward response option when the client already holds the response, for the
+// error handler to answer with a 304.
+var errNotModified = errors.New("not modified")
+
+type requestKey struct{}
+
+// Handler makes requests available to the forward response option, which the gateway doesn't hand them to.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey{}, r)))
+	})
+}
+
+// ForwardResponseOption tags responses to GETs for races with an ETag and Cache-Control, or answers them with a 304
+// when the client already holds them. Responses are cached for maxAge at most, and never beyond the next start of a
+// race, as races change once they jump. Responses to requests for races relative to the time are never tagged, and
+// mustn't be served from a cache without checking with the gateway first.
+func ForwardResponseOption(maxAge time.Duration) func(context.Context, http.ResponseWriter, proto.Message) error {
+	return func(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+		md, ok := runtime.ServerMetadataFromContext(ctx)
+		if !ok {
+			return nil
+		}
+
+		versions := md.HeaderMD.Get(versionMetadataKey)
+		nextStarts := md.HeaderMD.Get(nextStartMetadataKey)
+
+		// The revision is only of use to the gateway.
+		w.Header().Del(runtime.MetadataHeaderPrefix + versionMetadataKey)
+		w.Header().Del(runtime.MetadataHeaderPrefix + nextStartMetadataKey)
+
+		r, ok := ctx.Value(requestKey{}).(*http.Request)
+		if !ok || r.Method != http.MethodGet || len(versions) == 0 {
+			return nil
+		}
+
+		if timeRelative(r) {
+			w.Header().Set("Cache-Control", "no-cache")
+			return nil
+		}
+
+		etag := entityTag(versions[0], r)
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", brand.Header)
+		w.Header().Add("Vary", jurisdiction.Header)
+		w.Header().Set("Cache-Control", cacheControl(maxAge, nextStarts))
+
+		if matches(r.Header.Get("If-None-Match"), etag) {
+			return errNotModified
+		}
+
+		return nil
+	}
+}
+
+// ErrorHandler answers requests with a 304 when the client already holds the response, handing any other error on
+// to next.
+func ErrorHandler(next runtime.ErrorHandlerFunc) runtime.ErrorHandlerFunc {
+	return func(
+		ctx context.Context,
+		mux *runtime.ServeMux,
+		marshaler runtime.Marshaler,
+		w http.ResponseWriter,
+		r *http.Request,
+		err error,
+	) {
+		if !errors.Is(err, errNotModified) {
+			next(ctx, mux, marshaler, w, r, err)
+			return
+		}
+
+		w.Header().Del("Content-Type")
+		w.Header().Del("Trailer")
+		w.WriteHeader(http.StatusNotModified)
+	}
+}
+
+// entityTag derives a strong ETag from the version of races and the request they were read for. Reading the same
+// races in the same way, for the same brand and jurisdiction, at the same version always gives the same response.
+func entityTag(version string, r *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(
+		h,
+		"%s\n%s\n%s\n%s\n%s\n",
+		version,
+		r.URL.RequestURI(),
+		r.Header.Get("Accept"),
+		r.Header.Get(brand.Header),
+		r.Header.Get(jurisdiction.Header),
+	)
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// timeRelative reports whether a request reads races relative to the time it's made.
+func timeRelative(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range timeRelativeParams {
+		if _, ok := query[param]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheControl returns the Cache-Control of a response, which may be cached for maxAge, or until the next start of
+// a race should that be sooner.
+func cacheControl(maxAge time.Duration, nextStarts []string) string {
+	if len(nextStarts) > 0 {
+		if nextStart, err := time.Parse(time.RFC3339, nextStarts[0]); err == nil {
+			if untilStart := time.Until(nextStart); untilStart < maxAge {
+				maxAge = untilStart
+			}
+		}
+	}
+
+	seconds := int(math.Floor(maxAge.Seconds()))
+	if seconds <= 0 {
+		return "no-cache"
+	}
+
+	return fmt.Sprintf("public, max-age=%d", seconds)
+}
+
+// matches reports whether an If-None-Match header holds the given ETag, comparing them weakly as RFC 7232 asks.
+func matches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,217 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+
+	"git.neds.sh/matty/entain/api/brand"
+	"git.neds.sh/matty/entain/api/jurisdiction"
+)
+
+// forward runs the forward response option over a response to a request, as racing sent the given header metadata
+// with it, returning the recorded response and the error the option returned.
+func forward(r *http.Request, maxAge time.Duration, header metadata.MD) (*httptest.ResponseRecorder, error) {
+	ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{HeaderMD: header})
+	ctx = context.WithValue(ctx, requestKey{}, r)
+
+	w := httptest.NewRecorder()
+	for k, vs := range header {
+		for _, v := range vs {
+			w.Header().Add(runtime.MetadataHeaderPrefix+k, v)
+		}
+	}
+
+	return w, ForwardResponseOption(maxAge)(ctx, w, nil)
+}
+
+// get returns a GET for the given path, with the given headers set.
+func get(target string, headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+
+	return r
+}
+
+func TestForwardResponseOptionTagsResponses(t *testing.T) {
+	header := metadata.Pairs(versionMetadataKey, "42")
+
+	w, err := forward(get("/v1/races?filter.meeting_ids=1"), time.Minute, header)
+	if err != nil {
+		t.Fatalf("forwarding response: %s", err)
+	}
+
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) != 34 {
+		t.Errorf("got ETag %q, want a strong ETag", etag)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("got Cache-Control %q", got)
+	}
+	if got := w.Header().Values("Vary"); strings.Join(got, ",") != "Accept,"+brand.Header+","+jurisdiction.Header {
+		t.Errorf("got Vary %v", got)
+	}
+	if got := w.Header().Get(runtime.MetadataHeaderPrefix + versionMetadataKey); got != "" {
+		t.Errorf("version was passed on to the client as %q", got)
+	}
+
+	// The same request at the same version is given the same tag, while anything that changes the response gives
+	// another.
+	tags := map[string]*http.Request{
+		"same":          get("/v1/races?filter.meeting_ids=1"),
+		"query":         get("/v1/races?filter.meeting_ids=2"),
+		"accept":        get("/v1/races?filter.meeting_ids=1", "Accept", "text/csv"),
+		"brand":         get("/v1/races?filter.meeting_ids=1", brand.Header, "neds"),
+		"jurisdiction":  get("/v1/races?filter.meeting_ids=1", jurisdiction.Header, "AU-SA"),
+		"other version": get("/v1/races?filter.meeting_ids=1"),
+	}
+	for name, r := range tags {
+		header := header
+		if name == "other version" {
+			header = metadata.Pairs(versionMetadataKey, "43")
+		}
+
+		w, err := forward(r, time.Minute, header)
+		if err != nil {
+			t.Fatalf("%s: forwarding response: %s", name, err)
+		}
+
+		if same := w.Header().Get("ETag") == etag; same != (name == "same") {
+			t.Errorf("%s: got ETag %q, which matching the first is %t", name, w.Header().Get("ETag"), same)
+		}
+	}
+}
+
+func TestForwardResponseOptionAnswersConditionalRequests(t *testing.T) {
+	header := metadata.Pairs(versionMetadataKey, "42")
+
+	w, err := forward(get("/v1/races/1"), time.Minute, header)
+	if err != nil {
+		t.Fatalf("forwarding response: %s", err)
+	}
+	etag := w.Header().Get("ETag")
+
+	tests := map[string]struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		"matching":      {etag, true},
+		"weak":          {"W/" + etag, true},
+		"among others":  {`"abc", ` + etag, true},
+		"any":           {"*", true},
+		"other":         {`"abc"`, false},
+		"missing":       {"", false},
+		"other version": {etag, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := header
+			if name == "other version" {
+				header = metadata.Pairs(versionMetadataKey, "43")
+			}
+
+			_, err := forward(get("/v1/races/1", "If-None-Match", test.ifNoneMatch), time.Minute, header)
+			if got := errors.Is(err, errNotModified); got != test.want {
+				t.Errorf("got %v, want not modified %t", err, test.want)
+			}
+		})
+	}
+}
+
+func TestForwardResponseOptionCapsCachingAtNextStart(t *testing.T) {
+	tests := map[string]struct {
+		nextStart time.Time
+		want      string
+	}{
+		"soon":   {time.Now().Add(30*time.Second + 500*time.Millisecond), "public, max-age=30"},
+		"later":  {time.Now().Add(time.Hour), "public, max-age=60"},
+		"passed": {time.Now().Add(-time.Second), "no-cache"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := metadata.Pairs(versionMetadataKey, "42", nextStartMetadataKey, test.nextStart.UTC().Format(time.RFC3339Nano))
+
+			w, err := forward(get("/v1/races"), time.Minute, header)
+			if err != nil {
+				t.Fatalf("forwarding response: %s", err)
+			}
+
+			if got := w.Header().Get("Cache-Control"); got != test.want {
+				t.Errorf("got Cache-Control %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestForwardResponseOptionLeavesTimeRelativeRequestsUntagged(t *testing.T) {
+	for _, target := range []string{"/v1/races?filter.starts_within=3600s", "/v1/races?filter.startsWithin=3600s"} {
+		w, err := forward(get(target, "If-None-Match", "*"), time.Minute, metadata.Pairs(versionMetadataKey, "42"))
+		if err != nil {
+			t.Errorf("%s: got %v, want the response sent", target, err)
+		}
+
+		if got := w.Header().Get("ETag"); got != "" {
+			t.Errorf("%s: got ETag %q, want none", target, got)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("%s: got Cache-Control %q, want no-cache", target, got)
+		}
+	}
+}
+
+func TestForwardResponseOptionLeavesOtherResponsesUntagged(t *testing.T) {
+	tests := map[string]struct {
+		r      *http.Request
+		header metadata.MD
+	}{
+		"post":        {httptest.NewRequest(http.MethodPost, "/v1/races", nil), metadata.Pairs(versionMetadataKey, "42")},
+		"unversioned": {get("/v1/races/next-to-jump"), metadata.MD{}},
+	}
+
+	for name, test := range tests {
+		w, err := forward(test.r, time.Minute, test.header)
+		if err != nil {
+			t.Errorf("%s: got %v, want the response sent", name, err)
+		}
+
+		if got := w.Header().Get("ETag"); got != "" {
+			t.Errorf("%s: got ETag %q, want none", name, got)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	var handled error
+	next := func(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/json")
+	ErrorHandler(next)(context.Background(), nil, nil, w, get("/v1/races"), errNotModified)
+
+	if w.Code != http.StatusNotModified || handled != nil {
+		t.Errorf("got %d, handing on %v, want a 304", w.Code, handled)
+	}
+	if got := w.Header().Get("Content-Type"); got != "" {
+		t.Errorf("304 has Content-Type %q", got)
+	}
+
+	other := errors.New("unavailable")
+	ErrorHandler(next)(context.Background(), nil, nil, httptest.NewRecorder(), get("/v1/races"), other)
+	if handled != other {
+		t.Errorf("handed on %v, want %v", handled, other)
+	}
+}
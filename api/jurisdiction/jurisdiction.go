@@ -0,0 +1,28 @@
+// Package jurisdiction passes the jurisdiction clients call the gateway from on to the services behind it, which
+// hide or restrict the races regulations there require.
+package jurisdiction
+
+import (
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const (
+	// Header is the header clients name the jurisdiction they're calling from with, such as AU-SA. It's expected to
+	// be set by whatever authenticates clients in front of the gateway, from the claims of their token.
+	Header = "X-Jurisdiction"
+	// metadataKey is the metadata the jurisdiction is passed on to services as.
+	metadataKey = "x-jurisdiction"
+)
+
+// HeaderMatcher forwards the jurisdiction header on as metadata, handing any other header on to next.
+func HeaderMatcher(next runtime.HeaderMatcherFunc) runtime.HeaderMatcherFunc {
+	return func(key string) (string, bool) {
+		if http.CanonicalHeaderKey(key) == Header {
+			return metadataKey, true
+		}
+
+		return next(key)
+	}
+}
@@ -3,19 +3,65 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"git.neds.sh/matty/entain/api/brand"
+	"git.neds.sh/matty/entain/api/cors"
+	"git.neds.sh/matty/entain/api/grpcweb"
+	"git.neds.sh/matty/entain/api/httpcache"
+	"git.neds.sh/matty/entain/api/jurisdiction"
+	"git.neds.sh/matty/entain/api/problem"
+	"git.neds.sh/matty/entain/api/proto/betting"
 	"git.neds.sh/matty/entain/api/proto/racing"
+	"git.neds.sh/matty/entain/api/ratelimit"
+	"git.neds.sh/matty/entain/api/upstream"
+	"git.neds.sh/matty/entain/tokenbucket"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
 )
 
 var (
 	apiEndpoint  = flag.String("api-endpoint", "localhost:8000", "API endpoint")
-	grpcEndpoint = flag.String("grpc-endpoint", "localhost:9000", "gRPC server endpoint")
+	grpcEndpoint = flag.String("grpc-endpoint", "localhost:9000", "gRPC server endpoint, or a comma separated list of them, or a target such as dns:///racing:9000")
+
+	bettingGRPCEndpoint = flag.String("betting-grpc-endpoint", "localhost:9001", "Betting gRPC server endpoint, in the same forms as -grpc-endpoint")
+
+	timeout          = flag.Duration("timeout", 10*time.Second, "How long unary calls to upstreams may take, unless given a -route-timeout")
+	retryAttempts    = flag.Int("retry-attempts", 3, "How many times idempotent calls are attempted while an upstream is unavailable, at most")
+	breakerThreshold = flag.Int("breaker-threshold", 5, "How many calls in a row must find an upstream unavailable to open its circuit breaker")
+	breakerCooldown  = flag.Duration("breaker-cooldown", 10*time.Second, "How long calls fail fast once an upstream's circuit breaker opens")
+	cacheMaxAge      = flag.Duration("cache-max-age", 5*time.Second, "How long clients may cache races read, at most")
+	corsOrigins      = flag.String("cors-allowed-origins", "", "Comma separated origins browser apps may call the API from, such as https://*.example.com, with none turning CORS off")
+	corsMethods      = flag.String("cors-allowed-methods", "GET,POST", "Comma separated methods browser apps may use across origins")
+	corsHeaders      = flag.String("cors-allowed-headers", "Content-Type,If-None-Match,X-API-Key,X-Brand,X-Jurisdiction,X-Grpc-Web,X-User-Agent,Grpc-Timeout", "Comma separated headers browser apps may set across origins")
+	corsMaxAge       = flag.Duration("cors-max-age", 10*time.Minute, "How long browsers may cache the answer to a preflight request")
+	rateLimit        = flag.String("rate-limit", "50/s", "How many requests each client address, and API key, may make of a route, such as 50/s or 600/m, with zero meaning no limit")
+	trustedProxies   = flag.String("trusted-proxies", "", "Comma separated addresses or CIDR ranges of proxies whose X-Forwarded-For gives the client address requests are rate limited by")
+
+	upstreams     = upstream.Routes{}
+	routeTimeouts = upstream.Timeouts{}
+
+	routeRateLimits ratelimit.Rules
 )
 
+func init() {
+	flag.Var(upstreams, "upstream", "Route a service to its own upstream, as service=upstream, such as racing.Pricing=localhost:9100 (repeatable)")
+	flag.Var(&routeRateLimits, "route-rate-limit", "Give routes a -rate-limit of their own, as [METHOD ]prefix=limit, such as \"POST /v1/list-races=5/s\" (repeatable)")
+	flag.Var(routeTimeouts, "route-timeout", "Time out calls to a service or method, as name=duration, such as racing.Racing/ListRaces=2s (repeatable)")
+}
+
+// service is a gRPC service the gateway forwards requests on to.
+type service struct {
+	name     string
+	target   string
+	register func(context.Context, *runtime.ServeMux, *grpc.ClientConn) error
+}
+
 func main() {
 	flag.Parse()
 
@@ -29,17 +75,143 @@ func run() error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	mux := runtime.NewServeMux()
-	if err := racing.RegisterRacingHandlerFromEndpoint(
-		ctx,
-		mux,
-		*grpcEndpoint,
-		[]grpc.DialOption{grpc.WithInsecure()},
-	); err != nil {
-		return err
+	defaultRateLimit, err := tokenbucket.ParseLimit(*rateLimit)
+	if err != nil {
+		return fmt.Errorf("parsing -rate-limit: %w", err)
+	}
+
+	proxies, err := ratelimit.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing -trusted-proxies: %w", err)
+	}
+
+	services := []service{
+		{name: "racing.Racing", target: *grpcEndpoint, register: racing.RegisterRacingHandler},
+		{name: "racing.Pricing", target: *grpcEndpoint, register: racing.RegisterPricingHandler},
+		{name: "betting.Betting", target: *bettingGRPCEndpoint, register: betting.RegisterBettingHandler},
+	}
+
+	for name, target := range upstreams {
+		found := false
+		for i := range services {
+			if services[i].name == name {
+				services[i].target = target
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("cannot route unknown service %q", name)
+		}
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithErrorHandler(httpcache.ErrorHandler(problem.ErrorHandler)),
+		runtime.WithForwardResponseOption(httpcache.ForwardResponseOption(*cacheMaxAge)),
+		runtime.WithIncomingHeaderMatcher(jurisdiction.HeaderMatcher(brand.HeaderMatcher)),
+	)
+
+	if *retryAttempts > 1 && !strings.EqualFold(os.Getenv("GRPC_GO_RETRY"), "on") {
+		log.Printf("Retries are off, as gRPC only retries calls when GRPC_GO_RETRY=on\n")
+	}
+
+	// Services sharing an upstream share a connection to it, and its circuit breaker.
+	conns := make(map[string]*grpc.ClientConn)
+	var targets []string
+	byTarget := make(map[string][]service)
+	for _, svc := range services {
+		if _, ok := byTarget[svc.target]; !ok {
+			targets = append(targets, svc.target)
+		}
+		byTarget[svc.target] = append(byTarget[svc.target], svc)
+	}
+
+	for _, target := range targets {
+		policy := upstream.Policy{
+			Timeout:       *timeout,
+			Timeouts:      routeTimeouts,
+			RetryAttempts: *retryAttempts,
+		}
+		for _, svc := range byTarget[target] {
+			policy.Services = append(policy.Services, svc.name)
+		}
+
+		opts := append(
+			[]grpc.DialOption{grpc.WithInsecure()},
+			upstream.NewBreaker(target, *breakerThreshold, *breakerCooldown).DialOptions()...,
+		)
+
+		conn, err := upstream.Dial(ctx, target, policy, opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		for _, svc := range byTarget[target] {
+			if err := svc.register(ctx, mux, conn); err != nil {
+				return err
+			}
+			conns[svc.name] = conn
+
+			log.Printf("Routing %s to: %s\n", svc.name, svc.target)
+		}
 	}
 
 	log.Printf("API server listening on: %s\n", *apiEndpoint)
 
-	return http.ListenAndServe(*apiEndpoint, mux)
+	grpcWeb, err := grpcweb.NewHandler(conns)
+	if err != nil {
+		return err
+	}
+
+	jsonRoutes := httpcache.Handler(mux)
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grpcweb.IsGRPCWebRequest(r) {
+			grpcWeb.ServeHTTP(w, r)
+			return
+		}
+
+		jsonRoutes.ServeHTTP(w, r)
+	})
+
+	handler = brand.Handler(handler)
+
+	handler = ratelimit.NewLimiter(defaultRateLimit, routeRateLimits, proxies).Handler(handler)
+
+	// Preflight requests are answered before they're rate limited.
+	if *corsOrigins != "" {
+		handler = cors.Handler(cors.Config{
+			AllowedOrigins: splitList(*corsOrigins),
+			AllowedMethods: splitList(*corsMethods),
+			AllowedHeaders: splitList(*corsHeaders),
+			ExposedHeaders: exposedHeaders,
+			MaxAge:         *corsMaxAge,
+		}, handler)
+	}
+
+	return http.ListenAndServe(*apiEndpoint, handler)
+}
+
+// exposedHeaders are the response headers browser apps are let read across origins.
+var exposedHeaders = []string{
+	"ETag",
+	"Retry-After",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"RateLimit-Policy",
+	"Grpc-Status",
+	"Grpc-Message",
+}
+
+// splitList splits a comma separated list, dropping any items left empty.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
@@ -0,0 +1,149 @@
+// Package problem renders errors returned by the gRPC services as RFC 7807 problem details.
+//
+// See: https://tools.ietf.org/html/rfc7807
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ContentType is the media type of a problem details response.
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the gRPC code name to form the problem type URI.
+const typeBase = "https://grpc.github.io/grpc/core/md_doc_statuscodes.html#"
+
+// Problem is a problem details object, extended with the gRPC error model.
+type Problem struct {
+	// Type is a URI identifying the kind of problem.
+	Type string `json:"type"`
+	// Title is a short summary of the kind of problem.
+	Title string `json:"title"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance identifies this occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+
+	// Code is the gRPC status code name, such as "INVALID_ARGUMENT".
+	Code string `json:"code"`
+	// Reason is the machine readable reason from the google.rpc.ErrorInfo detail, if any.
+	Reason string `json:"reason,omitempty"`
+	// Domain is the domain from the google.rpc.ErrorInfo detail, if any.
+	Domain string `json:"domain,omitempty"`
+	// Metadata is the metadata from the google.rpc.ErrorInfo detail, if any.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// InvalidParams lists the fields from the google.rpc.BadRequest detail, if any.
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+
+	// RetryAfter is how long to wait before retrying, from the google.rpc.RetryInfo detail, if any. It's sent as the
+	// Retry-After header.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// InvalidParam describes a single invalid request field.
+type InvalidParam struct {
+	// Name is the path of the invalid field.
+	Name string `json:"name"`
+	// Reason explains why the field is invalid.
+	Reason string `json:"reason"`
+}
+
+// FromStatus builds a problem from a gRPC status and the request it was returned for.
+func FromStatus(st *status.Status, r *http.Request) *Problem {
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+	name := codeName(st.Code())
+
+	p := &Problem{
+		Type:     typeBase + name,
+		Title:    http.StatusText(httpStatus),
+		Status:   httpStatus,
+		Detail:   st.Message(),
+		Instance: r.URL.Path,
+		Code:     name,
+	}
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			p.Reason = d.Reason
+			p.Domain = d.Domain
+			p.Metadata = d.Metadata
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: v.Field, Reason: v.Description})
+			}
+		case *errdetails.RetryInfo:
+			p.RetryAfter = d.RetryDelay.AsDuration()
+		}
+	}
+
+	return p
+}
+
+// Write writes the problem as the response.
+func Write(w http.ResponseWriter, p *Problem) {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("failed marshalling problem: %s\n", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", ContentType)
+	if p.RetryAfter > 0 {
+		// Retry-After is in whole seconds, so is rounded up rather than asking for a retry too soon.
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(p.RetryAfter.Seconds()))))
+	}
+	w.WriteHeader(p.Status)
+
+	if _, err := w.Write(buf); err != nil {
+		log.Printf("failed writing problem: %s\n", err)
+	}
+}
+
+// ErrorHandler is a runtime.ErrorHandlerFunc rendering errors as problem details, in place of the gateway's
+// default google.rpc.Status body.
+func ErrorHandler(
+	ctx context.Context,
+	_ *runtime.ServeMux,
+	_ runtime.Marshaler,
+	w http.ResponseWriter,
+	r *http.Request,
+	err error,
+) {
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for k, vs := range md.HeaderMD {
+			for _, v := range vs {
+				w.Header().Add(fmt.Sprintf("%s%s", runtime.MetadataHeaderPrefix, k), v)
+			}
+		}
+	}
+
+	Write(w, FromStatus(status.Convert(err), r))
+}
+
+// codeName returns the canonical name of a gRPC code, such as "NOT_FOUND".
+func codeName(c codes.Code) string {
+	if name, ok := code.Code_name[int32(c)]; ok {
+		return name
+	}
+
+	return code.Code_UNKNOWN.String()
+}
@@ -0,0 +1,315 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0-devel
+// 	protoc        v3.13.0
+// source: betting/betting.proto
+
+package betting
+
+import (
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Request for PlaceBet call.
+type PlaceBetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// IdempotencyKey identifies the bet to the caller. Placing a bet again with the same key returns the original bet,
+	// rather than placing another.
+	IdempotencyKey string `protobuf:"bytes,1,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// RaceID is the race the bet is on.
+	RaceId int64 `protobuf:"varint,2,opt,name=race_id,json=raceId,proto3" json:"race_id,omitempty"`
+	// RunnerNumber is the runner the bet is on.
+	RunnerNumber int64 `protobuf:"varint,3,opt,name=runner_number,json=runnerNumber,proto3" json:"runner_number,omitempty"`
+	// StakeCents is the amount staked, in cents.
+	StakeCents int64 `protobuf:"varint,4,opt,name=stake_cents,json=stakeCents,proto3" json:"stake_cents,omitempty"`
+}
+
+func (x *PlaceBetRequest) Reset() {
+	*x = PlaceBetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_betting_betting_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PlaceBetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceBetRequest) ProtoMessage() {}
+
+func (x *PlaceBetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_betting_betting_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceBetRequest.ProtoReflect.Descriptor instead.
+func (*PlaceBetRequest) Descriptor() ([]byte, []int) {
+	return file_betting_betting_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PlaceBetRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *PlaceBetRequest) GetRaceId() int64 {
+	if x != nil {
+		return x.RaceId
+	}
+	return 0
+}
+
+func (x *PlaceBetRequest) GetRunnerNumber() int64 {
+	if x != nil {
+		return x.RunnerNumber
+	}
+	return 0
+}
+
+func (x *PlaceBetRequest) GetStakeCents() int64 {
+	if x != nil {
+		return x.StakeCents
+	}
+	return 0
+}
+
+// A bet resource.
+type Bet struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// ID represents a unique identifier for the bet.
+	Id int64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// IdempotencyKey is the key the bet was placed with.
+	IdempotencyKey string `protobuf:"bytes,2,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	// RaceID is the race the bet is on.
+	RaceId int64 `protobuf:"varint,3,opt,name=race_id,json=raceId,proto3" json:"race_id,omitempty"`
+	// RunnerNumber is the runner the bet is on.
+	RunnerNumber int64 `protobuf:"varint,4,opt,name=runner_number,json=runnerNumber,proto3" json:"runner_number,omitempty"`
+	// StakeCents is the amount staked, in cents.
+	StakeCents int64 `protobuf:"varint,5,opt,name=stake_cents,json=stakeCents,proto3" json:"stake_cents,omitempty"`
+	// PlacedAt is the time the bet was accepted.
+	PlacedAt *timestamp.Timestamp `protobuf:"bytes,6,opt,name=placed_at,json=placedAt,proto3" json:"placed_at,omitempty"`
+}
+
+func (x *Bet) Reset() {
+	*x = Bet{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_betting_betting_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Bet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Bet) ProtoMessage() {}
+
+func (x *Bet) ProtoReflect() protoreflect.Message {
+	mi := &file_betting_betting_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Bet.ProtoReflect.Descriptor instead.
+func (*Bet) Descriptor() ([]byte, []int) {
+	return file_betting_betting_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Bet) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Bet) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *Bet) GetRaceId() int64 {
+	if x != nil {
+		return x.RaceId
+	}
+	return 0
+}
+
+func (x *Bet) GetRunnerNumber() int64 {
+	if x != nil {
+		return x.RunnerNumber
+	}
+	return 0
+}
+
+func (x *Bet) GetStakeCents() int64 {
+	if x != nil {
+		return x.StakeCents
+	}
+	return 0
+}
+
+func (x *Bet) GetPlacedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.PlacedAt
+	}
+	return nil
+}
+
+var File_betting_betting_proto protoreflect.FileDescriptor
+
+var file_betting_betting_proto_rawDesc = []byte{
+	0x0a, 0x15, 0x62, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x2f, 0x62, 0x65, 0x74, 0x74, 0x69, 0x6e,
+	0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x62, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67,
+	0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e,
+	0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22,
+	0x99, 0x01, 0x0a, 0x0f, 0x50, 0x6c, 0x61, 0x63, 0x65, 0x42, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x27, 0x0a, 0x0f, 0x69, 0x64, 0x65, 0x6d, 0x70, 0x6f, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x69, 0x64,
+	0x65, 0x6d, 0x70, 0x6f, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x4b, 0x65, 0x79, 0x12, 0x17, 0x0a, 0x07,
+	0x72, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x72,
+	0x61, 0x63, 0x65, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x75, 0x6e, 0x6e, 0x65, 0x72, 0x5f,
+	0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x72, 0x75,
+	0x6e, 0x6e, 0x65, 0x72, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74,
+	0x61, 0x6b, 0x65, 0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x0a, 0x73, 0x74, 0x61, 0x6b, 0x65, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x22, 0xd6, 0x01, 0x0a, 0x03,
+	0x42, 0x65, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x02, 0x69, 0x64, 0x12, 0x27, 0x0a, 0x0f, 0x69, 0x64, 0x65, 0x6d, 0x70, 0x6f, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x69, 0x64,
+	0x65, 0x6d, 0x70, 0x6f, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x4b, 0x65, 0x79, 0x12, 0x17, 0x0a, 0x07,
+	0x72, 0x61, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x72,
+	0x61, 0x63, 0x65, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x75, 0x6e, 0x6e, 0x65, 0x72, 0x5f,
+	0x6e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x72, 0x75,
+	0x6e, 0x6e, 0x65, 0x72, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74,
+	0x61, 0x6b, 0x65, 0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x0a, 0x73, 0x74, 0x61, 0x6b, 0x65, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x37, 0x0a, 0x09, 0x70,
+	0x6c, 0x61, 0x63, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x08, 0x70, 0x6c, 0x61, 0x63,
+	0x65, 0x64, 0x41, 0x74, 0x32, 0x52, 0x0a, 0x07, 0x42, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x12,
+	0x47, 0x0a, 0x08, 0x50, 0x6c, 0x61, 0x63, 0x65, 0x42, 0x65, 0x74, 0x12, 0x18, 0x2e, 0x62, 0x65,
+	0x74, 0x74, 0x69, 0x6e, 0x67, 0x2e, 0x50, 0x6c, 0x61, 0x63, 0x65, 0x42, 0x65, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0c, 0x2e, 0x62, 0x65, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x2e,
+	0x42, 0x65, 0x74, 0x22, 0x13, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0d, 0x22, 0x08, 0x2f, 0x76, 0x31,
+	0x2f, 0x62, 0x65, 0x74, 0x73, 0x3a, 0x01, 0x2a, 0x42, 0x0a, 0x5a, 0x08, 0x2f, 0x62, 0x65, 0x74,
+	0x74, 0x69, 0x6e, 0x67, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_betting_betting_proto_rawDescOnce sync.Once
+	file_betting_betting_proto_rawDescData = file_betting_betting_proto_rawDesc
+)
+
+func file_betting_betting_proto_rawDescGZIP() []byte {
+	file_betting_betting_proto_rawDescOnce.Do(func() {
+		file_betting_betting_proto_rawDescData = protoimpl.X.CompressGZIP(file_betting_betting_proto_rawDescData)
+	})
+	return file_betting_betting_proto_rawDescData
+}
+
+var file_betting_betting_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_betting_betting_proto_goTypes = []interface{}{
+	(*PlaceBetRequest)(nil),     // 0: betting.PlaceBetRequest
+	(*Bet)(nil),                 // 1: betting.Bet
+	(*timestamp.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_betting_betting_proto_depIdxs = []int32{
+	2, // 0: betting.Bet.placed_at:type_name -> google.protobuf.Timestamp
+	0, // 1: betting.Betting.PlaceBet:input_type -> betting.PlaceBetRequest
+	1, // 2: betting.Betting.PlaceBet:output_type -> betting.Bet
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_betting_betting_proto_init() }
+func file_betting_betting_proto_init() {
+	if File_betting_betting_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_betting_betting_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PlaceBetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_betting_betting_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Bet); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_betting_betting_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_betting_betting_proto_goTypes,
+		DependencyIndexes: file_betting_betting_proto_depIdxs,
+		MessageInfos:      file_betting_betting_proto_msgTypes,
+	}.Build()
+	File_betting_betting_proto = out.File
+	file_betting_betting_proto_rawDesc = nil
+	file_betting_betting_proto_goTypes = nil
+	file_betting_betting_proto_depIdxs = nil
+}
@@ -4,6 +4,7 @@ package racing
 
 import (
 	context "context"
+	httpbody "google.golang.org/genproto/googleapis/api/httpbody"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -20,6 +21,25 @@ const _ = grpc.SupportPackageIsVersion7
 type RacingClient interface {
 	// ListRaces returns a list of all races.
 	ListRaces(ctx context.Context, in *ListRacesRequest, opts ...grpc.CallOption) (*ListRacesResponse, error)
+	// ListNextToJump returns the next open races to jump across all visible meetings.
+	ListNextToJump(ctx context.Context, in *ListNextToJumpRequest, opts ...grpc.CallOption) (*ListNextToJumpResponse, error)
+	// GetRace returns a single race by its ID.
+	GetRace(ctx context.Context, in *GetRaceRequest, opts ...grpc.CallOption) (*Race, error)
+	// ListRunners returns the runners of a race, in number order.
+	ListRunners(ctx context.Context, in *ListRunnersRequest, opts ...grpc.CallOption) (*ListRunnersResponse, error)
+	// BatchGetRaces returns the races with the given IDs, in the order asked for.
+	BatchGetRaces(ctx context.Context, in *BatchGetRacesRequest, opts ...grpc.CallOption) (*BatchGetRacesResponse, error)
+	// ExportRaces streams every race matching the request as newline delimited JSON or CSV, as asked for by the
+	// Accept header.
+	ExportRaces(ctx context.Context, in *ExportRacesRequest, opts ...grpc.CallOption) (Racing_ExportRacesClient, error)
+	// TransitionRace moves a race to a new status. It is an admin call, so isn't exposed over HTTP.
+	TransitionRace(ctx context.Context, in *TransitionRaceRequest, opts ...grpc.CallOption) (*TransitionRaceResponse, error)
+	// ListRaceStatusTransitions lists the status changes of a race, oldest first. It is an admin call, so isn't exposed
+	// over HTTP.
+	ListRaceStatusTransitions(ctx context.Context, in *ListRaceStatusTransitionsRequest, opts ...grpc.CallOption) (*ListRaceStatusTransitionsResponse, error)
+	// ImportRaceCard creates or updates the meetings, races and runners of a race card. It is an admin call, so isn't
+	// exposed over HTTP.
+	ImportRaceCard(ctx context.Context, in *ImportRaceCardRequest, opts ...grpc.CallOption) (*ImportRaceCardResponse, error)
 }
 
 type racingClient struct {
@@ -39,12 +59,126 @@ func (c *racingClient) ListRaces(ctx context.Context, in *ListRacesRequest, opts
 	return out, nil
 }
 
+func (c *racingClient) ListNextToJump(ctx context.Context, in *ListNextToJumpRequest, opts ...grpc.CallOption) (*ListNextToJumpResponse, error) {
+	out := new(ListNextToJumpResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/ListNextToJump", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) GetRace(ctx context.Context, in *GetRaceRequest, opts ...grpc.CallOption) (*Race, error) {
+	out := new(Race)
+	err := c.cc.Invoke(ctx, "/racing.Racing/GetRace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) ListRunners(ctx context.Context, in *ListRunnersRequest, opts ...grpc.CallOption) (*ListRunnersResponse, error) {
+	out := new(ListRunnersResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/ListRunners", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) BatchGetRaces(ctx context.Context, in *BatchGetRacesRequest, opts ...grpc.CallOption) (*BatchGetRacesResponse, error) {
+	out := new(BatchGetRacesResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/BatchGetRaces", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) ExportRaces(ctx context.Context, in *ExportRacesRequest, opts ...grpc.CallOption) (Racing_ExportRacesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Racing_ServiceDesc.Streams[0], "/racing.Racing/ExportRaces", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &racingExportRacesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Racing_ExportRacesClient interface {
+	Recv() (*httpbody.HttpBody, error)
+	grpc.ClientStream
+}
+
+type racingExportRacesClient struct {
+	grpc.ClientStream
+}
+
+func (x *racingExportRacesClient) Recv() (*httpbody.HttpBody, error) {
+	m := new(httpbody.HttpBody)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *racingClient) TransitionRace(ctx context.Context, in *TransitionRaceRequest, opts ...grpc.CallOption) (*TransitionRaceResponse, error) {
+	out := new(TransitionRaceResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/TransitionRace", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) ListRaceStatusTransitions(ctx context.Context, in *ListRaceStatusTransitionsRequest, opts ...grpc.CallOption) (*ListRaceStatusTransitionsResponse, error) {
+	out := new(ListRaceStatusTransitionsResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/ListRaceStatusTransitions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *racingClient) ImportRaceCard(ctx context.Context, in *ImportRaceCardRequest, opts ...grpc.CallOption) (*ImportRaceCardResponse, error) {
+	out := new(ImportRaceCardResponse)
+	err := c.cc.Invoke(ctx, "/racing.Racing/ImportRaceCard", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // RacingServer is the server API for Racing service.
 // All implementations must embed UnimplementedRacingServer
 // for forward compatibility
 type RacingServer interface {
 	// ListRaces returns a list of all races.
 	ListRaces(context.Context, *ListRacesRequest) (*ListRacesResponse, error)
+	// ListNextToJump returns the next open races to jump across all visible meetings.
+	ListNextToJump(context.Context, *ListNextToJumpRequest) (*ListNextToJumpResponse, error)
+	// GetRace returns a single race by its ID.
+	GetRace(context.Context, *GetRaceRequest) (*Race, error)
+	// ListRunners returns the runners of a race, in number order.
+	ListRunners(context.Context, *ListRunnersRequest) (*ListRunnersResponse, error)
+	// BatchGetRaces returns the races with the given IDs, in the order asked for.
+	BatchGetRaces(context.Context, *BatchGetRacesRequest) (*BatchGetRacesResponse, error)
+	// ExportRaces streams every race matching the request as newline delimited JSON or CSV, as asked for by the
+	// Accept header.
+	ExportRaces(*ExportRacesRequest, Racing_ExportRacesServer) error
+	// TransitionRace moves a race to a new status. It is an admin call, so isn't exposed over HTTP.
+	TransitionRace(context.Context, *TransitionRaceRequest) (*TransitionRaceResponse, error)
+	// ListRaceStatusTransitions lists the status changes of a race, oldest first. It is an admin call, so isn't exposed
+	// over HTTP.
+	ListRaceStatusTransitions(context.Context, *ListRaceStatusTransitionsRequest) (*ListRaceStatusTransitionsResponse, error)
+	// ImportRaceCard creates or updates the meetings, races and runners of a race card. It is an admin call, so isn't
+	// exposed over HTTP.
+	ImportRaceCard(context.Context, *ImportRaceCardRequest) (*ImportRaceCardResponse, error)
 	mustEmbedUnimplementedRacingServer()
 }
 
@@ -55,6 +189,30 @@ type UnimplementedRacingServer struct {
 func (UnimplementedRacingServer) ListRaces(context.Context, *ListRacesRequest) (*ListRacesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListRaces not implemented")
 }
+func (UnimplementedRacingServer) ListNextToJump(context.Context, *ListNextToJumpRequest) (*ListNextToJumpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNextToJump not implemented")
+}
+func (UnimplementedRacingServer) GetRace(context.Context, *GetRaceRequest) (*Race, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRace not implemented")
+}
+func (UnimplementedRacingServer) ListRunners(context.Context, *ListRunnersRequest) (*ListRunnersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRunners not implemented")
+}
+func (UnimplementedRacingServer) BatchGetRaces(context.Context, *BatchGetRacesRequest) (*BatchGetRacesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetRaces not implemented")
+}
+func (UnimplementedRacingServer) ExportRaces(*ExportRacesRequest, Racing_ExportRacesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportRaces not implemented")
+}
+func (UnimplementedRacingServer) TransitionRace(context.Context, *TransitionRaceRequest) (*TransitionRaceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransitionRace not implemented")
+}
+func (UnimplementedRacingServer) ListRaceStatusTransitions(context.Context, *ListRaceStatusTransitionsRequest) (*ListRaceStatusTransitionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRaceStatusTransitions not implemented")
+}
+func (UnimplementedRacingServer) ImportRaceCard(context.Context, *ImportRaceCardRequest) (*ImportRaceCardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportRaceCard not implemented")
+}
 func (UnimplementedRacingServer) mustEmbedUnimplementedRacingServer() {}
 
 // UnsafeRacingServer may be embedded to opt out of forward compatibility for this service.
@@ -86,6 +244,153 @@ func _Racing_ListRaces_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Racing_ListNextToJump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNextToJumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).ListNextToJump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/ListNextToJump",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).ListNextToJump(ctx, req.(*ListNextToJumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_GetRace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).GetRace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/GetRace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).GetRace(ctx, req.(*GetRaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_ListRunners_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRunnersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).ListRunners(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/ListRunners",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).ListRunners(ctx, req.(*ListRunnersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_BatchGetRaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).BatchGetRaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/BatchGetRaces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).BatchGetRaces(ctx, req.(*BatchGetRacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_ExportRaces_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRacesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RacingServer).ExportRaces(m, &racingExportRacesServer{stream})
+}
+
+type Racing_ExportRacesServer interface {
+	Send(*httpbody.HttpBody) error
+	grpc.ServerStream
+}
+
+type racingExportRacesServer struct {
+	grpc.ServerStream
+}
+
+func (x *racingExportRacesServer) Send(m *httpbody.HttpBody) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Racing_TransitionRace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransitionRaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).TransitionRace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/TransitionRace",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).TransitionRace(ctx, req.(*TransitionRaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_ListRaceStatusTransitions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRaceStatusTransitionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).ListRaceStatusTransitions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/ListRaceStatusTransitions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).ListRaceStatusTransitions(ctx, req.(*ListRaceStatusTransitionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Racing_ImportRaceCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportRaceCardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RacingServer).ImportRaceCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Racing/ImportRaceCard",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RacingServer).ImportRaceCard(ctx, req.(*ImportRaceCardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Racing_ServiceDesc is the grpc.ServiceDesc for Racing service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -97,7 +402,271 @@ var Racing_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListRaces",
 			Handler:    _Racing_ListRaces_Handler,
 		},
+		{
+			MethodName: "ListNextToJump",
+			Handler:    _Racing_ListNextToJump_Handler,
+		},
+		{
+			MethodName: "GetRace",
+			Handler:    _Racing_GetRace_Handler,
+		},
+		{
+			MethodName: "ListRunners",
+			Handler:    _Racing_ListRunners_Handler,
+		},
+		{
+			MethodName: "BatchGetRaces",
+			Handler:    _Racing_BatchGetRaces_Handler,
+		},
+		{
+			MethodName: "TransitionRace",
+			Handler:    _Racing_TransitionRace_Handler,
+		},
+		{
+			MethodName: "ListRaceStatusTransitions",
+			Handler:    _Racing_ListRaceStatusTransitions_Handler,
+		},
+		{
+			MethodName: "ImportRaceCard",
+			Handler:    _Racing_ImportRaceCard_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportRaces",
+			Handler:       _Racing_ExportRaces_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "racing/racing.proto",
+}
+
+// PricingClient is the client API for Pricing service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PricingClient interface {
+	// GetPrices returns the current fixed odds of each runner in a race.
+	GetPrices(ctx context.Context, in *GetPricesRequest, opts ...grpc.CallOption) (*GetPricesResponse, error)
+	// ListPriceHistory returns every price published for a race, oldest first.
+	ListPriceHistory(ctx context.Context, in *ListPriceHistoryRequest, opts ...grpc.CallOption) (*ListPriceHistoryResponse, error)
+	// WatchPrices streams the prices of a race as they're published.
+	WatchPrices(ctx context.Context, in *WatchPricesRequest, opts ...grpc.CallOption) (Pricing_WatchPricesClient, error)
+	// PublishPrices publishes new prices for runners in a race. It is an admin call, so isn't exposed over HTTP.
+	PublishPrices(ctx context.Context, in *PublishPricesRequest, opts ...grpc.CallOption) (*PublishPricesResponse, error)
+}
+
+type pricingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPricingClient(cc grpc.ClientConnInterface) PricingClient {
+	return &pricingClient{cc}
+}
+
+func (c *pricingClient) GetPrices(ctx context.Context, in *GetPricesRequest, opts ...grpc.CallOption) (*GetPricesResponse, error) {
+	out := new(GetPricesResponse)
+	err := c.cc.Invoke(ctx, "/racing.Pricing/GetPrices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pricingClient) ListPriceHistory(ctx context.Context, in *ListPriceHistoryRequest, opts ...grpc.CallOption) (*ListPriceHistoryResponse, error) {
+	out := new(ListPriceHistoryResponse)
+	err := c.cc.Invoke(ctx, "/racing.Pricing/ListPriceHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pricingClient) WatchPrices(ctx context.Context, in *WatchPricesRequest, opts ...grpc.CallOption) (Pricing_WatchPricesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Pricing_ServiceDesc.Streams[0], "/racing.Pricing/WatchPrices", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pricingWatchPricesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Pricing_WatchPricesClient interface {
+	Recv() (*Price, error)
+	grpc.ClientStream
+}
+
+type pricingWatchPricesClient struct {
+	grpc.ClientStream
+}
+
+func (x *pricingWatchPricesClient) Recv() (*Price, error) {
+	m := new(Price)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *pricingClient) PublishPrices(ctx context.Context, in *PublishPricesRequest, opts ...grpc.CallOption) (*PublishPricesResponse, error) {
+	out := new(PublishPricesResponse)
+	err := c.cc.Invoke(ctx, "/racing.Pricing/PublishPrices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PricingServer is the server API for Pricing service.
+// All implementations must embed UnimplementedPricingServer
+// for forward compatibility
+type PricingServer interface {
+	// GetPrices returns the current fixed odds of each runner in a race.
+	GetPrices(context.Context, *GetPricesRequest) (*GetPricesResponse, error)
+	// ListPriceHistory returns every price published for a race, oldest first.
+	ListPriceHistory(context.Context, *ListPriceHistoryRequest) (*ListPriceHistoryResponse, error)
+	// WatchPrices streams the prices of a race as they're published.
+	WatchPrices(*WatchPricesRequest, Pricing_WatchPricesServer) error
+	// PublishPrices publishes new prices for runners in a race. It is an admin call, so isn't exposed over HTTP.
+	PublishPrices(context.Context, *PublishPricesRequest) (*PublishPricesResponse, error)
+	mustEmbedUnimplementedPricingServer()
+}
+
+// UnimplementedPricingServer must be embedded to have forward compatible implementations.
+type UnimplementedPricingServer struct {
+}
+
+func (UnimplementedPricingServer) GetPrices(context.Context, *GetPricesRequest) (*GetPricesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrices not implemented")
+}
+func (UnimplementedPricingServer) ListPriceHistory(context.Context, *ListPriceHistoryRequest) (*ListPriceHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPriceHistory not implemented")
+}
+func (UnimplementedPricingServer) WatchPrices(*WatchPricesRequest, Pricing_WatchPricesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPrices not implemented")
+}
+func (UnimplementedPricingServer) PublishPrices(context.Context, *PublishPricesRequest) (*PublishPricesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishPrices not implemented")
+}
+func (UnimplementedPricingServer) mustEmbedUnimplementedPricingServer() {}
+
+// UnsafePricingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PricingServer will
+// result in compilation errors.
+type UnsafePricingServer interface {
+	mustEmbedUnimplementedPricingServer()
+}
+
+func RegisterPricingServer(s grpc.ServiceRegistrar, srv PricingServer) {
+	s.RegisterService(&Pricing_ServiceDesc, srv)
+}
+
+func _Pricing_GetPrices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPricesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PricingServer).GetPrices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Pricing/GetPrices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PricingServer).GetPrices(ctx, req.(*GetPricesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pricing_ListPriceHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPriceHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PricingServer).ListPriceHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Pricing/ListPriceHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PricingServer).ListPriceHistory(ctx, req.(*ListPriceHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pricing_WatchPrices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPricesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PricingServer).WatchPrices(m, &pricingWatchPricesServer{stream})
+}
+
+type Pricing_WatchPricesServer interface {
+	Send(*Price) error
+	grpc.ServerStream
+}
+
+type pricingWatchPricesServer struct {
+	grpc.ServerStream
+}
+
+func (x *pricingWatchPricesServer) Send(m *Price) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Pricing_PublishPrices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishPricesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PricingServer).PublishPrices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/racing.Pricing/PublishPrices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PricingServer).PublishPrices(ctx, req.(*PublishPricesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Pricing_ServiceDesc is the grpc.ServiceDesc for Pricing service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Pricing_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "racing.Pricing",
+	HandlerType: (*PricingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPrices",
+			Handler:    _Pricing_GetPrices_Handler,
+		},
+		{
+			MethodName: "ListPriceHistory",
+			Handler:    _Pricing_ListPriceHistory_Handler,
+		},
+		{
+			MethodName: "PublishPrices",
+			Handler:    _Pricing_PublishPrices_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPrices",
+			Handler:       _Pricing_WatchPrices_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "racing/racing.proto",
 }
@@ -0,0 +1,361 @@
+// Package ratelimit limits how often clients may make requests of the gateway, with token buckets kept for each
+// client on each route.
+//
+// Clients are told apart by the address requests come from, which is that of the proxy in front of the gateway
+// should there be one, so every client behind it shares a bucket. Proxies trusted to give the address they were
+// called from in X-Forwarded-For have it used instead.
+//
+// Clients are told of their limits through the RateLimit headers of the IETF draft, and requests beyond them are
+// answered with a 429 and Retry-After.
+//
+// See: https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"git.neds.sh/matty/entain/api/problem"
+	"git.neds.sh/matty/entain/tokenbucket"
+)
+
+// APIKeyHeader is the header clients identify themselves with, such as affiliates given a key of their own.
+const APIKeyHeader = "X-API-Key"
+
+const (
+	// sweepInterval is how often buckets which have refilled are dropped, as they're no different to new ones.
+	sweepInterval = time.Minute
+	// maxBuckets is the most buckets kept, beyond which the least recently used are dropped.
+	maxBuckets = 100000
+)
+
+// Rule limits requests whose path starts with Prefix, and whose method is Method when given.
+type Rule struct {
+	Method string
+	Prefix string
+	Limit  tokenbucket.Limit
+}
+
+// Rules is a flag.Value, set with [METHOD ]prefix=limit, such as "POST /v1/list-races=5/s".
+type Rules []Rule
+
+func (r *Rules) String() string {
+	rules := make([]string, len(*r))
+	for i, rule := range *r {
+		rules[i] = strings.TrimSpace(rule.Method+" "+rule.Prefix) + "=" + rule.Limit.String()
+	}
+
+	return strings.Join(rules, " ")
+}
+
+func (r *Rules) Set(value string) error {
+	i := strings.LastIndex(value, "=")
+	if i < 0 {
+		return fmt.Errorf("expected [METHOD ]prefix=limit, got %q", value)
+	}
+
+	limit, err := tokenbucket.ParseLimit(value[i+1:])
+	if err != nil {
+		return err
+	}
+
+	rule := Rule{Limit: limit}
+
+	route := strings.Fields(value[:i])
+	switch len(route) {
+	case 1:
+		rule.Prefix = route[0]
+	case 2:
+		rule.Method, rule.Prefix = strings.ToUpper(route[0]), route[1]
+	default:
+		return fmt.Errorf("expected [METHOD ]prefix=limit, got %q", value)
+	}
+
+	*r = append(*r, rule)
+
+	return nil
+}
+
+// match returns the rule applying to a request, being the one with the longest prefix, preferring those naming
+// its method. Requests matching no rule fall under the default limit.
+func (r Rules) match(req *http.Request, defaultLimit tokenbucket.Limit) (string, tokenbucket.Limit) {
+	var (
+		best  *Rule
+		route = "default"
+		limit = defaultLimit
+	)
+
+	for i := range r {
+		rule := &r[i]
+		if !strings.HasPrefix(req.URL.Path, rule.Prefix) || (rule.Method != "" && rule.Method != req.Method) {
+			continue
+		}
+
+		if best == nil ||
+			len(rule.Prefix) > len(best.Prefix) ||
+			(len(rule.Prefix) == len(best.Prefix) && rule.Method != "" && best.Method == "") {
+			best = rule
+		}
+	}
+
+	if best != nil {
+		route = strings.TrimSpace(best.Method + " " + best.Prefix)
+		limit = best.Limit
+	}
+
+	return route, limit
+}
+
+// Limiter limits the requests made of each route, by each client address and by each API key. Requests carrying an
+// API key must be within the limits of both their key and their address, and count against their address even when
+// refused by their key.
+type Limiter struct {
+	defaultLimit   tokenbucket.Limit
+	rules          Rules
+	trustedProxies []*net.IPNet
+	maxBuckets     int
+
+	mu sync.Mutex
+	// buckets holds the elements of lru by their key.
+	buckets map[bucketKey]*list.Element
+	// lru holds the buckets, most recently used first.
+	lru       *list.List
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	route  string
+	client string
+}
+
+// bucketEntry is a bucket kept by the limiter.
+type bucketEntry struct {
+	key    bucketKey
+	bucket *tokenbucket.Bucket
+}
+
+// NewLimiter creates a limiter applying the given rules, and the default limit to requests matching none of them.
+// Requests from the trusted proxies are limited by the address the proxies give in X-Forwarded-For.
+func NewLimiter(defaultLimit tokenbucket.Limit, rules Rules, trustedProxies []*net.IPNet) *Limiter {
+	return &Limiter{
+		defaultLimit:   defaultLimit,
+		rules:          rules,
+		trustedProxies: trustedProxies,
+		maxBuckets:     maxBuckets,
+		buckets:        make(map[bucketKey]*list.Element),
+		lru:            list.New(),
+		lastSweep:      time.Now(),
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of the addresses, or CIDR ranges, of trusted proxies.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		// A lone address is a range of its own.
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy address or range %q", proxy)
+		}
+
+		proxies = append(proxies, ipNet)
+	}
+
+	return proxies, nil
+}
+
+// Handler limits the requests handed on to next.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, limit := l.rules.match(r, l.defaultLimit)
+		if limit.Requests <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clients := []string{"addr:" + l.clientAddr(r)}
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			clients = append(clients, "key:"+key)
+		}
+
+		allowed, remaining, reset, retryAfter := l.take(route, clients, limit, time.Now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+
+		if !allowed {
+			st, err := status.New(
+				codes.ResourceExhausted,
+				fmt.Sprintf("rate limit of %s exceeded", limit),
+			).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+			if err != nil {
+				st = status.New(codes.ResourceExhausted, fmt.Sprintf("rate limit of %s exceeded", limit))
+			}
+
+			problem.Write(w, problem.FromStatus(st, r))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take takes a token from the bucket of each client on a route, in turn, stopping at the first without one. The
+// address comes first, so the bucket of a key is only made once its address has spent a token, and those making up
+// keys can't make buckets any faster than their address may make requests. It returns how many requests are left,
+// how long until the buckets are full again, and how long until a request can next be made, all going by the
+// emptiest bucket.
+func (l *Limiter) take(route string, clients []string, limit tokenbucket.Limit, now time.Time) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	allowed := true
+
+	var emptiest *tokenbucket.Bucket
+	for _, client := range clients {
+		b := l.bucket(bucketKey{route: route, client: client}, limit, now)
+
+		allowed = b.Take()
+		if emptiest == nil || b.Tokens() < emptiest.Tokens() {
+			emptiest = b
+		}
+
+		if !allowed {
+			break
+		}
+	}
+
+	remaining := int(math.Floor(emptiest.Tokens()))
+	reset := emptiest.Until(float64(limit.Requests))
+	retryAfter := emptiest.Until(1)
+
+	return allowed, remaining, reset, retryAfter
+}
+
+// bucket returns the refilled bucket of a client on a route, making it should there be none, which the limiter must
+// be locked for. Making a bucket drops the least recently used once there are too many.
+func (l *Limiter) bucket(key bucketKey, limit tokenbucket.Limit, now time.Time) *tokenbucket.Bucket {
+	if e, ok := l.buckets[key]; ok {
+		if b := e.Value.(*bucketEntry).bucket; b.Limit() == limit {
+			l.lru.MoveToFront(e)
+			b.Refill(now)
+
+			return b
+		}
+
+		// The limit has changed since the bucket was made, so it's made again.
+		l.remove(e)
+	}
+
+	for l.lru.Len() >= l.maxBuckets {
+		l.remove(l.lru.Back())
+	}
+
+	b := tokenbucket.NewBucket(limit, now)
+	l.buckets[key] = l.lru.PushFront(&bucketEntry{key: key, bucket: b})
+
+	return b
+}
+
+// remove drops a bucket, which the limiter must be locked for.
+func (l *Limiter) remove(e *list.Element) {
+	l.lru.Remove(e)
+	delete(l.buckets, e.Value.(*bucketEntry).key)
+}
+
+// sweep drops the buckets which have refilled since they were last used, which the limiter must be locked for.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for e := l.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*bucketEntry).bucket.Idle(now) {
+			l.remove(e)
+		}
+		e = next
+	}
+}
+
+// clientAddr returns the address a request was made from. Requests from trusted proxies were made from the last
+// address in X-Forwarded-For which isn't itself a trusted proxy, as each proxy appends the address it was called
+// from, while clients can put what they like before them.
+func (l *Limiter) clientAddr(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+
+	if !l.trusted(addr) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+
+		addr = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+
+	return addr
+}
+
+// trusted reports whether an address is that of a trusted proxy.
+func (l *Limiter) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range l.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
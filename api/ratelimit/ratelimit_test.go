@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/tokenbucket"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.1,::1 ,")
+	if err != nil {
+		t.Fatalf("parsing proxies: %s", err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.168.1.1/32", "::1/128"}
+	if len(proxies) != len(want) {
+		t.Fatalf("got proxies %v, want %v", proxies, want)
+	}
+	for i := range want {
+		if proxies[i].String() != want[i] {
+			t.Errorf("got proxy %s, want %s", proxies[i], want[i])
+		}
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/8,proxy.local"); err == nil {
+		t.Error("parsed a hostname as a proxy")
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parsing proxies: %s", err)
+	}
+
+	tests := map[string]struct {
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		"direct":                    {"203.0.113.1:1234", nil, "203.0.113.1"},
+		"untrusted forwarding":      {"203.0.113.1:1234", []string{"198.51.100.1"}, "203.0.113.1"},
+		"trusted proxy":             {"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		"trusted proxy chain":       {"10.0.0.1:1234", []string{"198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		"spoofed by the client":     {"10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.1"}, "198.51.100.1"},
+		"across headers":            {"10.0.0.1:1234", []string{"192.0.2.1", "198.51.100.1"}, "198.51.100.1"},
+		"trusted proxy unforwarded": {"10.0.0.1:1234", nil, "10.0.0.1"},
+		"only trusted proxies":      {"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+	}
+
+	l := NewLimiter(tokenbucket.Limit{}, nil, proxies)
+	for name, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/races", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+
+		if got := l.clientAddr(r); got != test.want {
+			t.Errorf("%s: got %s, want %s", name, got, test.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var rules Rules
+	if err := rules.Set("POST /v1/list-races=1/m"); err != nil {
+		t.Fatalf("setting rule: %s", err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewLimiter(tokenbucket.Limit{Requests: 2, Period: time.Second}, rules, nil).Handler(next)
+
+	serve := func(method, target, remoteAddr, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = remoteAddr
+		if key != "" {
+			r.Header.Set(APIKeyHeader, key)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := serve(http.MethodPost, "/v1/list-races", "203.0.113.1:1234", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request got %d", w.Code)
+	}
+	headers := map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "1;w=60",
+	}
+	for header, want := range headers {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("got %s %q, want %q", header, got, want)
+		}
+	}
+
+	w = serve(http.MethodPost, "/v1/list-races", "203.0.113.1:1234", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("request beyond the limit got %d, want 429", w.Code)
+	}
+
+	// Other clients, and other routes, have buckets of their own.
+	if w := serve(http.MethodPost, "/v1/list-races", "203.0.113.2:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("other client got %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/v1/races", "203.0.113.1:1234", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("other route got %d under a limit of %s", w.Code, w.Header().Get("RateLimit-Limit"))
+	}
+
+	// Requests with a key must be within the limits of both their key and their address.
+	if w := serve(http.MethodPost, "/v1/list-races", "203.0.113.3:1234", "affiliate"); w.Code != http.StatusOK {
+		t.Errorf("keyed request got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/v1/list-races", "203.0.113.4:1234", "affiliate"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("key beyond its limit got %d, want 429", w.Code)
+	}
+}
+
+func TestTakeSpendsTheAddressFirst(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := tokenbucket.Limit{Requests: 2, Period: time.Minute}
+	l := NewLimiter(limit, nil, nil)
+
+	// Keys made up by a client only get buckets while its address has tokens to spend.
+	for i := 0; i < 10; i++ {
+		allowed, _, _, _ := l.take("default", []string{"addr:203.0.113.1", fmt.Sprintf("key:%d", i)}, limit, now)
+		if allowed != (i < 2) {
+			t.Errorf("request %d allowed is %t", i, allowed)
+		}
+	}
+	if len(l.buckets) != 3 || l.lru.Len() != 3 {
+		t.Errorf("made %d buckets, want 3", len(l.buckets))
+	}
+
+	// Requests refused by their key still count against their address, and are reported by the emptiest bucket.
+	l.take("default", []string{"addr:203.0.113.2", "key:shared"}, limit, now)
+	l.take("default", []string{"addr:203.0.113.3", "key:shared"}, limit, now)
+
+	allowed, remaining, _, retryAfter := l.take("default", []string{"addr:203.0.113.4", "key:shared"}, limit, now)
+	if allowed || remaining != 0 || retryAfter != 30*time.Second {
+		t.Errorf("key beyond its limit got allowed %t with %d remaining, retrying after %s", allowed, remaining, retryAfter)
+	}
+	if tokens := l.buckets[bucketKey{"default", "addr:203.0.113.4"}].Value.(*bucketEntry).bucket.Tokens(); tokens != 1 {
+		t.Errorf("address refused by its key has %v tokens, want 1", tokens)
+	}
+}
+
+func TestBucketsAreCapped(t *testing.T) {
+	now := time.Now()
+	limit := tokenbucket.Limit{Requests: 2, Period: time.Second}
+	l := NewLimiter(limit, nil, nil)
+	l.maxBuckets = 2
+
+	for _, client := range []string{"addr:a", "addr:b", "addr:a", "addr:c"} {
+		l.take("default", []string{client}, limit, now)
+	}
+
+	// The least recently used bucket makes way for new ones.
+	if len(l.buckets) != 2 || l.lru.Len() != 2 {
+		t.Fatalf("kept %d buckets, want 2", len(l.buckets))
+	}
+	for client, want := range map[string]bool{"addr:a": true, "addr:b": false, "addr:c": true} {
+		if _, ok := l.buckets[bucketKey{"default", client}]; ok != want {
+			t.Errorf("bucket of %s kept is %t, want %t", client, ok, want)
+		}
+	}
+
+	// Buckets which have refilled are swept away.
+	l.take("default", []string{"addr:c"}, limit, now.Add(sweepInterval+time.Second))
+	if len(l.buckets) != 1 || l.lru.Len() != 1 {
+		t.Errorf("kept %d buckets after sweeping, want 1", len(l.buckets))
+	}
+}
@@ -0,0 +1,160 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Breaker is a circuit breaker around an upstream. Once enough calls in a row find the upstream unavailable, the
+// breaker opens and calls fail fast for a cooldown, telling callers when to retry. After the cooldown a single call
+// is let through to try the upstream again, closing the breaker should it succeed.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreaker creates a breaker for the named upstream, opening after threshold calls in a row fail.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// DialOptions returns the options wrapping calls made through a connection in the breaker.
+func (b *Breaker) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(b.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(b.streamInterceptor),
+	}
+}
+
+func (b *Breaker) unaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	b.record(ctx, err)
+
+	return err
+}
+
+func (b *Breaker) streamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		b.record(ctx, err)
+		return nil, err
+	}
+
+	return &breakerStream{ClientStream: stream, breaker: b, ctx: ctx}, nil
+}
+
+// allow returns an error for calls to fail fast with while the breaker is open.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		st, err := status.New(codes.Unavailable, b.name+" is unavailable").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(b.openUntil.Sub(now)),
+		})
+		if err != nil {
+			return status.Error(codes.Unavailable, b.name+" is unavailable")
+		}
+
+		return st.Err()
+	}
+
+	// This call tries the upstream again, with the rest failing fast for another cooldown unless it succeeds.
+	b.openUntil = now.Add(b.cooldown)
+
+	return nil
+}
+
+// record records the outcome of a call made through the breaker.
+func (b *Breaker) record(ctx context.Context, err error) {
+	failed := false
+	switch status.Code(err) {
+	case codes.Unavailable:
+		failed = true
+	case codes.DeadlineExceeded:
+		// Calls the caller gave up on say nothing of the upstream.
+		failed = ctx.Err() == nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		if b.failures >= b.threshold {
+			log.Printf("closing circuit breaker for %s\n", b.name)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures == b.threshold {
+		log.Printf("opening circuit breaker for %s after %d failures: %s\n", b.name, b.failures, err)
+	}
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// breakerStream records the outcome of a stream once its first message is received, and any error it ends with.
+type breakerStream struct {
+	grpc.ClientStream
+	breaker  *Breaker
+	ctx      context.Context
+	received bool
+}
+
+func (s *breakerStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	switch {
+	case err != nil && err != io.EOF:
+		s.breaker.record(s.ctx, err)
+	case !s.received:
+		s.breaker.record(s.ctx, nil)
+	}
+	s.received = true
+
+	return err
+}
@@ -0,0 +1,174 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/api/problem"
+)
+
+// step is a call made through a breaker.
+type step struct {
+	// err is what the upstream answers the call with, should it reach it.
+	err error
+	// cancelled has the caller give up on the call.
+	cancelled bool
+	// cooled lets the breaker's cooldown pass before the call.
+	cooled bool
+	// reached is whether the call should reach the upstream, rather than failing fast.
+	reached bool
+}
+
+// cool lets the cooldown of an open breaker pass.
+func cool(b *Breaker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openUntil = time.Now()
+}
+
+func TestBreaker(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	deadline := status.Error(codes.DeadlineExceeded, "deadline exceeded")
+
+	tests := map[string][]step{
+		"opening after the threshold": {
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{reached: false},
+			{reached: false},
+		},
+		"counting failures in a row": {
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{reached: true},
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{reached: true},
+		},
+		"ignoring other errors": {
+			{err: status.Error(codes.NotFound, "race not found"), reached: true},
+			{err: status.Error(codes.Internal, "oops"), reached: true},
+			{err: status.Error(codes.ResourceExhausted, "slow down"), reached: true},
+			{reached: true},
+		},
+		"upstream deadlines": {
+			{err: deadline, reached: true},
+			{err: deadline, reached: true},
+			{err: deadline, reached: true},
+			{reached: false},
+		},
+		"caller deadlines": {
+			{err: deadline, cancelled: true, reached: true},
+			{err: deadline, cancelled: true, reached: true},
+			{err: deadline, cancelled: true, reached: true},
+			{reached: true},
+		},
+		"half open probe succeeding": {
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{cooled: true, reached: true},
+			{reached: true},
+			{err: unavailable, reached: true},
+			{reached: true},
+		},
+		"half open probe failing": {
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{err: unavailable, reached: true},
+			{cooled: true, err: unavailable, reached: true},
+			{reached: false},
+			{cooled: true, reached: true},
+			{reached: true},
+		},
+	}
+
+	for name, steps := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := NewBreaker("racing", 3, time.Minute)
+
+			for i, step := range steps {
+				if step.cooled {
+					cool(b)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				if step.cancelled {
+					cancel()
+				}
+
+				reached := false
+				err := b.unaryInterceptor(ctx, "/racing.Racing/GetRace", nil, nil, nil,
+					func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+						reached = true
+						return step.err
+					},
+				)
+				cancel()
+
+				if reached != step.reached {
+					t.Fatalf("call %d reached the upstream is %t, want %t", i+1, reached, step.reached)
+				}
+				if !reached && status.Code(err) != codes.Unavailable {
+					t.Errorf("call %d failed fast with %v, want Unavailable", i+1, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerProbesOnce(t *testing.T) {
+	b := NewBreaker("racing", 1, time.Minute)
+	b.record(context.Background(), status.Error(codes.Unavailable, "connection refused"))
+	cool(b)
+
+	// While the probe is yet to come back, the rest of the calls fail fast.
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe failed fast with %v", err)
+	}
+	if err := b.allow(); status.Code(err) != codes.Unavailable {
+		t.Errorf("call during the probe got %v, want Unavailable", err)
+	}
+}
+
+func TestBreakerFailingFast(t *testing.T) {
+	b := NewBreaker("racing", 1, time.Minute)
+	b.record(context.Background(), status.Error(codes.Unavailable, "connection refused"))
+
+	st := status.Convert(b.allow())
+	if st.Code() != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", st.Err())
+	}
+
+	var retryDelay time.Duration
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryDelay = info.RetryDelay.AsDuration()
+		}
+	}
+	if retryDelay <= 59*time.Second || retryDelay > time.Minute {
+		t.Errorf("told to retry in %s, want the rest of the cooldown", retryDelay)
+	}
+
+	// Clients are told when to retry.
+	r := httptest.NewRequest(http.MethodGet, "/v1/races/1", nil)
+	w := httptest.NewRecorder()
+	problem.Write(w, problem.FromStatus(st, r))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("got Retry-After %q, want 60", got)
+	}
+}
@@ -0,0 +1,183 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Policy is how calls to the services of an upstream are timed out and retried.
+type Policy struct {
+	// Services are the full names of the services served by the upstream, such as racing.Racing.
+	Services []string
+	// Timeout is how long unary calls may take, unless given a timeout of their own. Streaming calls are only timed
+	// out when given a timeout of their own.
+	Timeout time.Duration
+	// Timeouts gives services, or single methods of them, timeouts of their own.
+	Timeouts Timeouts
+	// RetryAttempts is how many times idempotent calls are attempted while the upstream is unavailable, at most.
+	// Calls are idempotent when they're exposed through a GET. A single attempt turns retries off.
+	RetryAttempts int
+}
+
+// serviceConfig is a gRPC service config, of which only the parts used are declared.
+//
+// See: https://github.com/grpc/grpc/blob/master/doc/service_config.md
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	HealthCheckConfig   healthCheckConfig     `json:"healthCheckConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	Timeout     string       `json:"timeout,omitempty"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// serviceConfig returns the service config applying the policy. Requests are balanced round robin across the
+// addresses of the upstream, skipping any which don't report themselves as serving through the standard gRPC
+// health checking service.
+func (p Policy) serviceConfig() (string, error) {
+	config := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{"round_robin": {}}},
+	}
+
+	for _, service := range p.Services {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+		if err != nil {
+			return "", fmt.Errorf("finding service %s: %w", service, err)
+		}
+
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return "", fmt.Errorf("%s is not a service", service)
+		}
+
+		methods := sd.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			if mc, ok := p.methodConfig(methods.Get(i)); ok {
+				config.MethodConfig = append(config.MethodConfig, mc)
+			}
+		}
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// methodConfig returns the config of a method, if it's timed out or retried.
+func (p Policy) methodConfig(md protoreflect.MethodDescriptor) (methodConfig, bool) {
+	service := string(md.Parent().FullName())
+	name := methodName{Service: service, Method: string(md.Name())}
+
+	timeout, ok := p.Timeouts[service+"/"+name.Method]
+	if !ok {
+		timeout, ok = p.Timeouts[service]
+	}
+	if !ok && !md.IsStreamingClient() && !md.IsStreamingServer() {
+		timeout = p.Timeout
+	}
+
+	mc := methodConfig{Name: []methodName{name}}
+	if timeout > 0 {
+		mc.Timeout = seconds(timeout)
+	}
+	if p.RetryAttempts > 1 && isIdempotent(md) {
+		mc.RetryPolicy = &retryPolicy{
+			MaxAttempts:          p.RetryAttempts,
+			InitialBackoff:       "0.1s",
+			MaxBackoff:           "1s",
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+	}
+
+	return mc, mc.Timeout != "" || mc.RetryPolicy != nil
+}
+
+// isIdempotent reports whether a method is exposed through a GET, and so is safe to retry.
+func isIdempotent(md protoreflect.MethodDescriptor) bool {
+	rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return false
+	}
+
+	if rule.GetGet() != "" {
+		return true
+	}
+	for _, binding := range rule.GetAdditionalBindings() {
+		if binding.GetGet() != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// seconds formats a duration as the service config expects, such as 2.5s.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// Timeouts maps services, or methods of them such as racing.Racing/ListRaces, onto how long calls to them may take.
+// It's a flag.Value, set with name=duration.
+type Timeouts map[string]time.Duration
+
+func (t Timeouts) String() string {
+	timeouts := make([]string, 0, len(t))
+	for name, timeout := range t {
+		timeouts = append(timeouts, name+"="+timeout.String())
+	}
+	sort.Strings(timeouts)
+
+	return strings.Join(timeouts, " ")
+}
+
+func (t Timeouts) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return fmt.Errorf("expected name=duration, got %q", value)
+	}
+
+	timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("timeout of %s must be positive", parts[0])
+	}
+
+	t[strings.TrimSpace(parts[0])] = timeout
+
+	return nil
+}
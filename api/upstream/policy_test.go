@@ -0,0 +1,117 @@
+package upstream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	_ "git.neds.sh/matty/entain/api/proto/betting" // Registers the services the policies name.
+	_ "git.neds.sh/matty/entain/api/proto/racing"
+)
+
+func TestServiceConfig(t *testing.T) {
+	policy := Policy{
+		Services: []string{"racing.Racing", "racing.Pricing", "betting.Betting"},
+		Timeout:  10 * time.Second,
+		Timeouts: Timeouts{
+			"racing.Racing/ListRaces": 2 * time.Second,
+			"racing.Pricing":          1500 * time.Millisecond,
+		},
+		RetryAttempts: 3,
+	}
+
+	tests := map[string]struct {
+		timeout string
+		retried bool
+	}{
+		"racing.Racing/ListRaces":      {"2s", true},
+		"racing.Racing/GetRace":        {"10s", true},
+		"racing.Racing/ListRunners":    {"10s", true},
+		"racing.Racing/ExportRaces":    {"", true},
+		"racing.Racing/TransitionRace": {"10s", false},
+		"racing.Racing/ImportRaceCard": {"10s", false},
+		"racing.Pricing/GetPrices":     {"1.5s", true},
+		"racing.Pricing/WatchPrices":   {"1.5s", true},
+		"racing.Pricing/PublishPrices": {"1.5s", false},
+		"betting.Betting/PlaceBet":     {"10s", false},
+	}
+
+	methods := parseServiceConfig(t, policy)
+	for name, test := range tests {
+		mc, ok := methods[name]
+		if !ok {
+			t.Errorf("%s: not configured", name)
+			continue
+		}
+
+		if mc.Timeout != test.timeout {
+			t.Errorf("%s: got timeout %q, want %q", name, mc.Timeout, test.timeout)
+		}
+		if retried := mc.RetryPolicy != nil; retried != test.retried {
+			t.Errorf("%s: retried is %t, want %t", name, retried, test.retried)
+		} else if retried && (mc.RetryPolicy.MaxAttempts != 3 || len(mc.RetryPolicy.RetryableStatusCodes) != 1 || mc.RetryPolicy.RetryableStatusCodes[0] != "UNAVAILABLE") {
+			t.Errorf("%s: got retry policy %+v", name, mc.RetryPolicy)
+		}
+	}
+
+	// A single attempt turns retries off.
+	policy.RetryAttempts = 1
+	for name, mc := range parseServiceConfig(t, policy) {
+		if mc.RetryPolicy != nil {
+			t.Errorf("%s: retried with retries off", name)
+		}
+	}
+
+	if _, err := (Policy{Services: []string{"racing.Nope"}}).serviceConfig(); err == nil {
+		t.Error("configured an unknown service")
+	}
+}
+
+// parseServiceConfig returns the method configs of the service config applying a policy, by method.
+func parseServiceConfig(t *testing.T, policy Policy) map[string]methodConfig {
+	t.Helper()
+
+	buf, err := policy.serviceConfig()
+	if err != nil {
+		t.Fatalf("building service config: %s", err)
+	}
+
+	var config serviceConfig
+	if err := json.Unmarshal([]byte(buf), &config); err != nil {
+		t.Fatalf("parsing service config: %s", err)
+	}
+
+	if len(config.LoadBalancingConfig) != 1 {
+		t.Errorf("got load balancing config %v, want round robin", config.LoadBalancingConfig)
+	} else if _, ok := config.LoadBalancingConfig[0]["round_robin"]; !ok {
+		t.Errorf("got load balancing config %v, want round robin", config.LoadBalancingConfig)
+	}
+
+	methods := make(map[string]methodConfig)
+	for _, mc := range config.MethodConfig {
+		for _, name := range mc.Name {
+			methods[name.Service+"/"+name.Method] = mc
+		}
+	}
+
+	return methods
+}
+
+func TestTimeoutsSet(t *testing.T) {
+	timeouts := Timeouts{}
+	for _, value := range []string{"racing.Racing=5s", " racing.Racing/ListRaces = 2s "} {
+		if err := timeouts.Set(value); err != nil {
+			t.Fatalf("setting %q: %s", value, err)
+		}
+	}
+
+	if timeouts["racing.Racing"] != 5*time.Second || timeouts["racing.Racing/ListRaces"] != 2*time.Second {
+		t.Errorf("got timeouts %s", timeouts)
+	}
+
+	for _, value := range []string{"racing.Racing", "=5s", "racing.Racing=soon", "racing.Racing=0s", "racing.Racing=-1s"} {
+		if err := timeouts.Set(value); err == nil {
+			t.Errorf("set %q, want an error", value)
+		}
+	}
+}
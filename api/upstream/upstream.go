@@ -0,0 +1,96 @@
+// Package upstream dials the gRPC services the gateway forwards requests on to, balancing requests across each
+// of their replicas.
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	_ "google.golang.org/grpc/health" // Registers the client side health checks turned on by the service config.
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// connectParams reconnect to an upstream promptly once it's back, rather than backing off for minutes.
+var connectParams = grpc.ConnectParams{
+	Backoff: backoff.Config{
+		BaseDelay:  100 * time.Millisecond,
+		Multiplier: 1.6,
+		Jitter:     0.2,
+		MaxDelay:   5 * time.Second,
+	},
+	MinConnectTimeout: 5 * time.Second,
+}
+
+// listSchemes counts the resolvers built for lists of addresses, so each is given a scheme of its own.
+var listSchemes int32
+
+// Dial dials an upstream, which is either a comma separated list of addresses, or a single gRPC target. Targets can
+// name a resolver, so dns:///racing:9000 balances across every address racing resolves to, and keeps doing so as
+// they change. Calls are timed out and retried as the policy says.
+func Dial(ctx context.Context, target string, policy Policy, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	config, err := policy.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, grpc.WithDefaultServiceConfig(config), grpc.WithConnectParams(connectParams))
+
+	if addrs := splitList(target); len(addrs) > 1 {
+		r := manual.NewBuilderWithScheme(fmt.Sprintf("upstream%d", atomic.AddInt32(&listSchemes, 1)))
+
+		state := resolver.State{}
+		for _, addr := range addrs {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		r.InitialState(state)
+
+		opts = append(opts, grpc.WithResolvers(r))
+		target = r.Scheme() + ":///" + target
+	}
+
+	return grpc.DialContext(ctx, target, opts...)
+}
+
+// splitList splits a comma separated list of addresses, dropping any left empty.
+func splitList(target string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(target, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// Routes maps the full names of services, such as racing.Pricing, onto the upstream serving them. It's a flag.Value,
+// set with service=upstream.
+type Routes map[string]string
+
+func (r Routes) String() string {
+	routes := make([]string, 0, len(r))
+	for service, target := range r {
+		routes = append(routes, service+"="+target)
+	}
+	sort.Strings(routes)
+
+	return strings.Join(routes, " ")
+}
+
+func (r Routes) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("expected service=upstream, got %q", value)
+	}
+
+	r[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/mattn/go-sqlite3"
+
+	"git.neds.sh/matty/entain/betting/proto/betting"
+)
+
+// BetsRepo provides repository access to bets.
+type BetsRepo interface {
+	// Init will initialise our bets repository.
+	Init() error
+
+	// GetByIdempotencyKey will return the bet placed with the given idempotency key.
+	GetByIdempotencyKey(key string) (*betting.Bet, error)
+
+	// Create will store a new bet, returning it with its ID.
+	Create(bet *betting.Bet) (*betting.Bet, error)
+}
+
+type betsRepo struct {
+	db   *sql.DB
+	init sync.Once
+}
+
+// NewBetsRepo creates a new bets repository.
+func NewBetsRepo(db *sql.DB) BetsRepo {
+	return &betsRepo{db: db}
+}
+
+// Init prepares the bets repository.
+func (r *betsRepo) Init() error {
+	var err error
+
+	r.init.Do(func() {
+		err = migrate(r.db)
+	})
+
+	return err
+}
+
+func (r *betsRepo) GetByIdempotencyKey(key string) (*betting.Bet, error) {
+	var (
+		bet      betting.Bet
+		placedAt time.Time
+	)
+
+	err := r.db.QueryRow(getBetQueries()[betGetByKey], key).
+		Scan(&bet.Id, &bet.IdempotencyKey, &bet.RaceId, &bet.RunnerNumber, &bet.StakeCents, &placedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bet.PlacedAt, err = ptypes.TimestampProto(placedAt); err != nil {
+		return nil, err
+	}
+
+	return &bet, nil
+}
+
+func (r *betsRepo) Create(bet *betting.Bet) (*betting.Bet, error) {
+	placedAt, err := ptypes.Timestamp(bet.PlacedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.db.Exec(getBetQueries()[betInsert], bet.IdempotencyKey, bet.RaceId, bet.RunnerNumber, bet.StakeCents, placedAt)
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return nil, ErrDuplicateKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	created := proto.Clone(bet).(*betting.Bet)
+	if created.Id, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
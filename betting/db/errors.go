@@ -0,0 +1,13 @@
+package db
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrDuplicateKey is returned when storing a bet whose idempotency key has already been used.
+	ErrDuplicateKey = errors.New("duplicate idempotency key")
+)
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations bring the database schema up to date. Each is applied once, in order, with progress tracked through
+// SQLite's user_version pragma, so new migrations must only ever be appended.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS bets (id INTEGER PRIMARY KEY AUTOINCREMENT, idempotency_key TEXT NOT NULL UNIQUE, race_id INTEGER NOT NULL, runner_number INTEGER NOT NULL, stake_cents INTEGER NOT NULL, placed_at DATETIME NOT NULL)`,
+}
+
+// migrate applies any migrations the database has not yet seen.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i); err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, i int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migrations[i]); err != nil {
+		return err
+	}
+
+	// Pragmas don't accept bound parameters.
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,25 @@
+package db
+
+const (
+	betGetByKey = "get_by_key"
+	betInsert   = "insert"
+)
+
+func getBetQueries() map[string]string {
+	return map[string]string{
+		betGetByKey: `
+			SELECT 
+				id, 
+				idempotency_key, 
+				race_id, 
+				runner_number, 
+				stake_cents, 
+				placed_at 
+			FROM bets 
+			WHERE idempotency_key = ?
+		`,
+		betInsert: `
+			INSERT INTO bets(idempotency_key, race_id, runner_number, stake_cents, placed_at) VALUES (?,?,?,?,?)
+		`,
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"net"
+
+	"git.neds.sh/matty/entain/betting/db"
+	"git.neds.sh/matty/entain/betting/proto/betting"
+	"git.neds.sh/matty/entain/betting/proto/racing"
+	"git.neds.sh/matty/entain/betting/service"
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	grpcEndpoint   = flag.String("grpc-endpoint", "localhost:9001", "gRPC server endpoint")
+	racingEndpoint = flag.String("racing-endpoint", "localhost:9000", "Racing gRPC server endpoint")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatalf("failed running grpc server: %s\n", err)
+	}
+}
+
+func run() error {
+	conn, err := net.Listen("tcp", *grpcEndpoint)
+	if err != nil {
+		return err
+	}
+
+	bettingDB, err := sql.Open("sqlite3", "./db/betting.db")
+	if err != nil {
+		return err
+	}
+
+	betsRepo := db.NewBetsRepo(bettingDB)
+	if err := betsRepo.Init(); err != nil {
+		return err
+	}
+
+	racingConn, err := grpc.Dial(*racingEndpoint, grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer racingConn.Close()
+
+	grpcServer := grpc.NewServer()
+
+	betting.RegisterBettingServer(
+		grpcServer,
+		service.NewBettingService(
+			betsRepo,
+			racing.NewRacingClient(racingConn),
+		),
+	)
+
+	// The gateway balances requests across replicas which report themselves as serving.
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	log.Printf("gRPC server listening on: %s\n", *grpcEndpoint)
+
+	if err := grpcServer.Serve(conn); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package betting
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BettingClient is the client API for Betting service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BettingClient interface {
+	// PlaceBet will place a bet on a runner in an open race.
+	PlaceBet(ctx context.Context, in *PlaceBetRequest, opts ...grpc.CallOption) (*Bet, error)
+}
+
+type bettingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBettingClient(cc grpc.ClientConnInterface) BettingClient {
+	return &bettingClient{cc}
+}
+
+func (c *bettingClient) PlaceBet(ctx context.Context, in *PlaceBetRequest, opts ...grpc.CallOption) (*Bet, error) {
+	out := new(Bet)
+	err := c.cc.Invoke(ctx, "/betting.Betting/PlaceBet", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BettingServer is the server API for Betting service.
+// All implementations should embed UnimplementedBettingServer
+// for forward compatibility
+type BettingServer interface {
+	// PlaceBet will place a bet on a runner in an open race.
+	PlaceBet(context.Context, *PlaceBetRequest) (*Bet, error)
+}
+
+// UnimplementedBettingServer should be embedded to have forward compatible implementations.
+type UnimplementedBettingServer struct {
+}
+
+func (UnimplementedBettingServer) PlaceBet(context.Context, *PlaceBetRequest) (*Bet, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlaceBet not implemented")
+}
+
+// UnsafeBettingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BettingServer will
+// result in compilation errors.
+type UnsafeBettingServer interface {
+	mustEmbedUnimplementedBettingServer()
+}
+
+func RegisterBettingServer(s grpc.ServiceRegistrar, srv BettingServer) {
+	s.RegisterService(&Betting_ServiceDesc, srv)
+}
+
+func _Betting_PlaceBet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlaceBetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BettingServer).PlaceBet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/betting.Betting/PlaceBet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BettingServer).PlaceBet(ctx, req.(*PlaceBetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Betting_ServiceDesc is the grpc.ServiceDesc for Betting service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Betting_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "betting.Betting",
+	HandlerType: (*BettingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PlaceBet",
+			Handler:    _Betting_PlaceBet_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "betting/betting.proto",
+}
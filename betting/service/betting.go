@@ -0,0 +1,196 @@
+package service
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/betting/db"
+	"git.neds.sh/matty/entain/betting/proto/betting"
+	"git.neds.sh/matty/entain/betting/proto/racing"
+)
+
+const (
+	// maxIdempotencyKeyLength is the longest idempotency key a bet may be placed with.
+	maxIdempotencyKeyLength = 128
+	// raceCheckTimeout bounds how long placing a bet waits on the racing service.
+	raceCheckTimeout = 2 * time.Second
+	// brandMetadataKey is the metadata naming the brand a bet is placed through, which races must be shown on.
+	brandMetadataKey = "x-brand"
+	// jurisdictionMetadataKey is the metadata naming the jurisdiction a bet is placed from, which may restrict races.
+	jurisdictionMetadataKey = "x-jurisdiction"
+)
+
+type Betting interface {
+	// PlaceBet will place a bet on a runner in an open race.
+	PlaceBet(ctx context.Context, in *betting.PlaceBetRequest) (*betting.Bet, error)
+}
+
+// bettingService implements the Betting interface.
+type bettingService struct {
+	betsRepo     db.BetsRepo
+	racingClient racing.RacingClient
+}
+
+// NewBettingService instantiates and returns a new bettingService.
+func NewBettingService(betsRepo db.BetsRepo, racingClient racing.RacingClient) Betting {
+	return &bettingService{betsRepo, racingClient}
+}
+
+func (s *bettingService) PlaceBet(ctx context.Context, in *betting.PlaceBetRequest) (*betting.Bet, error) {
+	if err := validatePlaceBet(in); err != nil {
+		return nil, err
+	}
+
+	// A retried placement returns the bet originally placed, even if the race has since closed.
+	if bet, err := s.existingBet(in); bet != nil || err != nil {
+		return bet, err
+	}
+
+	if err := s.checkBettable(ctx, in.RaceId, in.RunnerNumber); err != nil {
+		return nil, err
+	}
+
+	bet, err := s.betsRepo.Create(&betting.Bet{
+		IdempotencyKey: in.IdempotencyKey,
+		RaceId:         in.RaceId,
+		RunnerNumber:   in.RunnerNumber,
+		StakeCents:     in.StakeCents,
+		PlacedAt:       ptypes.TimestampNow(),
+	})
+	if err == db.ErrDuplicateKey {
+		// The same bet was placed concurrently, so return whichever placement won.
+		return s.existingBet(in)
+	}
+	if err != nil {
+		log.Printf("failed storing bet: %s\n", err)
+		return nil, status.Error(codes.Internal, "failed storing bet")
+	}
+
+	return bet, nil
+}
+
+func validatePlaceBet(in *betting.PlaceBetRequest) error {
+	switch {
+	case in.IdempotencyKey == "":
+		return invalidArgument("idempotency_key", "must not be empty")
+	case len(in.IdempotencyKey) > maxIdempotencyKeyLength:
+		return invalidArgument("idempotency_key", "must not be longer than "+strconv.Itoa(maxIdempotencyKeyLength)+" characters")
+	case in.RaceId <= 0:
+		return invalidArgument("race_id", "must be positive")
+	case in.RunnerNumber <= 0:
+		return invalidArgument("runner_number", "must be positive")
+	case in.StakeCents <= 0:
+		return invalidArgument("stake_cents", "must be positive")
+	}
+
+	return nil
+}
+
+// existingBet returns the bet already placed with the request's idempotency key, if any, so long as it was placed
+// with the same details.
+func (s *bettingService) existingBet(in *betting.PlaceBetRequest) (*betting.Bet, error) {
+	bet, err := s.betsRepo.GetByIdempotencyKey(in.IdempotencyKey)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed reading bet: %s\n", err)
+		return nil, status.Error(codes.Internal, "failed reading bet")
+	}
+
+	if bet.RaceId != in.RaceId || bet.RunnerNumber != in.RunnerNumber || bet.StakeCents != in.StakeCents {
+		return nil, status.Error(codes.AlreadyExists, "idempotency_key has already been used to place a different bet")
+	}
+
+	return bet, nil
+}
+
+// checkBettable asks the racing service whether the race exists, is visible and open for betting, and whether the
+// runner is in it and yet to be scratched.
+func (s *bettingService) checkBettable(ctx context.Context, raceID, runnerNumber int64) error {
+	ctx, cancel := context.WithTimeout(ctx, raceCheckTimeout)
+	defer cancel()
+
+	// Races are checked for the brand the bet is placed through and the jurisdiction it's placed from, so bets can't
+	// be placed on races either doesn't allow.
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range []string{brandMetadataKey, jurisdictionMetadataKey} {
+			if values := md.Get(key); len(values) > 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, key, values[0])
+			}
+		}
+	}
+
+	if err := s.checkRaceOpen(ctx, raceID); err != nil {
+		return err
+	}
+
+	return s.checkRunner(ctx, raceID, runnerNumber)
+}
+
+// checkRaceOpen checks the race exists, is visible and open for betting.
+func (s *bettingService) checkRaceOpen(ctx context.Context, raceID int64) error {
+	race, err := s.racingClient.GetRace(ctx, &racing.GetRaceRequest{
+		Id:       raceID,
+		ReadMask: &field_mask.FieldMask{Paths: []string{"visible", "status", "restrictions"}},
+	})
+	if err != nil {
+		return racingError(err, raceID)
+	}
+
+	subject := "races/" + strconv.FormatInt(raceID, 10)
+
+	switch {
+	case !race.Visible:
+		return raceNotBettable(subject, "race is not visible")
+	case race.Status != racing.RaceStatus_RACE_STATUS_OPEN:
+		return raceNotBettable(subject, "race is not open")
+	case len(race.Restrictions) > 0:
+		return raceRestricted(subject, race.Restrictions)
+	}
+
+	return nil
+}
+
+// checkRunner checks the runner is in the race, and hasn't been scratched.
+func (s *bettingService) checkRunner(ctx context.Context, raceID, runnerNumber int64) error {
+	resp, err := s.racingClient.ListRunners(ctx, &racing.ListRunnersRequest{RaceId: raceID})
+	if err != nil {
+		return racingError(err, raceID)
+	}
+
+	for _, runner := range resp.Runners {
+		if runner.Number != runnerNumber {
+			continue
+		}
+
+		if runner.Scratched {
+			return runnerScratched("races/" + strconv.FormatInt(raceID, 10) + "/runners/" + strconv.FormatInt(runnerNumber, 10))
+		}
+
+		return nil
+	}
+
+	return invalidArgument("runner_number", "race has no runner "+strconv.FormatInt(runnerNumber, 10))
+}
+
+// racingError returns the error a failed call to the racing service about a race is reported with.
+func racingError(err error, raceID int64) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return status.Error(codes.NotFound, "race not found")
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return status.Error(codes.Unavailable, "racing service unavailable")
+	}
+
+	log.Printf("failed checking race %d: %s\n", raceID, err)
+	return status.Error(codes.Internal, "failed checking race")
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/betting/db"
+	"git.neds.sh/matty/entain/betting/proto/betting"
+	"git.neds.sh/matty/entain/betting/proto/racing"
+)
+
+// stubRacing answers the calls betting makes of racing from the races and runners it holds, recording the metadata
+// of the calls made.
+type stubRacing struct {
+	racing.RacingClient
+
+	races   map[int64]*racing.Race
+	runners map[int64][]*racing.Runner
+	// err fails every call when set.
+	err   error
+	calls int
+	md    metadata.MD
+}
+
+func (s *stubRacing) GetRace(ctx context.Context, in *racing.GetRaceRequest, _ ...grpc.CallOption) (*racing.Race, error) {
+	s.calls++
+	s.md, _ = metadata.FromOutgoingContext(ctx)
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	race, ok := s.races[in.Id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "race not found")
+	}
+
+	return race, nil
+}
+
+func (s *stubRacing) ListRunners(ctx context.Context, in *racing.ListRunnersRequest, _ ...grpc.CallOption) (*racing.ListRunnersResponse, error) {
+	s.calls++
+
+	if _, ok := s.races[in.RaceId]; !ok {
+		return nil, status.Error(codes.NotFound, "race not found")
+	}
+
+	return &racing.ListRunnersResponse{Runners: s.runners[in.RaceId]}, nil
+}
+
+// newTestBettingService creates a betting service over a scratch database, checking bets against a stub of racing
+// holding an open race 1 with runners 1 and 2, of which 2 is scratched.
+func newTestBettingService(t *testing.T) (Betting, *stubRacing) {
+	t.Helper()
+
+	bettingDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "betting.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { bettingDB.Close() })
+
+	betsRepo := db.NewBetsRepo(bettingDB)
+	if err := betsRepo.Init(); err != nil {
+		t.Fatalf("initialising bets: %s", err)
+	}
+
+	stub := &stubRacing{
+		races: map[int64]*racing.Race{
+			1: {Id: 1, Visible: true, Status: racing.RaceStatus_RACE_STATUS_OPEN},
+		},
+		runners: map[int64][]*racing.Runner{
+			1: {{Number: 1, Name: "Vow And Declare"}, {Number: 2, Name: "Verry Elleegant", Scratched: true}},
+		},
+	}
+
+	return NewBettingService(betsRepo, stub), stub
+}
+
+// reason returns the ErrorInfo reason of an error, if it has one.
+func reason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	return ""
+}
+
+func TestPlaceBet(t *testing.T) {
+	tests := map[string]struct {
+		race       *racing.Race
+		racingErr  error
+		in         *betting.PlaceBetRequest
+		wantCode   codes.Code
+		wantReason string
+	}{
+		"open race": {
+			in:       &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode: codes.OK,
+		},
+		"no idempotency key": {
+			in:         &betting.PlaceBetRequest{RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode:   codes.InvalidArgument,
+			wantReason: "INVALID_ARGUMENT",
+		},
+		"no stake": {
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1},
+			wantCode:   codes.InvalidArgument,
+			wantReason: "INVALID_ARGUMENT",
+		},
+		"missing race": {
+			in:       &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 2, RunnerNumber: 1, StakeCents: 500},
+			wantCode: codes.NotFound,
+		},
+		"hidden race": {
+			race:       &racing.Race{Id: 1, Status: racing.RaceStatus_RACE_STATUS_OPEN},
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode:   codes.FailedPrecondition,
+			wantReason: "RACE_NOT_BETTABLE",
+		},
+		"closed race": {
+			race:       &racing.Race{Id: 1, Visible: true, Status: racing.RaceStatus_RACE_STATUS_CLOSED},
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode:   codes.FailedPrecondition,
+			wantReason: "RACE_NOT_BETTABLE",
+		},
+		"restricted race": {
+			race:       &racing.Race{Id: 1, Visible: true, Status: racing.RaceStatus_RACE_STATUS_OPEN, Restrictions: []string{"offshore"}},
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode:   codes.FailedPrecondition,
+			wantReason: "RACE_RESTRICTED",
+		},
+		"missing runner": {
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 99, StakeCents: 500},
+			wantCode:   codes.InvalidArgument,
+			wantReason: "INVALID_ARGUMENT",
+		},
+		"scratched runner": {
+			in:         &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 2, StakeCents: 500},
+			wantCode:   codes.FailedPrecondition,
+			wantReason: "RUNNER_SCRATCHED",
+		},
+		"racing unavailable": {
+			racingErr: status.Error(codes.Unavailable, "connection refused"),
+			in:        &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500},
+			wantCode:  codes.Unavailable,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, stub := newTestBettingService(t)
+			if test.race != nil {
+				stub.races[test.race.Id] = test.race
+			}
+			stub.err = test.racingErr
+
+			bet, err := s.PlaceBet(context.Background(), test.in)
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("got %v, want %s", err, test.wantCode)
+			}
+			if test.wantReason != "" && reason(err) != test.wantReason {
+				t.Errorf("got reason %q, want %q", reason(err), test.wantReason)
+			}
+
+			if err == nil && (bet.Id == 0 || bet.RunnerNumber != test.in.RunnerNumber || bet.PlacedAt == nil) {
+				t.Errorf("placed bet %v", bet)
+			}
+		})
+	}
+}
+
+func TestPlaceBetReplaysByIdempotencyKey(t *testing.T) {
+	s, stub := newTestBettingService(t)
+	in := &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500}
+
+	placed, err := s.PlaceBet(context.Background(), in)
+	if err != nil {
+		t.Fatalf("placing bet: %s", err)
+	}
+
+	// A retry is answered with the bet first placed, without asking racing again, even once the race has closed.
+	stub.races[1].Status = racing.RaceStatus_RACE_STATUS_CLOSED
+	calls := stub.calls
+
+	replayed, err := s.PlaceBet(context.Background(), in)
+	if err != nil {
+		t.Fatalf("replaying bet: %s", err)
+	}
+	if replayed.Id != placed.Id || !replayed.PlacedAt.AsTime().Equal(placed.PlacedAt.AsTime()) {
+		t.Errorf("replay got bet %v, want %v", replayed, placed)
+	}
+	if stub.calls != calls {
+		t.Errorf("replay called racing %d times", stub.calls-calls)
+	}
+
+	// Reusing the key for another bet is refused.
+	for _, other := range []*betting.PlaceBetRequest{
+		{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 2, StakeCents: 500},
+		{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 600},
+		{IdempotencyKey: "a", RaceId: 3, RunnerNumber: 1, StakeCents: 500},
+	} {
+		if _, err := s.PlaceBet(context.Background(), other); status.Code(err) != codes.AlreadyExists {
+			t.Errorf("reusing key for %v got %v, want AlreadyExists", other, err)
+		}
+	}
+}
+
+func TestPlaceBetChecksRacesForTheCaller(t *testing.T) {
+	s, stub := newTestBettingService(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		brandMetadataKey, "neds",
+		jurisdictionMetadataKey, "AU-SA",
+		"authorization", "secret",
+	))
+	if _, err := s.PlaceBet(ctx, &betting.PlaceBetRequest{IdempotencyKey: "a", RaceId: 1, RunnerNumber: 1, StakeCents: 500}); err != nil {
+		t.Fatalf("placing bet: %s", err)
+	}
+
+	// Only the brand and jurisdiction are passed on to racing.
+	if len(stub.md) != 2 || stub.md.Get(brandMetadataKey)[0] != "neds" || stub.md.Get(jurisdictionMetadataKey)[0] != "AU-SA" {
+		t.Errorf("racing was called with metadata %v", stub.md)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// domain is the ErrorInfo domain of errors raised by the betting service.
+const domain = "betting.entain"
+
+// invalidArgument returns an InvalidArgument status reporting a single invalid field.
+func invalidArgument(field, description string) error {
+	return newStatus(codes.InvalidArgument, field+": "+description, "INVALID_ARGUMENT", &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+// raceNotBettable returns a FailedPrecondition status explaining why a race can't be bet on.
+func raceNotBettable(subject, description string) error {
+	return newStatus(codes.FailedPrecondition, description, "RACE_NOT_BETTABLE", &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: "RACE_STATE", Subject: subject, Description: description}},
+	})
+}
+
+// runnerScratched returns a FailedPrecondition status explaining a runner can't be bet on, having been scratched.
+func runnerScratched(subject string) error {
+	return newStatus(codes.FailedPrecondition, "runner has been scratched", "RUNNER_SCRATCHED", &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{Type: "RUNNER_STATE", Subject: subject, Description: "runner has been scratched"}},
+	})
+}
+
+// raceRestricted returns a FailedPrecondition status giving the reasons a race can't be bet on in the jurisdiction a
+// bet is placed from.
+func raceRestricted(subject string, reasons []string) error {
+	violations := make([]*errdetails.PreconditionFailure_Violation, len(reasons))
+	for i, reason := range reasons {
+		violations[i] = &errdetails.PreconditionFailure_Violation{Type: "JURISDICTION", Subject: subject, Description: reason}
+	}
+
+	return newStatus(codes.FailedPrecondition, "race is restricted in this jurisdiction", "RACE_RESTRICTED", &errdetails.PreconditionFailure{
+		Violations: violations,
+	})
+}
+
+func newStatus(code codes.Code, message, reason string, details ...proto.Message) error {
+	st := status.New(code, message)
+
+	info := &errdetails.ErrorInfo{Reason: reason, Domain: domain}
+
+	withDetails, err := st.WithDetails(append([]proto.Message{info}, details...)...)
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,272 @@
+// Package client is a Go client for the racing service, wrapping the generated RacingClient. Races are listed
+// through an iterator fetching pages as they're needed, and calls are given a deadline and retried while racing is
+// unavailable. Tests can swap racing for the in-memory Fake.
+//
+//	conn, err := grpc.Dial("localhost:9000", grpc.WithInsecure())
+//	...
+//	races := client.NewClient(racing.NewRacingClient(conn), client.DefaultConfig)
+//
+//	it := races.ListRaces(client.WithBrand(ctx, "neds"), &racing.ListRacesRequest{FilterExpression: "visible = true"})
+//	for it.Next() {
+//		fmt.Println(it.Race().Name, client.AdvertisedStart(it.Race()))
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+const (
+	// brandMetadataKey is the metadata racing reads the brand a call is made for from.
+	brandMetadataKey = "x-brand"
+	// jurisdictionMetadataKey is the metadata racing reads the jurisdiction a call is made from from.
+	jurisdictionMetadataKey = "x-jurisdiction"
+)
+
+// Config is how calls to racing are timed out and retried.
+type Config struct {
+	// Timeout is how long a call may take across every attempt, unless its context already has a deadline. Zero
+	// leaves calls without a deadline.
+	Timeout time.Duration
+	// RetryAttempts is how many times calls are attempted while racing is unavailable, at most. Only calls which are
+	// safe to repeat are retried, and a single attempt turns retries off.
+	RetryAttempts int
+	// InitialBackoff is about how long is waited before retrying a call the first time, doubling with each retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest that's waited before retrying a call.
+	MaxBackoff time.Duration
+}
+
+// DefaultConfig is a config suiting most callers.
+var DefaultConfig = Config{
+	Timeout:        10 * time.Second,
+	RetryAttempts:  3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+type Client interface {
+	// ListRaces will return an iterator over every race matching the request, from the page its token asks for.
+	// Pages are fetched as the iterator reaches them, each with a deadline of its own.
+	ListRaces(ctx context.Context, in *racing.ListRacesRequest) RaceIterator
+
+	// GetRace will return a single race by its ID, with the given fields or every field when none are given. It
+	// fails with a NotFound status when there is no such race.
+	GetRace(ctx context.Context, id int64, fields ...string) (*racing.Race, error)
+
+	// BatchGetRaces will return the races found with the given IDs by their ID, with the given fields or every field
+	// when none are given.
+	BatchGetRaces(ctx context.Context, ids []int64, fields ...string) (map[int64]*racing.Race, error)
+
+	// ListRunners will return the runners of a race, in number order. It fails with a NotFound status when there is
+	// no such race.
+	ListRunners(ctx context.Context, raceID int64) ([]*racing.Runner, error)
+
+	// ListNextToJump will return the next open races to jump.
+	ListNextToJump(ctx context.Context, in *racing.ListNextToJumpRequest) (*racing.ListNextToJumpResponse, error)
+
+	// TransitionRace will move a race to a new status. It's never retried, as the race may have moved on since.
+	TransitionRace(ctx context.Context, in *racing.TransitionRaceRequest) (*racing.TransitionRaceResponse, error)
+
+	// ListRaceStatusTransitions will return the status changes of a race, oldest first.
+	ListRaceStatusTransitions(ctx context.Context, raceID int64) ([]*racing.RaceStatusTransition, error)
+
+	// ImportRaceCard will create or update the meetings, races and runners of a race card.
+	ImportRaceCard(ctx context.Context, in *racing.ImportRaceCardRequest) (*racing.ImportRaceCardResponse, error)
+}
+
+// client implements the Client interface.
+type client struct {
+	racingClient racing.RacingClient
+	config       Config
+}
+
+// NewClient wraps a racing client, such as one returned by racing.NewRacingClient or NewFake.
+func NewClient(racingClient racing.RacingClient, config Config) Client {
+	return &client{racingClient, config}
+}
+
+// WithBrand returns a context calling racing for a brand, which only shows the races shown on it.
+func WithBrand(ctx context.Context, brand string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, brandMetadataKey, brand)
+}
+
+// WithJurisdiction returns a context calling racing from a jurisdiction, such as AU-SA, which may hide or restrict
+// races.
+func WithJurisdiction(ctx context.Context, jurisdiction string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, jurisdictionMetadataKey, jurisdiction)
+}
+
+func (c *client) ListRaces(ctx context.Context, in *racing.ListRacesRequest) RaceIterator {
+	return newRaceIterator(ctx, in, func(ctx context.Context, in *racing.ListRacesRequest) (resp *racing.ListRacesResponse, err error) {
+		err = c.call(ctx, true, func(ctx context.Context) error {
+			resp, err = c.racingClient.ListRaces(ctx, in)
+			return err
+		})
+
+		return resp, err
+	})
+}
+
+func (c *client) GetRace(ctx context.Context, id int64, fields ...string) (race *racing.Race, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		race, err = c.racingClient.GetRace(ctx, &racing.GetRaceRequest{Id: id, ReadMask: readMask(fields)})
+		return err
+	})
+
+	return race, err
+}
+
+func (c *client) BatchGetRaces(ctx context.Context, ids []int64, fields ...string) (map[int64]*racing.Race, error) {
+	var resp *racing.BatchGetRacesResponse
+
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.racingClient.BatchGetRaces(ctx, &racing.BatchGetRacesRequest{Ids: ids, ReadMask: readMask(fields)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	races := make(map[int64]*racing.Race, len(resp.Results))
+	for _, result := range resp.Results {
+		if result.Found {
+			races[result.Id] = result.Race
+		}
+	}
+
+	return races, nil
+}
+
+func (c *client) ListRunners(ctx context.Context, raceID int64) ([]*racing.Runner, error) {
+	var resp *racing.ListRunnersResponse
+
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.racingClient.ListRunners(ctx, &racing.ListRunnersRequest{RaceId: raceID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Runners, nil
+}
+
+func (c *client) ListNextToJump(ctx context.Context, in *racing.ListNextToJumpRequest) (resp *racing.ListNextToJumpResponse, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		resp, err = c.racingClient.ListNextToJump(ctx, in)
+		return err
+	})
+
+	return resp, err
+}
+
+func (c *client) TransitionRace(ctx context.Context, in *racing.TransitionRaceRequest) (resp *racing.TransitionRaceResponse, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		resp, err = c.racingClient.TransitionRace(ctx, in)
+		return err
+	})
+
+	return resp, err
+}
+
+func (c *client) ListRaceStatusTransitions(ctx context.Context, raceID int64) ([]*racing.RaceStatusTransition, error) {
+	var resp *racing.ListRaceStatusTransitionsResponse
+
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.racingClient.ListRaceStatusTransitions(ctx, &racing.ListRaceStatusTransitionsRequest{RaceId: raceID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Transitions, nil
+}
+
+func (c *client) ImportRaceCard(ctx context.Context, in *racing.ImportRaceCardRequest) (resp *racing.ImportRaceCardResponse, err error) {
+	// Imports are keyed on external IDs, so importing the same card again changes nothing.
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		resp, err = c.racingClient.ImportRaceCard(ctx, in)
+		return err
+	})
+
+	return resp, err
+}
+
+// call makes a call to racing within the configured timeout, retrying it while racing is unavailable when it's
+// safe to repeat.
+func (c *client) call(ctx context.Context, retry bool, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Deadline(); !ok && c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	attempts := c.config.RetryAttempts
+	if !retry || attempts < 1 {
+		attempts = 1
+	}
+
+	backoff := c.config.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt == attempts || status.Code(err) != codes.Unavailable {
+			return err
+		}
+
+		// Should the deadline pass while waiting to retry, racing being unavailable is what's reported.
+		if !sleep(ctx, jitter(backoff)) {
+			return err
+		}
+
+		if backoff *= 2; c.config.MaxBackoff > 0 && backoff > c.config.MaxBackoff {
+			backoff = c.config.MaxBackoff
+		}
+	}
+}
+
+// jitter spreads retries out between half and all of the backoff, so callers failing together don't retry
+// together.
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 1 {
+		return backoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// sleep waits for a while, returning false early should the context be done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// readMask returns the read mask of the given fields, which is nil when every field should be read.
+func readMask(fields []string) *field_mask.FieldMask {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &field_mask.FieldMask{Paths: fields}
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// testConfig retries calls without waiting long between attempts.
+var testConfig = Config{
+	Timeout:        time.Second,
+	RetryAttempts:  3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+// deadlineFake records the deadline GetRace was last called with.
+type deadlineFake struct {
+	*Fake
+
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (f *deadlineFake) GetRace(ctx context.Context, in *racing.GetRaceRequest, opts ...grpc.CallOption) (*racing.Race, error) {
+	f.deadline, f.hasDeadline = ctx.Deadline()
+	return f.Fake.GetRace(ctx, in, opts...)
+}
+
+func TestClientRetries(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	tests := map[string]struct {
+		config    Config
+		method    string
+		failures  []error
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		"recovering":        {testConfig, "GetRace", []error{unavailable, unavailable}, codes.OK, 3},
+		"giving up":         {testConfig, "GetRace", []error{unavailable, unavailable, unavailable}, codes.Unavailable, 3},
+		"not found":         {testConfig, "GetRace", []error{status.Error(codes.NotFound, "race not found")}, codes.NotFound, 1},
+		"internal":          {testConfig, "GetRace", []error{status.Error(codes.Internal, "oops")}, codes.Internal, 1},
+		"exhausted":         {testConfig, "GetRace", []error{status.Error(codes.ResourceExhausted, "slow down")}, codes.ResourceExhausted, 1},
+		"retries off":       {Config{RetryAttempts: 1}, "GetRace", []error{unavailable}, codes.Unavailable, 1},
+		"not safe to retry": {testConfig, "TransitionRace", []error{unavailable}, codes.Unavailable, 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := NewFake(&racing.Race{Id: 1, Status: racing.RaceStatus_RACE_STATUS_OPEN})
+			fake.Fail(test.method, test.failures...)
+			c := NewClient(fake, test.config)
+
+			var err error
+			if test.method == "TransitionRace" {
+				_, err = c.TransitionRace(context.Background(), &racing.TransitionRaceRequest{RaceId: 1, Status: racing.RaceStatus_RACE_STATUS_CLOSED})
+			} else {
+				_, err = c.GetRace(context.Background(), 1)
+			}
+
+			if code := status.Code(err); code != test.wantCode {
+				t.Errorf("got %v, want %s", err, test.wantCode)
+			}
+			if got := fake.Calls(test.method); got != test.wantCalls {
+				t.Errorf("called %d times, want %d", got, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientGivesUpAtTheDeadline(t *testing.T) {
+	fake := NewFake(&racing.Race{Id: 1})
+	fake.Fail("GetRace", status.Error(codes.Unavailable, "connection refused"), status.Error(codes.Unavailable, "connection refused"))
+	c := NewClient(fake, Config{RetryAttempts: 3, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Racing being unavailable is reported, rather than the deadline passing while waiting to retry.
+	if _, err := c.GetRace(ctx, 1); status.Code(err) != codes.Unavailable {
+		t.Errorf("got %v, want Unavailable", err)
+	}
+	if got := fake.Calls("GetRace"); got != 1 {
+		t.Errorf("called %d times, want 1", got)
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	tests := map[string]struct {
+		timeout time.Duration
+		// callerTimeout is the timeout of the caller's context, which has no deadline when zero.
+		callerTimeout time.Duration
+		want          time.Duration
+	}{
+		"default":        {timeout: time.Minute, want: time.Minute},
+		"caller's":       {timeout: time.Minute, callerTimeout: time.Hour, want: time.Hour},
+		"caller's first": {timeout: time.Hour, callerTimeout: time.Minute, want: time.Minute},
+		"none":           {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := &deadlineFake{Fake: NewFake(&racing.Race{Id: 1})}
+			c := NewClient(fake, Config{Timeout: test.timeout})
+
+			ctx := context.Background()
+			if test.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.callerTimeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			if _, err := c.GetRace(ctx, 1); err != nil {
+				t.Fatalf("getting race: %s", err)
+			}
+
+			if test.want == 0 {
+				if fake.hasDeadline {
+					t.Errorf("called with a deadline in %s, want none", fake.deadline.Sub(start))
+				}
+				return
+			}
+
+			if got := fake.deadline.Sub(start); !fake.hasDeadline || got < test.want-time.Second || got > test.want+time.Second {
+				t.Errorf("called with a deadline in %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRaceIterator(t *testing.T) {
+	fake := NewFake()
+	for id := int64(1); id <= 7; id++ {
+		fake.Put(&racing.Race{Id: id})
+	}
+	c := NewClient(fake, testConfig)
+
+	// Races are read across every page, stopping once the last has been.
+	it := c.ListRaces(context.Background(), &racing.ListRacesRequest{PageSize: 3})
+
+	var got []int64
+	for it.Next() {
+		got = append(got, it.Race().Id)
+	}
+	if it.Err() != nil || len(got) != 7 || got[0] != 1 || got[6] != 7 {
+		t.Fatalf("listed races %v, %v, want races 1 to 7", got, it.Err())
+	}
+	if it.Next() || it.Race() != nil || it.PageToken() != "" {
+		t.Error("iterator went on past the last page")
+	}
+	if calls := fake.Calls("ListRaces"); calls != 3 {
+		t.Errorf("fetched %d pages, want 3", calls)
+	}
+
+	// A page failing stops iteration, which can be picked up again from the page that failed.
+	it = c.ListRaces(context.Background(), &racing.ListRacesRequest{PageSize: 3})
+	for i := 0; i < 3; i++ {
+		it.Next()
+	}
+	fake.Fail("ListRaces", status.Error(codes.Internal, "oops"))
+
+	if it.Next() || status.Code(it.Err()) != codes.Internal {
+		t.Fatalf("iterator carried on past a failed page, with error %v", it.Err())
+	}
+	if it.Next() {
+		t.Error("iterator carried on after failing")
+	}
+
+	it = c.ListRaces(context.Background(), &racing.ListRacesRequest{PageSize: 3, PageToken: it.PageToken()})
+	if !it.Next() || it.Race().Id != 4 {
+		t.Errorf("picking up iteration got race %v, %v, want race 4", it.Race(), it.Err())
+	}
+}
@@ -0,0 +1,478 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// defaultFakeNextToJumpLimit is the number of races the fake returns from ListNextToJump when no limit is given, as
+// racing does.
+const defaultFakeNextToJumpLimit = 10
+
+// Fake is an in-memory racing service for tests, which can be wrapped by NewClient in place of a client of the real
+// one. Races are listed in ID order, a page at a time, and only those shown on the brand of a call, and not hidden
+// from its jurisdiction, are seen.
+type Fake struct {
+	mu          sync.Mutex
+	races       map[int64]*racing.Race
+	transitions map[int64][]*racing.RaceStatusTransition
+	runners     map[int64][]*racing.Runner
+	rules       *jurisdiction.Rules
+	failures    map[string][]error
+	calls       map[string]int
+}
+
+var _ racing.RacingClient = (*Fake)(nil)
+
+// NewFake creates a fake holding the given races. It falls short of racing in that filter expressions, facets,
+// exports and imports aren't supported, failing with an Unimplemented status, and races may be moved to any status.
+// Jurisdictions hide and restrict nothing until the fake is given rules by SetRules.
+func NewFake(races ...*racing.Race) *Fake {
+	f := &Fake{
+		races:       make(map[int64]*racing.Race),
+		transitions: make(map[int64][]*racing.RaceStatusTransition),
+		runners:     make(map[int64][]*racing.Runner),
+		failures:    make(map[string][]error),
+		calls:       make(map[string]int),
+	}
+	f.Put(races...)
+
+	return f
+}
+
+// Put adds races to the fake, replacing any with the same IDs.
+func (f *Fake) Put(races ...*racing.Race) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, race := range races {
+		f.races[race.Id] = proto.Clone(race).(*racing.Race)
+	}
+}
+
+// PutRunners sets the runners of a race, replacing any it had. They're listed in the order given.
+func (f *Fake) PutRunners(raceID int64, runners ...*racing.Runner) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.runners[raceID] = nil
+	for _, runner := range runners {
+		f.runners[raceID] = append(f.runners[raceID], proto.Clone(runner).(*racing.Runner))
+	}
+}
+
+// SetRules has the fake hide and restrict races by the jurisdiction of each call, as set by WithJurisdiction, as
+// racing does when given -jurisdiction-rules.
+func (f *Fake) SetRules(rules *jurisdiction.Rules) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = rules
+}
+
+// Fail makes the next calls to a method, such as GetRace, fail with the given errors in turn, such as an
+// Unavailable status for testing retries.
+func (f *Fake) Fail(method string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[method] = append(f.failures[method], errs...)
+}
+
+// Calls returns how many times a method has been called, including calls made to fail.
+func (f *Fake) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[method]
+}
+
+func (f *Fake) ListRaces(ctx context.Context, in *racing.ListRacesRequest, _ ...grpc.CallOption) (*racing.ListRacesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ListRaces"); err != nil {
+		return nil, err
+	}
+	if in.FilterExpression != "" || in.IncludeFacets {
+		return nil, status.Error(codes.Unimplemented, "the fake doesn't support filter expressions or facets")
+	}
+
+	offset := 0
+	if in.PageToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(in.PageToken); err != nil || offset < 0 {
+			return nil, errs.InvalidArgument("page_token", "invalid page token")
+		}
+	}
+
+	policy := f.policy(ctx)
+
+	var races []*racing.Race
+	for _, race := range f.sorted(ctx, policy) {
+		if matchesFilter(race, in.Filter) {
+			races = append(races, race)
+		}
+	}
+
+	if offset > len(races) {
+		offset = len(races)
+	}
+	races = races[offset:]
+
+	resp := &racing.ListRacesResponse{}
+	if in.PageSize > 0 && len(races) > int(in.PageSize) {
+		races = races[:in.PageSize]
+		resp.NextPageToken = strconv.Itoa(offset + len(races))
+	}
+
+	for _, race := range races {
+		resp.Races = append(resp.Races, masked(race, policy, in.ReadMask.GetPaths()))
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) ListNextToJump(ctx context.Context, in *racing.ListNextToJumpRequest, _ ...grpc.CallOption) (*racing.ListNextToJumpResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ListNextToJump"); err != nil {
+		return nil, err
+	}
+
+	limit := int(in.Limit)
+	if limit == 0 {
+		limit = defaultFakeNextToJumpLimit
+	}
+
+	now := time.Now()
+	policy := f.policy(ctx)
+
+	var upcoming []*racing.Race
+	for _, race := range f.sorted(ctx, policy) {
+		open := race.Status == racing.RaceStatus_RACE_STATUS_OPEN || race.Status == racing.RaceStatus_RACE_STATUS_SUSPENDED
+		if race.Visible && open && !AdvertisedStart(race).Before(now) {
+			upcoming = append(upcoming, race)
+		}
+	}
+
+	sort.SliceStable(upcoming, func(a, b int) bool {
+		return AdvertisedStart(upcoming[a]).Before(AdvertisedStart(upcoming[b]))
+	})
+
+	next := func(raceType racing.RaceType) []*racing.NextToJumpRace {
+		var races []*racing.NextToJumpRace
+		for _, race := range upcoming {
+			if len(races) == limit {
+				break
+			}
+
+			if raceType == racing.RaceType_RACE_TYPE_UNSPECIFIED || race.RaceType == raceType {
+				races = append(races, &racing.NextToJumpRace{
+					Race:          masked(race, policy, in.ReadMask.GetPaths()),
+					SecondsToJump: race.AdvertisedStartTime.Seconds - now.Unix(),
+				})
+			}
+		}
+
+		return races
+	}
+
+	if !in.GroupByRaceType {
+		return &racing.ListNextToJumpResponse{Races: next(racing.RaceType_RACE_TYPE_UNSPECIFIED)}, nil
+	}
+
+	resp := &racing.ListNextToJumpResponse{}
+	for _, raceType := range []racing.RaceType{
+		racing.RaceType_RACE_TYPE_THOROUGHBRED,
+		racing.RaceType_RACE_TYPE_GREYHOUND,
+		racing.RaceType_RACE_TYPE_HARNESS,
+	} {
+		if races := next(raceType); len(races) > 0 {
+			resp.Groups = append(resp.Groups, &racing.NextToJumpGroup{RaceType: raceType, Races: races})
+		}
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) GetRace(ctx context.Context, in *racing.GetRaceRequest, _ ...grpc.CallOption) (*racing.Race, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "GetRace"); err != nil {
+		return nil, err
+	}
+
+	policy := f.policy(ctx)
+
+	race, ok := f.races[in.Id]
+	if !ok || !shown(ctx, race, policy) {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.Id, 10))
+	}
+
+	return masked(race, policy, in.ReadMask.GetPaths()), nil
+}
+
+func (f *Fake) BatchGetRaces(ctx context.Context, in *racing.BatchGetRacesRequest, _ ...grpc.CallOption) (*racing.BatchGetRacesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "BatchGetRaces"); err != nil {
+		return nil, err
+	}
+
+	policy := f.policy(ctx)
+
+	resp := &racing.BatchGetRacesResponse{Results: make([]*racing.BatchGetRacesResult, len(in.Ids))}
+	for i, id := range in.Ids {
+		result := &racing.BatchGetRacesResult{Id: id}
+		if race, ok := f.races[id]; ok && shown(ctx, race, policy) {
+			result.Found, result.Race = true, masked(race, policy, in.ReadMask.GetPaths())
+		}
+
+		resp.Results[i] = result
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) ListRunners(ctx context.Context, in *racing.ListRunnersRequest, _ ...grpc.CallOption) (*racing.ListRunnersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ListRunners"); err != nil {
+		return nil, err
+	}
+
+	race, ok := f.races[in.RaceId]
+	if !ok || !shown(ctx, race, f.policy(ctx)) {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+
+	resp := &racing.ListRunnersResponse{}
+	for _, runner := range f.runners[in.RaceId] {
+		resp.Runners = append(resp.Runners, proto.Clone(runner).(*racing.Runner))
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) ExportRaces(ctx context.Context, _ *racing.ExportRacesRequest, _ ...grpc.CallOption) (racing.Racing_ExportRacesClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ExportRaces"); err != nil {
+		return nil, err
+	}
+
+	return nil, status.Error(codes.Unimplemented, "the fake doesn't support exports")
+}
+
+func (f *Fake) TransitionRace(ctx context.Context, in *racing.TransitionRaceRequest, _ ...grpc.CallOption) (*racing.TransitionRaceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "TransitionRace"); err != nil {
+		return nil, err
+	}
+
+	race, ok := f.races[in.RaceId]
+	if !ok {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+
+	transition := &racing.RaceStatusTransition{
+		RaceId:         in.RaceId,
+		From:           race.Status,
+		To:             in.Status,
+		Actor:          in.Actor,
+		Reason:         in.Reason,
+		TransitionedAt: ptypes.TimestampNow(),
+	}
+	race.Status = in.Status
+	f.transitions[in.RaceId] = append(f.transitions[in.RaceId], transition)
+
+	return &racing.TransitionRaceResponse{Race: proto.Clone(race).(*racing.Race), Transition: transition}, nil
+}
+
+func (f *Fake) ListRaceStatusTransitions(ctx context.Context, in *racing.ListRaceStatusTransitionsRequest, _ ...grpc.CallOption) (*racing.ListRaceStatusTransitionsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ListRaceStatusTransitions"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := f.races[in.RaceId]; !ok {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+
+	resp := &racing.ListRaceStatusTransitionsResponse{}
+	for _, transition := range f.transitions[in.RaceId] {
+		resp.Transitions = append(resp.Transitions, proto.Clone(transition).(*racing.RaceStatusTransition))
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) ImportRaceCard(ctx context.Context, _ *racing.ImportRaceCardRequest, _ ...grpc.CallOption) (*racing.ImportRaceCardResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin(ctx, "ImportRaceCard"); err != nil {
+		return nil, err
+	}
+
+	return nil, status.Error(codes.Unimplemented, "the fake doesn't support imports")
+}
+
+// begin counts a call to a method, returning the next error it was made to fail with, if any. The fake must be
+// locked.
+func (f *Fake) begin(ctx context.Context, method string) error {
+	f.calls[method]++
+
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	if failures := f.failures[method]; len(failures) > 0 {
+		f.failures[method] = failures[1:]
+		return failures[0]
+	}
+
+	return nil
+}
+
+// policy returns the policy of the jurisdiction of a call. The fake must be locked.
+func (f *Fake) policy(ctx context.Context) jurisdiction.Policy {
+	return f.rules.For(callMetadata(ctx, jurisdictionMetadataKey))
+}
+
+// sorted returns the races a call is shown, in ID order. The fake must be locked.
+func (f *Fake) sorted(ctx context.Context, policy jurisdiction.Policy) []*racing.Race {
+	races := make([]*racing.Race, 0, len(f.races))
+	for _, race := range f.races {
+		if shown(ctx, race, policy) {
+			races = append(races, race)
+		}
+	}
+
+	sort.Slice(races, func(a, b int) bool { return races[a].Id < races[b].Id })
+
+	return races
+}
+
+// callMetadata returns the last value a call was given of a metadata key, such as the brand set by WithBrand.
+func callMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return strings.TrimSpace(values[len(values)-1])
+	}
+
+	return ""
+}
+
+// shown reports whether a call is shown a race, being shown on the brand of the call and not hidden from its
+// jurisdiction.
+func shown(ctx context.Context, race *racing.Race, policy jurisdiction.Policy) bool {
+	return shownOn(race, strings.ToLower(callMetadata(ctx, brandMetadataKey))) && !policy.Hides(race)
+}
+
+// shownOn reports whether a race is shown on a brand, with races restricted to no brands shown on every brand.
+func shownOn(race *racing.Race, brand string) bool {
+	if len(race.Brands) == 0 {
+		return true
+	}
+
+	for _, b := range race.Brands {
+		if b == brand {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesFilter reports whether a race matches a structured filter.
+func matchesFilter(race *racing.Race, filter *racing.ListRacesRequestFilter) bool {
+	if filter == nil {
+		return true
+	}
+
+	if len(filter.MeetingIds) > 0 {
+		found := false
+		for _, id := range filter.MeetingIds {
+			found = found || id == race.MeetingId
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	start := AdvertisedStart(race)
+	if from := Time(filter.AdvertisedStartTimeFrom); !from.IsZero() && start.Before(from) {
+		return false
+	}
+	if to := Time(filter.AdvertisedStartTimeTo); !to.IsZero() && !start.Before(to) {
+		return false
+	}
+	if filter.StartsWithin != nil {
+		now := time.Now()
+		within, err := ptypes.Duration(filter.StartsWithin)
+		if err != nil || start.Before(now) || start.After(now.Add(within)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// masked returns a copy of a race, with why it can't be bet on under a policy, with only the given fields set, or
+// every field when none are given.
+func masked(race *racing.Race, policy jurisdiction.Policy, fields []string) *racing.Race {
+	copied := proto.Clone(race).(*racing.Race)
+	copied.Restrictions = policy.Restrictions(race)
+	if len(fields) == 0 {
+		return copied
+	}
+
+	keep := make(map[protoreflect.Name]bool, len(fields))
+	for _, field := range fields {
+		keep[protoreflect.Name(field)] = true
+	}
+
+	msg := copied.ProtoReflect()
+
+	var clear []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !keep[fd.Name()] {
+			clear = append(clear, fd)
+		}
+		return true
+	})
+
+	for _, fd := range clear {
+		msg.Clear(fd)
+	}
+
+	return copied
+}
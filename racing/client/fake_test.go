@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+func TestFakeShowsCallsTheirRaces(t *testing.T) {
+	rules, err := jurisdiction.Load(filepath.Join("..", "jurisdiction", "examples", "rules.json"))
+	if err != nil {
+		t.Fatalf("loading rules: %s", err)
+	}
+
+	fake := NewFake(
+		&racing.Race{Id: 1, Country: "AU", RaceType: racing.RaceType_RACE_TYPE_GREYHOUND},
+		&racing.Race{Id: 2, Country: "US", RaceType: racing.RaceType_RACE_TYPE_THOROUGHBRED},
+		&racing.Race{Id: 3, Country: "HK", RaceType: racing.RaceType_RACE_TYPE_THOROUGHBRED, Brands: []string{"neds"}},
+	)
+
+	tests := map[string]struct {
+		ctx          context.Context
+		rules        *jurisdiction.Rules
+		want         []int64
+		restrictions map[int64]int
+	}{
+		"without rules":   {WithJurisdiction(context.Background(), "AU"), nil, []int64{1, 2}, nil},
+		"no jurisdiction": {context.Background(), rules, []int64{1, 2}, nil},
+		"brand":           {WithBrand(context.Background(), " Neds "), rules, []int64{1, 2, 3}, map[int64]int{3: 1}},
+		"country":         {WithJurisdiction(context.Background(), "AU"), rules, []int64{1}, nil},
+		"state":           {WithJurisdiction(WithBrand(context.Background(), "neds"), "au-sa"), rules, []int64{1, 3}, map[int64]int{1: 1, 3: 1}},
+	}
+
+	for name, test := range tests {
+		fake.SetRules(test.rules)
+
+		resp, err := fake.ListRaces(test.ctx, &racing.ListRacesRequest{})
+		if err != nil {
+			t.Fatalf("%s: listing races: %s", name, err)
+		}
+
+		var got []string
+		for _, race := range resp.Races {
+			got = append(got, race.String())
+			if len(race.Restrictions) != test.restrictions[race.Id] {
+				t.Errorf("%s: race %d has restrictions %v", name, race.Id, race.Restrictions)
+			}
+		}
+		if len(resp.Races) != len(test.want) {
+			t.Errorf("%s: listed %v, want races %v", name, strings.Join(got, "; "), test.want)
+		}
+
+		for _, id := range []int64{1, 2, 3} {
+			wantShown := false
+			for _, want := range test.want {
+				wantShown = wantShown || want == id
+			}
+
+			_, err := fake.GetRace(test.ctx, &racing.GetRaceRequest{Id: id})
+			if shown := err == nil; shown != wantShown || (!shown && status.Code(err) != codes.NotFound) {
+				t.Errorf("%s: getting race %d got %v", name, id, err)
+			}
+
+			batch, err := fake.BatchGetRaces(test.ctx, &racing.BatchGetRacesRequest{Ids: []int64{id}})
+			if err != nil || batch.Results[0].Found != wantShown {
+				t.Errorf("%s: batch getting race %d got %v, %v", name, id, batch, err)
+			}
+		}
+	}
+
+	// Restrictions are only given when read.
+	fake.SetRules(rules)
+	race, err := fake.GetRace(WithBrand(context.Background(), "neds"), &racing.GetRaceRequest{Id: 3, ReadMask: &field_mask.FieldMask{Paths: []string{"id"}}})
+	if err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+	if len(race.Restrictions) > 0 {
+		t.Errorf("race read without its restrictions has restrictions %v", race.Restrictions)
+	}
+}
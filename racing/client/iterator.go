@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// RaceIterator iterates over races a page at a time. Next must be called before reading the first race.
+type RaceIterator interface {
+	// Next advances to the next race, fetching the next page once the last is used up. It returns false once there
+	// are no more races, or fetching a page failed.
+	Next() bool
+
+	// Race returns the race Next advanced to.
+	Race() *racing.Race
+
+	// Err returns the error which stopped the iteration, if any.
+	Err() error
+
+	// PageToken returns the token of the page following the last one fetched, which is empty once every page has
+	// been. Once the races of a page are used up, iteration can be picked up from it later by listing races with it.
+	PageToken() string
+}
+
+// listRacesFunc fetches a page of races.
+type listRacesFunc func(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error)
+
+// raceIterator implements the RaceIterator interface.
+type raceIterator struct {
+	ctx  context.Context
+	req  *racing.ListRacesRequest
+	list listRacesFunc
+
+	page  []*racing.Race
+	race  *racing.Race
+	token string
+	done  bool
+	err   error
+}
+
+func newRaceIterator(ctx context.Context, in *racing.ListRacesRequest, list listRacesFunc) *raceIterator {
+	// The request is copied, as each page is asked for by changing its token.
+	req := proto.Clone(in).(*racing.ListRacesRequest)
+
+	return &raceIterator{ctx: ctx, req: req, list: list, token: req.PageToken}
+}
+
+func (it *raceIterator) Next() bool {
+	// Pages may come back empty while more follow, so fetch until a race turns up or the pages run out.
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			it.race = nil
+			return false
+		}
+
+		it.fetch()
+	}
+
+	it.race, it.page = it.page[0], it.page[1:]
+
+	return true
+}
+
+// fetch fetches the next page of races.
+func (it *raceIterator) fetch() {
+	it.req.PageToken = it.token
+
+	resp, err := it.list(it.ctx, it.req)
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	it.page = resp.Races
+	it.token = resp.NextPageToken
+	it.done = resp.NextPageToken == ""
+}
+
+func (it *raceIterator) Race() *racing.Race {
+	return it.race
+}
+
+func (it *raceIterator) Err() error {
+	return it.err
+}
+
+func (it *raceIterator) PageToken() string {
+	return it.token
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Time converts a timestamp to a time in UTC, which is the zero time when the timestamp is unset or invalid.
+func Time(ts *timestamp.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// Timestamp converts a time to a timestamp, such as for filtering races by their start, which is nil for the zero
+// time.
+func Timestamp(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	ts, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+
+	return ts
+}
+
+// AdvertisedStart returns the time a race is advertised to start, which is the zero time when it wasn't read.
+func AdvertisedStart(race *racing.Race) time.Time {
+	return Time(race.GetAdvertisedStartTime())
+}
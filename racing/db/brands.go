@@ -0,0 +1,60 @@
+package db
+
+import (
+	"sort"
+	"strings"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// BrandScope limits the races read to those shown on a brand, unless it's for all brands. Races restricted to no
+// brand in particular are shown on every brand.
+type BrandScope struct {
+	// Brand is the brand races must be shown on.
+	Brand string
+	// All reads races whichever brands they're shown on, disregarding Brand.
+	All bool
+}
+
+// AllBrands is the scope of reads made across every brand, such as those made by admins, or by racing itself.
+var AllBrands = BrandScope{All: true}
+
+// ForBrand returns the scope of reads made for a brand.
+func ForBrand(brand string) BrandScope {
+	return BrandScope{Brand: brand}
+}
+
+// Includes reports whether a race, read with its brands, falls within the scope.
+func (s BrandScope) Includes(race *racing.Race) bool {
+	if s.All || len(race.Brands) == 0 {
+		return true
+	}
+
+	for _, brand := range race.Brands {
+		if brand == s.Brand {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s BrandScope) String() string {
+	if s.All {
+		return "*"
+	}
+
+	return "brand:" + s.Brand
+}
+
+// splitBrands splits the comma separated brands a race is read with, in order.
+func splitBrands(brands string) []string {
+	if brands == "" {
+		return nil
+	}
+
+	split := strings.Split(brands, ",")
+	sort.Strings(split)
+
+	return split
+}
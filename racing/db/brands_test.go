@@ -0,0 +1,94 @@
+package db
+
+import (
+	"testing"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+func TestBrandScopeIncludes(t *testing.T) {
+	tests := map[string]struct {
+		scope  BrandScope
+		brands []string
+		want   bool
+	}{
+		"every brand":          {ForBrand("neds"), nil, true},
+		"shown on the brand":   {ForBrand("neds"), []string{"ladbrokes", "neds"}, true},
+		"shown on others":      {ForBrand("neds"), []string{"ladbrokes"}, false},
+		"naming no brand":      {ForBrand(""), []string{"ladbrokes"}, false},
+		"all brands":           {AllBrands, []string{"ladbrokes"}, true},
+		"all brands of others": {BrandScope{Brand: "neds", All: true}, []string{"ladbrokes"}, true},
+	}
+
+	for name, test := range tests {
+		if got := test.scope.Includes(&racing.Race{Brands: test.brands}); got != test.want {
+			t.Errorf("%s: %s includes race of brands %v is %t, want %t", name, test.scope, test.brands, got, test.want)
+		}
+	}
+}
+
+func TestScopedReads(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+
+	// The card's race is only shown on neds, while the dummy races are shown on every brand.
+	id := importCard(t, racesRepo, testCard(), false)["FLEM-20261020-R1"].Id
+
+	tests := map[string]struct {
+		scope BrandScope
+		want  bool
+	}{
+		"all brands":    {AllBrands, true},
+		"the brand":     {ForBrand("neds"), true},
+		"another brand": {ForBrand("ladbrokes"), false},
+		"no brand":      {ForBrand(""), false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			scoped := racesRepo.Scoped(test.scope)
+
+			race, err := scoped.Get(id, nil)
+			switch {
+			case test.want && err != nil:
+				t.Errorf("getting race: %s", err)
+			case test.want && (len(race.Brands) != 1 || race.Brands[0] != "neds"):
+				t.Errorf("race read with brands %v, want [neds]", race.Brands)
+			case !test.want && err != ErrNotFound:
+				t.Errorf("getting race got %v, %v, want ErrNotFound", race, err)
+			}
+
+			races, err := scoped.GetMany([]int64{1, id}, []string{"id"})
+			if err != nil {
+				t.Fatalf("getting races: %s", err)
+			}
+			if got := len(races) == 2; got != test.want {
+				t.Errorf("got %d races of 2", len(races))
+			}
+
+			races, err = scoped.List(ListRacesQuery{})
+			if err != nil {
+				t.Fatalf("listing races: %s", err)
+			}
+			if got := len(races) == 101; got != test.want {
+				t.Errorf("listed %d races of 101", len(races))
+			}
+
+			// Scopes narrow filters down further, rather than widening them.
+			races, err = scoped.List(ListRacesQuery{Expression: `name = "Melbourne Cup" OR id = 1`})
+			if err != nil {
+				t.Fatalf("listing races: %s", err)
+			}
+			if got := len(races) == 2; got != test.want {
+				t.Errorf("listed %d filtered races of 2", len(races))
+			}
+		})
+	}
+
+	// Scoping leaves the repository it was made from alone.
+	if _, err := racesRepo.Scoped(ForBrand("ladbrokes")).Get(1, nil); err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+	if _, err := racesRepo.Get(id, nil); err != nil {
+		t.Errorf("unscoped repository lost sight of a race after being scoped: %s", err)
+	}
+}
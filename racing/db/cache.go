@@ -0,0 +1,346 @@
+package db
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// CachedRacesRepo is a races repository which caches the races read from another, until they change.
+type CachedRacesRepo interface {
+	RacesRepo
+
+	// Invalidate will drop everything cached, for when races have been changed other than through the repository.
+	Invalidate()
+
+	// Stats will return how well the cache is doing.
+	Stats() CacheStats
+}
+
+// CacheStats counts the lookups made of a cache, and what became of its entries.
+type CacheStats struct {
+	// Hits counts the lookups answered from the cache.
+	Hits int64 `json:"hits"`
+	// Misses counts the lookups which had to be read through to the repository.
+	Misses int64 `json:"misses"`
+	// Expirations counts the entries dropped for having outlived their TTL.
+	Expirations int64 `json:"expirations"`
+	// Evictions counts the entries dropped to make room for others.
+	Evictions int64 `json:"evictions"`
+	// Invalidations counts the times everything cached was dropped.
+	Invalidations int64 `json:"invalidations"`
+	// Entries is the number of entries cached.
+	Entries int `json:"entries"`
+}
+
+type cachedRacesRepo struct {
+	repo RacesRepo
+	// scope tells apart the reads of scoped copies of the repository, beginning the keys they're cached under.
+	scope string
+	*cache
+}
+
+// cache is the cache shared by a repository and its scoped copies.
+type cache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// generation increases with each invalidation, so reads which began before one aren't cached after it.
+	generation uint64
+	// version is the version of races last seen by Revision.
+	version int64
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// NewCachedRacesRepo creates a races repository caching up to size reads from another, each for ttl at most. Reads
+// made while filtering on starts_within are cached as of when they're made, so lag behind the window by up to ttl.
+//
+// Everything cached is invalidated by changes made through the repository, and whenever Revision finds races have
+// changed elsewhere, so races read after a revision are never older than it. Invalidate should be called for other
+// changes, such as those published from the outbox, to be picked up before the TTL passes.
+func NewCachedRacesRepo(repo RacesRepo, size int, ttl time.Duration) CachedRacesRepo {
+	return &cachedRacesRepo{
+		repo:  repo,
+		scope: AllBrands.String(),
+		cache: &cache{
+			size:    size,
+			ttl:     ttl,
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		},
+	}
+}
+
+func (c *cachedRacesRepo) Init() error {
+	return c.repo.Init()
+}
+
+func (c *cachedRacesRepo) List(q ListRacesQuery) ([]*racing.Race, error) {
+	v, err := c.cached("list:"+listKey(q), func() (interface{}, error) {
+		return c.repo.List(q)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneRaces(v.([]*racing.Race)), nil
+}
+
+// facetsResult is the cached result of a Facets call.
+type facetsResult struct {
+	total  int32
+	facets *racing.RaceFacets
+}
+
+func (c *cachedRacesRepo) Facets(q ListRacesQuery) (int32, *racing.RaceFacets, error) {
+	// Facets are the same whichever page, order, or fields, of races are asked for.
+	q.Limit, q.Offset, q.ByStart, q.Fields = 0, 0, false, nil
+
+	v, err := c.cached("facets:"+listKey(q), func() (interface{}, error) {
+		total, facets, err := c.repo.Facets(q)
+		return facetsResult{total: total, facets: facets}, err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	result := v.(facetsResult)
+
+	return result.total, proto.Clone(result.facets).(*racing.RaceFacets), nil
+}
+
+func (c *cachedRacesRepo) Get(id int64, fields []string) (*racing.Race, error) {
+	v, err := c.cached(fmt.Sprintf("get:%d;%s", id, fieldsKey(fields)), func() (interface{}, error) {
+		return c.repo.Get(id, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(v.(*racing.Race)).(*racing.Race), nil
+}
+
+func (c *cachedRacesRepo) GetMany(ids []int64, fields []string) ([]*racing.Race, error) {
+	// Races are returned in no particular order, so the same IDs in any order are the same read.
+	sorted := append([]int64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	v, err := c.cached(fmt.Sprintf("getMany:%v;%s", sorted, fieldsKey(fields)), func() (interface{}, error) {
+		return c.repo.GetMany(ids, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneRaces(v.([]*racing.Race)), nil
+}
+
+func (c *cachedRacesRepo) Transition(transition *racing.RaceStatusTransition) error {
+	err := c.repo.Transition(transition)
+	if err == nil {
+		c.Invalidate()
+	}
+
+	return err
+}
+
+func (c *cachedRacesRepo) Transitions(raceID int64) ([]*racing.RaceStatusTransition, error) {
+	return c.repo.Transitions(raceID)
+}
+
+func (c *cachedRacesRepo) Runners(raceID int64) ([]*racing.Runner, error) {
+	return c.repo.Runners(raceID)
+}
+
+func (c *cachedRacesRepo) Export(q ListRacesQuery, fn func(race *racing.Race) error) error {
+	return c.repo.Export(q, fn)
+}
+
+func (c *cachedRacesRepo) Revision(statuses []racing.RaceStatus) (Revision, error) {
+	// Revisions are always read through, as they're how changes made elsewhere are noticed.
+	revision, err := c.repo.Revision(statuses)
+	if err != nil {
+		return revision, err
+	}
+
+	c.mu.Lock()
+	changed := revision.Version != c.version
+	c.version = revision.Version
+	c.mu.Unlock()
+
+	if changed {
+		c.Invalidate()
+	}
+
+	return revision, nil
+}
+
+func (c *cachedRacesRepo) Import(card *racing.RaceCard, dryRun bool, importedAt time.Time) ([]*racing.ImportChange, error) {
+	changes, err := c.repo.Import(card, dryRun, importedAt)
+	if err == nil && !dryRun {
+		c.Invalidate()
+	}
+
+	return changes, err
+}
+
+func (c *cachedRacesRepo) Scoped(scope BrandScope) RacesRepo {
+	// Reads are scoped to the brand alone, so any exclusions carry over from the key of this repository.
+	prefix := c.scope
+	if i := strings.Index(prefix, ";exclude="); i >= 0 {
+		prefix = prefix[i:]
+	} else {
+		prefix = ""
+	}
+
+	return &cachedRacesRepo{repo: c.repo.Scoped(scope), scope: scope.String() + prefix, cache: c.cache}
+}
+
+func (c *cachedRacesRepo) Excluding(exclusion Exclusion) RacesRepo {
+	if exclusion.Expr == nil {
+		return c
+	}
+
+	return &cachedRacesRepo{repo: c.repo.Excluding(exclusion), scope: c.scope + ";exclude=" + exclusion.Name, cache: c.cache}
+}
+
+func (c *cachedRacesRepo) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.stats.Invalidations++
+}
+
+func (c *cachedRacesRepo) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+
+	return stats
+}
+
+// cached returns the value cached under key, or else loads and caches it. Values are shared between callers, so
+// must be copied before they're handed on.
+func (c *cachedRacesRepo) cached(key string, load func() (interface{}, error)) (interface{}, error) {
+	key = c.scope + ";" + key
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+
+			return entry.value, nil
+		}
+
+		c.remove(el)
+		c.stats.Expirations++
+	}
+	c.stats.Misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Values read across an invalidation may predate the change that caused it.
+	if generation != c.generation || c.size <= 0 {
+		return value, nil
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: time.Now().Add(c.ttl)})
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	return value, nil
+}
+
+// remove drops an entry from the cache, which must be locked.
+func (c *cachedRacesRepo) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// listKey returns the key a query is cached under, which is the same for queries asking for the same races.
+func listKey(q ListRacesQuery) string {
+	filter := &racing.ListRacesRequestFilter{}
+	if q.Filter != nil {
+		filter = proto.Clone(q.Filter).(*racing.ListRacesRequestFilter)
+	}
+
+	// Meetings are matched regardless of their order, or how many times they're given.
+	ids := filter.MeetingIds[:0]
+	seen := make(map[int64]bool, len(filter.MeetingIds))
+	for _, id := range filter.MeetingIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	filter.MeetingIds = ids
+
+	buf, _ := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+
+	return fmt.Sprintf(
+		"filter=%x;expression=%q;limit=%d;offset=%d;byStart=%t;%s",
+		buf,
+		strings.TrimSpace(q.Expression),
+		q.Limit,
+		q.Offset,
+		q.ByStart,
+		fieldsKey(q.Fields),
+	)
+}
+
+// fieldsKey returns the part of a key naming the fields read, regardless of their order.
+func fieldsKey(fields []string) string {
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+
+	return "fields=" + strings.Join(sorted, ",")
+}
+
+// cloneRaces deeply copies a list of races.
+func cloneRaces(races []*racing.Race) []*racing.Race {
+	clones := make([]*racing.Race, len(races))
+	for i, race := range races {
+		clones[i] = proto.Clone(race).(*racing.Race)
+	}
+
+	return clones
+}
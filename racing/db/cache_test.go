@@ -0,0 +1,273 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// countingRepo counts the reads made of a repository, and can hold a read of a race up until it's released.
+type countingRepo struct {
+	RacesRepo
+
+	mu    sync.Mutex
+	reads int
+	// loading is told of reads of races, which wait for release, when set.
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (r *countingRepo) Get(id int64, fields []string) (*racing.Race, error) {
+	r.mu.Lock()
+	r.reads++
+	r.mu.Unlock()
+
+	if r.loading != nil {
+		r.loading <- struct{}{}
+		<-r.release
+	}
+
+	return r.RacesRepo.Get(id, fields)
+}
+
+func (r *countingRepo) List(q ListRacesQuery) ([]*racing.Race, error) {
+	r.mu.Lock()
+	r.reads++
+	r.mu.Unlock()
+
+	return r.RacesRepo.List(q)
+}
+
+func (r *countingRepo) Reads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reads
+}
+
+// openTestCache opens a cache of up to size reads from a counted repository over a scratch database.
+func openTestCache(t *testing.T, size int, ttl time.Duration) (CachedRacesRepo, *countingRepo) {
+	t.Helper()
+
+	_, racesRepo := openTestRepo(t)
+	counted := &countingRepo{RacesRepo: racesRepo}
+
+	return NewCachedRacesRepo(counted, size, ttl), counted
+}
+
+// transition moves a race to a status through the repository, failing the test should it fail.
+func transition(t *testing.T, racesRepo RacesRepo, id int64, to racing.RaceStatus) {
+	t.Helper()
+
+	race, err := racesRepo.Get(id, []string{"status"})
+	if err != nil {
+		t.Fatalf("getting race %d: %s", id, err)
+	}
+
+	err = racesRepo.Transition(&racing.RaceStatusTransition{
+		RaceId:         id,
+		From:           race.Status,
+		To:             to,
+		Actor:          "test",
+		Reason:         "test",
+		TransitionedAt: ptypes.TimestampNow(),
+	})
+	if err != nil {
+		t.Fatalf("moving race %d to %s: %s", id, to, err)
+	}
+}
+
+// getStatus reads the status of a race, failing the test should it fail.
+func getStatus(t *testing.T, racesRepo RacesRepo, id int64) racing.RaceStatus {
+	t.Helper()
+
+	race, err := racesRepo.Get(id, []string{"status"})
+	if err != nil {
+		t.Fatalf("getting race %d: %s", id, err)
+	}
+
+	return race.Status
+}
+
+func TestCacheHits(t *testing.T) {
+	cached, counted := openTestCache(t, 10, time.Minute)
+
+	first, err := cached.Get(1, nil)
+	if err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+
+	// Races handed out are copies, so changing them leaves the cache alone.
+	first.Name = "changed"
+
+	second, err := cached.Get(1, nil)
+	if err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+	if second.Name == "changed" {
+		t.Error("cached race was changed through a race handed out")
+	}
+
+	// Reading other fields, or races in another order, are other reads.
+	if _, err := cached.Get(1, []string{"name"}); err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+	if _, err := cached.List(ListRacesQuery{Limit: 5}); err != nil {
+		t.Fatalf("listing races: %s", err)
+	}
+	if _, err := cached.List(ListRacesQuery{Limit: 5, ByStart: true}); err != nil {
+		t.Fatalf("listing races: %s", err)
+	}
+	if _, err := cached.List(ListRacesQuery{Limit: 5}); err != nil {
+		t.Fatalf("listing races: %s", err)
+	}
+
+	if reads := counted.Reads(); reads != 4 {
+		t.Errorf("read through %d times, want 4", reads)
+	}
+	if stats := cached.Stats(); stats.Hits != 2 || stats.Misses != 4 || stats.Entries != 4 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestCacheInvalidatesOnChanges(t *testing.T) {
+	cached, _ := openTestCache(t, 10, time.Minute)
+
+	if status := getStatus(t, cached, 1); status != racing.RaceStatus_RACE_STATUS_OPEN {
+		t.Fatalf("race starts out %s", status)
+	}
+
+	transition(t, cached, 1, racing.RaceStatus_RACE_STATUS_SUSPENDED)
+
+	if status := getStatus(t, cached, 1); status != racing.RaceStatus_RACE_STATUS_SUSPENDED {
+		t.Errorf("race is %s after being suspended through the cache", status)
+	}
+
+	// Dry runs change nothing, so leave the cache be.
+	before := cached.Stats().Invalidations
+	if _, err := cached.Import(testCard(), true, time.Now()); err != nil {
+		t.Fatalf("importing card: %s", err)
+	}
+	if after := cached.Stats().Invalidations; after != before {
+		t.Errorf("dry run invalidated the cache")
+	}
+
+	if _, err := cached.Import(testCard(), false, time.Now()); err != nil {
+		t.Fatalf("importing card: %s", err)
+	}
+	if after := cached.Stats().Invalidations; after != before+1 {
+		t.Errorf("import didn't invalidate the cache")
+	}
+}
+
+func TestCacheInvalidatesOnNewRevision(t *testing.T) {
+	cached, counted := openTestCache(t, 10, time.Minute)
+
+	if _, err := cached.Revision(nil); err != nil {
+		t.Fatalf("reading revision: %s", err)
+	}
+	getStatus(t, cached, 1)
+
+	// A revision of races which haven't changed keeps what's cached.
+	if _, err := cached.Revision(nil); err != nil {
+		t.Fatalf("reading revision: %s", err)
+	}
+	getStatus(t, cached, 1)
+	if reads := counted.Reads(); reads != 1 {
+		t.Fatalf("read through %d times, want 1", reads)
+	}
+
+	// Races changed other than through the cache are picked up once a revision sees them.
+	transition(t, counted.RacesRepo, 1, racing.RaceStatus_RACE_STATUS_SUSPENDED)
+
+	if status := getStatus(t, cached, 1); status != racing.RaceStatus_RACE_STATUS_OPEN {
+		t.Fatalf("race is %s before the revision is read, want it cached as open", status)
+	}
+	if _, err := cached.Revision(nil); err != nil {
+		t.Fatalf("reading revision: %s", err)
+	}
+	if status := getStatus(t, cached, 1); status != racing.RaceStatus_RACE_STATUS_SUSPENDED {
+		t.Errorf("race is %s after the revision is read, want suspended", status)
+	}
+}
+
+func TestCacheDropsReadsAcrossInvalidation(t *testing.T) {
+	cached, counted := openTestCache(t, 10, time.Minute)
+	counted.loading, counted.release = make(chan struct{}), make(chan struct{})
+
+	done := make(chan racing.RaceStatus)
+	go func() {
+		race, _ := cached.Get(1, []string{"status"})
+		done <- race.GetStatus()
+	}()
+
+	// The race is changed while it's being read, so what was read may predate the change.
+	<-counted.loading
+	transition(t, counted.RacesRepo, 1, racing.RaceStatus_RACE_STATUS_SUSPENDED)
+	cached.Invalidate()
+	close(counted.release)
+	<-done
+
+	counted.loading = nil
+
+	if status := getStatus(t, cached, 1); status != racing.RaceStatus_RACE_STATUS_SUSPENDED {
+		t.Errorf("race is %s, want the read from before the invalidation dropped", status)
+	}
+	if reads := counted.Reads(); reads != 2 {
+		t.Errorf("read through %d times, want 2", reads)
+	}
+}
+
+func TestCacheScopes(t *testing.T) {
+	cached, _ := openTestCache(t, 10, time.Minute)
+
+	neds := cached.Scoped(ForBrand("neds"))
+	ladbrokes := cached.Scoped(ForBrand("ladbrokes"))
+
+	for _, racesRepo := range []RacesRepo{cached, neds, ladbrokes, neds} {
+		getStatus(t, racesRepo, 1)
+	}
+
+	// Each scope is cached apart, but invalidated together.
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Entries != 3 {
+		t.Errorf("got stats %+v, want 1 hit of 3 entries", stats)
+	}
+
+	transition(t, neds, 1, racing.RaceStatus_RACE_STATUS_SUSPENDED)
+
+	if stats := cached.Stats(); stats.Entries != 0 {
+		t.Errorf("%d entries are left after a change", stats.Entries)
+	}
+	if status := getStatus(t, ladbrokes, 1); status != racing.RaceStatus_RACE_STATUS_SUSPENDED {
+		t.Errorf("race is %s on another brand, want suspended", status)
+	}
+}
+
+func TestCacheEvictsAndExpires(t *testing.T) {
+	cached, counted := openTestCache(t, 2, time.Minute)
+
+	for _, id := range []int64{1, 2, 1, 3, 1, 2} {
+		getStatus(t, cached, id)
+	}
+
+	// Race 2 is the least recently read when race 3 is cached, so is evicted.
+	if stats := cached.Stats(); stats.Evictions != 2 || stats.Hits != 2 || stats.Entries != 2 {
+		t.Errorf("got stats %+v, want 2 evictions and hits", stats)
+	}
+	if reads := counted.Reads(); reads != 4 {
+		t.Errorf("read through %d times, want 4", reads)
+	}
+
+	expiring, _ := openTestCache(t, 10, time.Millisecond)
+	getStatus(t, expiring, 1)
+	time.Sleep(5 * time.Millisecond)
+	getStatus(t, expiring, 1)
+
+	if stats := expiring.Stats(); stats.Expirations != 1 || stats.Hits != 0 {
+		t.Errorf("got stats %+v, want 1 expiration", stats)
+	}
+}
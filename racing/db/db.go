@@ -1,30 +1,82 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/golang/protobuf/ptypes"
 	"syreclabs.com/go/faker"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
 )
 
+// dummyRunners is the number of runners each dummy race is given.
+const dummyRunners = 8
+
 func (r *racesRepo) seed() error {
-	statement, err := r.db.Prepare(`CREATE TABLE IF NOT EXISTS races (id INTEGER PRIMARY KEY, meeting_id INTEGER, name TEXT, number INTEGER, visible INTEGER, advertised_start_time DATETIME)`)
-	if err == nil {
-		_, err = statement.Exec()
+	for i := 1; i <= 100; i++ {
+		if err := r.seedRace(int64(i)); err != nil {
+			return err
+		}
 	}
 
-	for i := 1; i <= 100; i++ {
-		statement, err = r.db.Prepare(`INSERT OR IGNORE INTO races(id, meeting_id, name, number, visible, advertised_start_time) VALUES (?,?,?,?,?,?)`)
-		if err == nil {
-			_, err = statement.Exec(
-				i,
-				faker.Number().Between(1, 10),
-				faker.Team().Name(),
-				faker.Number().Between(1, 12),
-				faker.Number().Between(0, 1),
-				faker.Time().Between(time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2)).Format(time.RFC3339),
-			)
+	return nil
+}
+
+// seedRace inserts a dummy race with the given ID and its runners, recording its creation, unless the race already
+// exists.
+func (r *racesRepo) seedRace(id int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT OR IGNORE INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type) VALUES (?,?,?,?,?,?,?)`,
+		id,
+		faker.Number().Between(1, 10),
+		faker.Team().Name(),
+		faker.Number().Between(1, 12),
+		faker.Number().Between(0, 1),
+		faker.Time().Between(time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 2)).UTC().Format(time.RFC3339),
+		faker.Number().Between(1, 3),
+	)
+	if err != nil {
+		return err
+	}
+
+	if inserted, err := res.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+
+	for number := 1; number <= dummyRunners; number++ {
+		_, err := tx.Exec(
+			`INSERT INTO runners(race_id, external_id, number, name) VALUES (?,?,?,?)`,
+			id,
+			fmt.Sprintf("dummy-%d-%d", id, number),
+			number,
+			fmt.Sprintf("Runner %d", number),
+		)
+		if err != nil {
+			return err
 		}
 	}
 
-	return err
+	race, err := r.getRace(tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = addEvent(tx, &racing.RaceEvent{
+		Type:       racing.RaceEventType_RACE_EVENT_TYPE_CREATED,
+		RaceId:     id,
+		Race:       race,
+		OccurredAt: ptypes.TimestampNow(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnavailable is returned when the database cannot serve a request right now, but may do so if retried.
+	ErrUnavailable = errors.New("database unavailable")
+
+	// ErrConflict is returned when a record has changed since it was read, so an update to it was not applied.
+	ErrConflict = errors.New("conflict")
+)
+
+// InvalidArgumentError is returned when an argument cannot be applied to a query.
+type InvalidArgumentError struct {
+	// Field is the request field that was rejected.
+	Field string
+	// Description explains why the field was rejected.
+	Description string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Description)
+}
+
+// isUniqueViolation reports whether an error was raised by a statement breaking a UNIQUE constraint.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// wrapError classifies errors raised by the database driver, so callers can tell transient failures apart from others.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrCantOpen, sqlite3.ErrIoErr:
+			return fmt.Errorf("%w: %s", ErrUnavailable, err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,14 @@
+package db
+
+import (
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+)
+
+// Exclusion leaves the races matching an expression out of reads, such as those a jurisdiction may not be shown.
+type Exclusion struct {
+	// Name identifies the exclusion, which must differ between exclusions with differing expressions, as reads are
+	// cached by it.
+	Name string
+	// Expr matches the races left out, with nil matching none.
+	Expr filterpkg.Expr
+}
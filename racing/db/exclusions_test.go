@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+)
+
+func TestExcludedReads(t *testing.T) {
+	cached, _ := openTestCache(t, 10, time.Minute)
+
+	first := Exclusion{Name: "first", Expr: filterpkg.Compare("id", filterpkg.Equal, filterpkg.Int(1))}
+	second := Exclusion{Name: "second", Expr: filterpkg.Compare("id", filterpkg.Equal, filterpkg.Int(2))}
+
+	for _, racesRepo := range []RacesRepo{cached, cached.Excluding(first), cached.Excluding(second), cached.Excluding(Exclusion{Name: "none"})} {
+		getStatus(t, racesRepo, 3)
+	}
+
+	// Reads are cached by exclusion, with those excluding nothing sharing the unexcluded reads.
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Entries != 3 {
+		t.Errorf("got stats %+v, want 1 hit of 3 entries", stats)
+	}
+
+	tests := map[string]struct {
+		racesRepo RacesRepo
+		want      []int64
+	}{
+		"unexcluded":           {cached, []int64{1, 2}},
+		"excluding one":        {cached.Excluding(first), []int64{2}},
+		"excluding both":       {cached.Excluding(first).Excluding(second), nil},
+		"scoped and excluding": {cached.Scoped(ForBrand("neds")).Excluding(second), []int64{1}},
+	}
+
+	for name, test := range tests {
+		races, err := test.racesRepo.GetMany([]int64{1, 2}, []string{"id"})
+		if err != nil {
+			t.Fatalf("%s: getting races: %s", name, err)
+		}
+
+		var got []int64
+		for _, race := range races {
+			got = append(got, race.Id)
+		}
+		if len(got) != len(test.want) || (len(got) > 0 && got[0] != test.want[0]) {
+			t.Errorf("%s: got races %v, want %v", name, got, test.want)
+		}
+
+		listed, err := test.racesRepo.List(ListRacesQuery{Expression: "id <= 2"})
+		if err != nil {
+			t.Fatalf("%s: listing races: %s", name, err)
+		}
+		if len(listed) != len(test.want) {
+			t.Errorf("%s: listed %d races, want %d", name, len(listed), len(test.want))
+		}
+	}
+
+	if _, err := cached.Excluding(first).Get(1, nil); err != ErrNotFound {
+		t.Errorf("getting excluded race got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations bring the database schema up to date. Each is applied once, in order, with progress tracked through
+// SQLite's user_version pragma, so new migrations must only ever be appended.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS races (id INTEGER PRIMARY KEY, meeting_id INTEGER, name TEXT, number INTEGER, visible INTEGER, advertised_start_time DATETIME)`,
+	// Start times were stored with the local zone offset, so normalise them to UTC, allowing them to be compared as text.
+	`UPDATE races SET advertised_start_time = strftime('%Y-%m-%dT%H:%M:%SZ', advertised_start_time)`,
+	`CREATE INDEX IF NOT EXISTS races_advertised_start_time ON races (advertised_start_time)`,
+	// Race types hold racing.RaceType values, with existing races spread across them.
+	`ALTER TABLE races ADD COLUMN race_type INTEGER NOT NULL DEFAULT 0`,
+	`UPDATE races SET race_type = id % 3 + 1`,
+	// Prices holds the current price of each runner, and price_history every price ever published.
+	`CREATE TABLE IF NOT EXISTS prices (race_id INTEGER NOT NULL, runner_number INTEGER NOT NULL, win REAL NOT NULL, place REAL NOT NULL, sequence INTEGER NOT NULL, published_at DATETIME NOT NULL, PRIMARY KEY (race_id, runner_number))`,
+	`CREATE TABLE IF NOT EXISTS price_history (sequence INTEGER PRIMARY KEY AUTOINCREMENT, race_id INTEGER NOT NULL, runner_number INTEGER NOT NULL, win REAL NOT NULL, place REAL NOT NULL, published_at DATETIME NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS price_history_race_id ON price_history (race_id, sequence)`,
+	// Statuses hold racing.RaceStatus values, with every existing race starting out open.
+	`ALTER TABLE races ADD COLUMN status INTEGER NOT NULL DEFAULT 1`,
+	`CREATE TABLE IF NOT EXISTS race_status_transitions (id INTEGER PRIMARY KEY AUTOINCREMENT, race_id INTEGER NOT NULL, from_status INTEGER NOT NULL, to_status INTEGER NOT NULL, actor TEXT NOT NULL, reason TEXT NOT NULL, transitioned_at DATETIME NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS race_status_transitions_race_id ON race_status_transitions (race_id, id)`,
+	// The outbox holds events describing changes to races, recorded alongside the changes and relayed on afterwards.
+	`CREATE TABLE IF NOT EXISTS outbox (id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER NOT NULL, race_id INTEGER NOT NULL, payload TEXT NOT NULL, occurred_at DATETIME NOT NULL, published_at DATETIME)`,
+	`CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (id) WHERE published_at IS NULL`,
+	// Meetings, races and runners imported from race cards are keyed on the external IDs of the feed they came from.
+	`CREATE TABLE IF NOT EXISTS meetings (id INTEGER PRIMARY KEY AUTOINCREMENT, external_id TEXT NOT NULL UNIQUE, name TEXT NOT NULL, race_type INTEGER NOT NULL)`,
+	`ALTER TABLE races ADD COLUMN external_id TEXT`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS races_external_id ON races (external_id)`,
+	`CREATE TABLE IF NOT EXISTS runners (id INTEGER PRIMARY KEY AUTOINCREMENT, race_id INTEGER NOT NULL, external_id TEXT NOT NULL UNIQUE, number INTEGER NOT NULL, name TEXT NOT NULL, scratched INTEGER NOT NULL DEFAULT 0, UNIQUE (race_id, number))`,
+	// Races may be restricted to being shown on some brands, with races restricted to none shown on every brand.
+	`CREATE TABLE IF NOT EXISTS race_brands (race_id INTEGER NOT NULL, brand TEXT NOT NULL, PRIMARY KEY (race_id, brand))`,
+	// Countries are ISO 3166-1 alpha-2 codes, left empty when unknown, and races take theirs from their meeting.
+	`ALTER TABLE meetings ADD COLUMN country TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE races ADD COLUMN country TEXT NOT NULL DEFAULT ''`,
+	// Races were all left open when statuses were added, so those which started over a day ago are finalised, with
+	// the change recorded first so that it can be matched on. Races started since are jumped by the scheduler.
+	`INSERT INTO race_status_transitions (race_id, from_status, to_status, actor, reason, transitioned_at) SELECT id, 1, 6, 'migration', 'started before race statuses were recorded', strftime('%Y-%m-%dT%H:%M:%SZ', 'now') FROM races WHERE status = 1 AND advertised_start_time < strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '-1 day')`,
+	`UPDATE races SET status = 6 WHERE status = 1 AND id IN (SELECT race_id FROM race_status_transitions WHERE actor = 'migration')`,
+	// Events which can't be published are dead lettered, keeping the error they failed with. Clearing failed_at
+	// queues them again.
+	`ALTER TABLE outbox ADD COLUMN failed_at DATETIME`,
+	`ALTER TABLE outbox ADD COLUMN failure TEXT`,
+	// Dummy races were seeded without runners, so are given the runners they're now seeded with, letting bets be
+	// checked against them.
+	`WITH RECURSIVE numbers(number) AS (SELECT 1 UNION ALL SELECT number + 1 FROM numbers WHERE number < 8) INSERT INTO runners (race_id, external_id, number, name) SELECT races.id, 'dummy-' || races.id || '-' || numbers.number, numbers.number, 'Runner ' || numbers.number FROM races, numbers WHERE races.external_id IS NULL AND NOT EXISTS (SELECT 1 FROM runners WHERE runners.race_id = races.id)`,
+}
+
+// migrate applies any migrations the database has not yet seen.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := applyMigration(db, i); err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, i int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migrations[i]); err != nil {
+		return err
+	}
+
+	// Pragmas don't accept bound parameters.
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
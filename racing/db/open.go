@@ -0,0 +1,16 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// busyTimeout is how long a connection waits for another to let go of the database before failing as busy.
+const busyTimeout = 5 * time.Second
+
+// Open opens the SQLite database at the given path in WAL mode, so that reads, such as long running exports, don't
+// hold up writes, nor writes reads. Writers still take turns, waiting out each other for up to busyTimeout.
+func Open(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d", path, busyTimeout.Milliseconds()))
+}
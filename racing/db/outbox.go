@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// OutboxRepo provides repository access to the race events waiting to be published.
+type OutboxRepo interface {
+	// Init will initialise our outbox repository.
+	Init() error
+
+	// Pending will return up to limit of the events yet to be published, oldest first.
+	Pending(limit int) ([]*racing.RaceEvent, error)
+
+	// MarkPublished will record every event up to and including the given ID as published.
+	MarkPublished(upToID int64, publishedAt time.Time) error
+
+	// MarkFailed will dead letter an event which can't be published, recording why, so that it's no longer pending.
+	MarkFailed(id int64, failure string, failedAt time.Time) error
+}
+
+type outboxRepo struct {
+	db   *sql.DB
+	init sync.Once
+}
+
+// NewOutboxRepo creates a new outbox repository.
+func NewOutboxRepo(db *sql.DB) OutboxRepo {
+	return &outboxRepo{db: db}
+}
+
+// Init prepares the outbox repository.
+func (r *outboxRepo) Init() error {
+	var err error
+
+	r.init.Do(func() {
+		err = migrate(r.db)
+	})
+
+	return err
+}
+
+func (r *outboxRepo) Pending(limit int) ([]*racing.RaceEvent, error) {
+	rows, err := r.db.Query(getOutboxQueries()[outboxPending], limit)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var events []*racing.RaceEvent
+	for rows.Next() {
+		var (
+			id      int64
+			payload string
+		)
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, wrapError(err)
+		}
+
+		var event racing.RaceEvent
+		if err := protojson.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, err
+		}
+		event.Id = id
+
+		events = append(events, &event)
+	}
+
+	return events, wrapError(rows.Err())
+}
+
+func (r *outboxRepo) MarkPublished(upToID int64, publishedAt time.Time) error {
+	_, err := r.db.Exec(getOutboxQueries()[outboxPublished], publishedAt.UTC().Format(filterpkg.TimestampLayout), upToID)
+	return wrapError(err)
+}
+
+func (r *outboxRepo) MarkFailed(id int64, failure string, failedAt time.Time) error {
+	_, err := r.db.Exec(getOutboxQueries()[outboxFailed], failedAt.UTC().Format(filterpkg.TimestampLayout), failure, id)
+	return wrapError(err)
+}
+
+// addEvent records an event in the outbox as part of the transaction making the change it describes, so that the
+// event is recorded if and only if the change is. Its ID is assigned once recorded.
+func addEvent(tx *sql.Tx, event *racing.RaceEvent) error {
+	occurredAt, err := ptypes.Timestamp(event.OccurredAt)
+	if err != nil {
+		return err
+	}
+
+	payload, err := protojson.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		getOutboxQueries()[outboxAdd],
+		event.Type,
+		event.RaceId,
+		string(payload),
+		occurredAt.UTC().Format(filterpkg.TimestampLayout),
+	)
+
+	return err
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// PricesRepo provides repository access to runner prices.
+type PricesRepo interface {
+	// Init will initialise our prices repository.
+	Init() error
+
+	// Current will return the current price of each runner in a race.
+	Current(raceID int64) ([]*racing.Price, error)
+
+	// History will return up to limit prices published for a race after the given sequence number, oldest first,
+	// with a negative limit returning them all. Only the prices of the given runner are returned, unless
+	// runnerNumber is zero.
+	History(raceID, runnerNumber, afterSequence int64, limit int) ([]*racing.Price, error)
+
+	// Publish will record new prices for runners in a race, returning them with their sequence numbers.
+	Publish(raceID int64, prices []*racing.RunnerPrice, publishedAt time.Time) ([]*racing.Price, error)
+}
+
+type pricesRepo struct {
+	db   *sql.DB
+	init sync.Once
+}
+
+// NewPricesRepo creates a new prices repository.
+func NewPricesRepo(db *sql.DB) PricesRepo {
+	return &pricesRepo{db: db}
+}
+
+// Init prepares the prices repository.
+func (r *pricesRepo) Init() error {
+	var err error
+
+	r.init.Do(func() {
+		err = migrate(r.db)
+	})
+
+	return err
+}
+
+func (r *pricesRepo) Current(raceID int64) ([]*racing.Price, error) {
+	rows, err := r.db.Query(getPriceQueries()[pricesCurrent], raceID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	prices, err := r.scanPrices(rows)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return prices, nil
+}
+
+func (r *pricesRepo) History(raceID, runnerNumber, afterSequence int64, limit int) ([]*racing.Price, error) {
+	rows, err := r.db.Query(getPriceQueries()[pricesHistory], raceID, afterSequence, runnerNumber, runnerNumber, limit)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	prices, err := r.scanPrices(rows)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return prices, nil
+}
+
+func (r *pricesRepo) Publish(raceID int64, runnerPrices []*racing.RunnerPrice, publishedAt time.Time) ([]*racing.Price, error) {
+	ts, err := ptypes.TimestampProto(publishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(getPriceQueries()[raceExists], raceID).Scan(&count); err != nil {
+		return nil, wrapError(err)
+	}
+	if count == 0 {
+		return nil, ErrNotFound
+	}
+
+	publishedAt = publishedAt.UTC()
+
+	prices := make([]*racing.Price, 0, len(runnerPrices))
+	for _, rp := range runnerPrices {
+		// The history table's AUTOINCREMENT key never reuses a value, so serves as the sequence number.
+		res, err := tx.Exec(getPriceQueries()[priceInsert], raceID, rp.RunnerNumber, rp.Win, rp.Place, publishedAt)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		sequence, err := res.LastInsertId()
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		if _, err := tx.Exec(getPriceQueries()[priceUpsert], raceID, rp.RunnerNumber, rp.Win, rp.Place, sequence, publishedAt); err != nil {
+			return nil, wrapError(err)
+		}
+
+		prices = append(prices, &racing.Price{
+			RaceId:       raceID,
+			RunnerNumber: rp.RunnerNumber,
+			Win:          rp.Win,
+			Place:        rp.Place,
+			Sequence:     sequence,
+			PublishedAt:  ts,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(err)
+	}
+
+	return prices, nil
+}
+
+func (r *pricesRepo) scanPrices(rows *sql.Rows) ([]*racing.Price, error) {
+	var prices []*racing.Price
+
+	for rows.Next() {
+		var price racing.Price
+		var publishedAt time.Time
+
+		if err := rows.Scan(&price.RaceId, &price.RunnerNumber, &price.Win, &price.Place, &price.Sequence, &publishedAt); err != nil {
+			return nil, err
+		}
+
+		ts, err := ptypes.TimestampProto(publishedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		price.PublishedAt = ts
+
+		prices = append(prices, &price)
+	}
+
+	return prices, rows.Err()
+}
@@ -1,20 +1,261 @@
 package db
 
+import (
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// raceFilterSchema lists the race fields which may be filtered on, and the columns they map onto.
+var raceFilterSchema = filterpkg.Schema{
+	"id":                    {Column: "id", Type: filterpkg.IntType},
+	"meeting_id":            {Column: "meeting_id", Type: filterpkg.IntType},
+	"name":                  {Column: "name", Type: filterpkg.StringType},
+	"number":                {Column: "number", Type: filterpkg.IntType},
+	"visible":               {Column: "visible", Type: filterpkg.BoolType},
+	"advertised_start_time": {Column: "advertised_start_time", Type: filterpkg.TimestampType},
+	"status":                {Column: "status", Type: filterpkg.EnumType, Values: racing.RaceStatus_value},
+	"race_type":             {Column: "race_type", Type: filterpkg.EnumType, Values: racing.RaceType_value},
+	"country":               {Column: "country", Type: filterpkg.StringType},
+}
+
+// raceColumns lists the columns races are read from, in the order they're selected in.
+var raceColumns = []string{
+	"id",
+	"meeting_id",
+	"name",
+	"number",
+	"visible",
+	"advertised_start_time",
+	"race_type",
+	"status",
+	"brands",
+	"country",
+}
+
+// raceColumnExprs maps the columns of races which aren't stored on them onto the expressions they're selected with.
+var raceColumnExprs = map[string]string{
+	"brands": "(SELECT group_concat(brand) FROM race_brands WHERE race_brands.race_id = races.id) AS brands",
+}
+
+// raceFieldColumns maps each field of a race onto the columns it's read from.
+var raceFieldColumns = map[string][]string{
+	"id":                    {"id"},
+	"meeting_id":            {"meeting_id"},
+	"name":                  {"name"},
+	"number":                {"number"},
+	"visible":               {"visible"},
+	"advertised_start_time": {"advertised_start_time"},
+	"race_type":             {"race_type"},
+	"status":                {"status"},
+	"brands":                {"brands"},
+	"country":               {"country"},
+	// Restrictions aren't stored, but are decided from these columns by the jurisdiction of each call.
+	"restrictions": {"meeting_id", "race_type", "country"},
+}
+
 const (
-	racesList = "list"
+	racesList         = "list"
+	raceGet           = "get"
+	racesGetMany      = "getMany"
+	raceStatus        = "status"
+	raceSetStatus     = "setStatus"
+	raceTransitionAdd = "addTransition"
+	raceTransitions   = "transitions"
+	raceRunners       = "runners"
+	racesRevision     = "revision"
+	raceBrandScope    = "brandScope"
 )
 
+// getRaceQueries returns the race queries, of which the list and get queries expect their selected columns to be
+// formatted in, the get many query its ID placeholders too, and the revision query its status placeholders. The brand
+// scope is a condition narrowing queries of races down to those shown on a brand.
 func getRaceQueries() map[string]string {
 	return map[string]string{
 		racesList: `
 			SELECT 
-				id, 
-				meeting_id, 
-				name, 
-				number, 
-				visible, 
-				advertised_start_time 
+				%s 
 			FROM races
 		`,
+		raceGet: `
+			SELECT 
+				%s 
+			FROM races 
+			WHERE id = ?
+		`,
+		racesGetMany: `
+			SELECT 
+				%s 
+			FROM races 
+			WHERE id IN (%s)
+		`,
+		raceStatus: `
+			SELECT status FROM races WHERE id = ?
+		`,
+		raceSetStatus: `
+			UPDATE races SET status = ? WHERE id = ? AND status = ?
+		`,
+		raceTransitionAdd: `
+			INSERT INTO race_status_transitions(race_id, from_status, to_status, actor, reason, transitioned_at) VALUES (?,?,?,?,?,?)
+		`,
+		raceTransitions: `
+			SELECT race_id, from_status, to_status, actor, reason, transitioned_at FROM race_status_transitions WHERE race_id = ? ORDER BY id
+		`,
+		raceRunners: `
+			SELECT number, name, scratched FROM runners WHERE race_id = ? ORDER BY number
+		`,
+		racesRevision: `
+			SELECT 
+				(SELECT IFNULL(MAX(id), 0) FROM outbox), 
+				(SELECT MIN(advertised_start_time) FROM races WHERE status IN (%s))
+		`,
+		raceBrandScope: `
+			(
+				NOT EXISTS (SELECT 1 FROM race_brands WHERE race_brands.race_id = races.id) 
+				OR EXISTS (SELECT 1 FROM race_brands WHERE race_brands.race_id = races.id AND race_brands.brand = ?)
+			)
+		`,
+	}
+}
+
+const (
+	meetingByExternalID = "meetingByExternalID"
+	meetingInsert       = "meetingInsert"
+	meetingUpdate       = "meetingUpdate"
+	raceByExternalID    = "raceByExternalID"
+	raceInsert          = "raceInsert"
+	raceUpdate          = "raceUpdate"
+	runnerByExternalID  = "runnerByExternalID"
+	runnerPark          = "runnerPark"
+	runnerInsert        = "runnerInsert"
+	runnerUpdate        = "runnerUpdate"
+	raceBrandsDelete    = "raceBrandsDelete"
+	raceBrandInsert     = "raceBrandInsert"
+)
+
+// getRaceCardQueries returns the queries race cards are imported with, of which the race by external ID query
+// expects its selected columns to be formatted in.
+func getRaceCardQueries() map[string]string {
+	return map[string]string{
+		meetingByExternalID: `
+			SELECT id, name, race_type, country FROM meetings WHERE external_id = ?
+		`,
+		meetingInsert: `
+			INSERT INTO meetings(external_id, name, race_type, country) VALUES (?,?,?,?)
+		`,
+		meetingUpdate: `
+			UPDATE meetings SET name = ?, race_type = ?, country = ? WHERE id = ?
+		`,
+		raceByExternalID: `
+			SELECT 
+				%s 
+			FROM races 
+			WHERE external_id = ?
+		`,
+		raceInsert: `
+			INSERT INTO races(meeting_id, name, number, visible, advertised_start_time, race_type, country, external_id) VALUES (?,?,?,?,?,?,?,?)
+		`,
+		raceUpdate: `
+			UPDATE races SET meeting_id = ?, name = ?, number = ?, visible = ?, advertised_start_time = ?, race_type = ?, country = ? WHERE id = ?
+		`,
+		runnerByExternalID: `
+			SELECT id, race_id, number, name, scratched FROM runners WHERE external_id = ?
+		`,
+		runnerPark: `
+			UPDATE runners SET number = -id WHERE id = ?
+		`,
+		runnerInsert: `
+			INSERT INTO runners(race_id, external_id, number, name, scratched) VALUES (?,?,?,?,?)
+		`,
+		runnerUpdate: `
+			UPDATE runners SET race_id = ?, number = ?, name = ?, scratched = ? WHERE id = ?
+		`,
+		raceBrandsDelete: `
+			DELETE FROM race_brands WHERE race_id = ?
+		`,
+		raceBrandInsert: `
+			INSERT INTO race_brands(race_id, brand) VALUES (?,?)
+		`,
+	}
+}
+
+const (
+	pricesCurrent = "current"
+	pricesHistory = "history"
+	priceInsert   = "insert"
+	priceUpsert   = "upsert"
+	raceExists    = "exists"
+)
+
+func getPriceQueries() map[string]string {
+	return map[string]string{
+		pricesCurrent: `
+			SELECT 
+				race_id, 
+				runner_number, 
+				win, 
+				place, 
+				sequence, 
+				published_at 
+			FROM prices 
+			WHERE race_id = ? 
+			ORDER BY runner_number
+		`,
+		pricesHistory: `
+			SELECT 
+				race_id, 
+				runner_number, 
+				win, 
+				place, 
+				sequence, 
+				published_at 
+			FROM price_history 
+			WHERE race_id = ? AND sequence > ? AND (? = 0 OR runner_number = ?) 
+			ORDER BY sequence 
+			LIMIT ?
+		`,
+		priceInsert: `
+			INSERT INTO price_history(race_id, runner_number, win, place, published_at) VALUES (?,?,?,?,?)
+		`,
+		priceUpsert: `
+			INSERT INTO prices(race_id, runner_number, win, place, sequence, published_at) VALUES (?,?,?,?,?,?) 
+			ON CONFLICT (race_id, runner_number) DO UPDATE SET 
+				win = excluded.win, 
+				place = excluded.place, 
+				sequence = excluded.sequence, 
+				published_at = excluded.published_at
+		`,
+		raceExists: `
+			SELECT COUNT(*) FROM races WHERE id = ?
+		`,
+	}
+}
+
+const (
+	outboxAdd       = "add"
+	outboxPending   = "pending"
+	outboxPublished = "published"
+	outboxFailed    = "failed"
+)
+
+func getOutboxQueries() map[string]string {
+	return map[string]string{
+		outboxAdd: `
+			INSERT INTO outbox(type, race_id, payload, occurred_at) VALUES (?,?,?,?)
+		`,
+		outboxPending: `
+			SELECT 
+				id, 
+				payload 
+			FROM outbox 
+			WHERE published_at IS NULL AND failed_at IS NULL 
+			ORDER BY id 
+			LIMIT ?
+		`,
+		outboxPublished: `
+			UPDATE outbox SET published_at = ? WHERE id <= ? AND published_at IS NULL AND failed_at IS NULL
+		`,
+		outboxFailed: `
+			UPDATE outbox SET failed_at = ?, failure = ? WHERE id = ? AND published_at IS NULL
+		`,
 	}
 }
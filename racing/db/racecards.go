@@ -0,0 +1,399 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// cardImport imports a single race card within a transaction.
+type cardImport struct {
+	r          *racesRepo
+	tx         *sql.Tx
+	dryRun     bool
+	importedAt time.Time
+	changes    []*racing.ImportChange
+}
+
+func (r *racesRepo) Import(card *racing.RaceCard, dryRun bool, importedAt time.Time) ([]*racing.ImportChange, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	// A dry run makes its changes like any other import, so that they're reported accurately, but never commits them.
+	defer tx.Rollback()
+
+	imp := &cardImport{r: r, tx: tx, dryRun: dryRun, importedAt: importedAt}
+
+	for i, meeting := range card.Meetings {
+		if err := imp.meeting(fmt.Sprintf("card.meetings[%d]", i), meeting); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	return imp.changes, nil
+}
+
+func (imp *cardImport) meeting(path string, meeting *racing.RaceCardMeeting) error {
+	queries := getRaceCardQueries()
+
+	var (
+		id       int64
+		name     string
+		raceType racing.RaceType
+		country  string
+		changed  fieldChanges
+		action   = racing.ImportAction_IMPORT_ACTION_UNCHANGED
+	)
+
+	err := imp.tx.QueryRow(queries[meetingByExternalID], meeting.ExternalId).Scan(&id, &name, &raceType, &country)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := imp.tx.Exec(queries[meetingInsert], meeting.ExternalId, meeting.Name, meeting.RaceType, meeting.Country)
+		if err != nil {
+			return err
+		}
+
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		action = racing.ImportAction_IMPORT_ACTION_CREATED
+	case err != nil:
+		return err
+	default:
+		changed.compare("name", name, meeting.Name)
+		changed.compare("race_type", raceType, meeting.RaceType)
+		changed.compare("country", country, meeting.Country)
+
+		if len(changed) > 0 {
+			if _, err := imp.tx.Exec(queries[meetingUpdate], meeting.Name, meeting.RaceType, meeting.Country, id); err != nil {
+				return err
+			}
+			action = racing.ImportAction_IMPORT_ACTION_UPDATED
+		}
+	}
+
+	imp.record(racing.ImportEntity_IMPORT_ENTITY_MEETING, meeting.ExternalId, id, action, changed)
+
+	for i, race := range meeting.Races {
+		if err := imp.race(fmt.Sprintf("%s.races[%d]", path, i), id, meeting, race); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (imp *cardImport) race(path string, meetingID int64, meeting *racing.RaceCardMeeting, race *racing.RaceCardRace) error {
+	queries := getRaceCardQueries()
+	raceType := meeting.RaceType
+
+	start, err := ptypes.Timestamp(race.AdvertisedStartTime)
+	if err != nil {
+		return &InvalidArgumentError{Field: path + ".advertised_start_time", Description: err.Error()}
+	}
+	start = start.UTC().Truncate(time.Second)
+
+	brands := append([]string(nil), race.Brands...)
+	sort.Strings(brands)
+
+	existing, err := imp.raceByExternalID(race.ExternalId)
+	if err != nil {
+		return err
+	}
+
+	var (
+		id      int64
+		changed fieldChanges
+		action  = racing.ImportAction_IMPORT_ACTION_UNCHANGED
+		event   = racing.RaceEventType_RACE_EVENT_TYPE_UNSPECIFIED
+	)
+
+	if existing == nil {
+		res, err := imp.tx.Exec(
+			queries[raceInsert],
+			meetingID,
+			race.Name,
+			race.Number,
+			race.Visible,
+			start.Format(filterpkg.TimestampLayout),
+			raceType,
+			meeting.Country,
+			race.ExternalId,
+		)
+		if err != nil {
+			return err
+		}
+
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if err := imp.setBrands(id, brands); err != nil {
+			return err
+		}
+		action, event = racing.ImportAction_IMPORT_ACTION_CREATED, racing.RaceEventType_RACE_EVENT_TYPE_CREATED
+	} else {
+		id = existing.Id
+
+		existingStart, err := ptypes.Timestamp(existing.AdvertisedStartTime)
+		if err != nil {
+			return err
+		}
+
+		changed.compare("meeting_id", existing.MeetingId, meetingID)
+		changed.compare("name", existing.Name, race.Name)
+		changed.compare("number", existing.Number, race.Number)
+		changed.compare("visible", existing.Visible, race.Visible)
+		changed.compare("advertised_start_time", existingStart, start)
+		changed.compare("race_type", existing.RaceType, raceType)
+		changed.compare("country", existing.Country, meeting.Country)
+
+		if changed.compare("brands", existing.Brands, brands) {
+			if err := imp.setBrands(id, brands); err != nil {
+				return err
+			}
+		}
+
+		if len(changed) > 0 {
+			_, err := imp.tx.Exec(
+				queries[raceUpdate],
+				meetingID,
+				race.Name,
+				race.Number,
+				race.Visible,
+				start.Format(filterpkg.TimestampLayout),
+				raceType,
+				meeting.Country,
+				id,
+			)
+			if err != nil {
+				return err
+			}
+			action, event = racing.ImportAction_IMPORT_ACTION_UPDATED, racing.RaceEventType_RACE_EVENT_TYPE_UPDATED
+		}
+	}
+
+	imp.record(racing.ImportEntity_IMPORT_ENTITY_RACE, race.ExternalId, id, action, changed)
+
+	if event != racing.RaceEventType_RACE_EVENT_TYPE_UNSPECIFIED {
+		snapshot, err := imp.r.getRace(imp.tx, id)
+		if err != nil {
+			return err
+		}
+
+		occurredAt, err := ptypes.TimestampProto(imp.importedAt)
+		if err != nil {
+			return err
+		}
+
+		err = addEvent(imp.tx, &racing.RaceEvent{
+			Type:       event,
+			RaceId:     id,
+			Race:       snapshot,
+			OccurredAt: occurredAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return imp.runners(path, id, race.Runners)
+}
+
+// cardRunner is a runner as it was before the import.
+type cardRunner struct {
+	id        int64
+	raceID    int64
+	number    int64
+	name      string
+	scratched bool
+}
+
+// runners imports the runners of a race. Numbers are unique within a race, so no two runners on the card may share
+// one, while the numbers held by runners missing from the card are left to the database to enforce. Runners on the
+// card changing number, or race, give up their old numbers before any are taken, so that they may swap numbers.
+func (imp *cardImport) runners(path string, raceID int64, runners []*racing.RaceCardRunner) error {
+	queries := getRaceCardQueries()
+
+	numbered := make(map[int64]string, len(runners))
+	for i, runner := range runners {
+		if holder, ok := numbered[runner.Number]; ok && holder != runner.ExternalId {
+			return &InvalidArgumentError{
+				Field:       fmt.Sprintf("%s.runners[%d].number", path, i),
+				Description: fmt.Sprintf("runner number %d is also given to runner %q", runner.Number, holder),
+			}
+		}
+		numbered[runner.Number] = runner.ExternalId
+	}
+
+	existing := make([]*cardRunner, len(runners))
+	for i, runner := range runners {
+		var r cardRunner
+		err := imp.tx.QueryRow(queries[runnerByExternalID], runner.ExternalId).Scan(&r.id, &r.raceID, &r.number, &r.name, &r.scratched)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		existing[i] = &r
+
+		// Runners hold numbers above zero, so a runner's negated ID is never anyone's number.
+		if r.raceID != raceID || r.number != runner.Number {
+			if _, err := imp.tx.Exec(queries[runnerPark], r.id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, runner := range runners {
+		if err := imp.runner(fmt.Sprintf("%s.runners[%d]", path, i), raceID, runner, existing[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runner creates or updates a runner, which is nil when there is no such runner yet.
+func (imp *cardImport) runner(path string, raceID int64, runner *racing.RaceCardRunner, existing *cardRunner) error {
+	queries := getRaceCardQueries()
+
+	var (
+		id      int64
+		changed fieldChanges
+		action  = racing.ImportAction_IMPORT_ACTION_UNCHANGED
+		err     error
+	)
+
+	if existing == nil {
+		var res sql.Result
+		res, err = imp.tx.Exec(queries[runnerInsert], raceID, runner.ExternalId, runner.Number, runner.Name, runner.Scratched)
+		if err == nil {
+			id, err = res.LastInsertId()
+		}
+		action = racing.ImportAction_IMPORT_ACTION_CREATED
+	} else {
+		id = existing.id
+
+		changed.compare("race_id", existing.raceID, raceID)
+		changed.compare("number", existing.number, runner.Number)
+		changed.compare("name", existing.name, runner.Name)
+		changed.compare("scratched", existing.scratched, runner.Scratched)
+
+		if len(changed) > 0 {
+			_, err = imp.tx.Exec(queries[runnerUpdate], raceID, runner.Number, runner.Name, runner.Scratched, id)
+			action = racing.ImportAction_IMPORT_ACTION_UPDATED
+		}
+	}
+
+	// External IDs have been looked up already, so it's the runner's number which is taken.
+	if isUniqueViolation(err) {
+		return &InvalidArgumentError{
+			Field:       path + ".number",
+			Description: fmt.Sprintf("runner number %d is already held by another runner", runner.Number),
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	imp.record(racing.ImportEntity_IMPORT_ENTITY_RUNNER, runner.ExternalId, id, action, changed)
+
+	return nil
+}
+
+// setBrands restricts a race to being shown on the given brands, or on every brand when there are none.
+func (imp *cardImport) setBrands(raceID int64, brands []string) error {
+	queries := getRaceCardQueries()
+
+	if _, err := imp.tx.Exec(queries[raceBrandsDelete], raceID); err != nil {
+		return err
+	}
+
+	for _, brand := range brands {
+		if _, err := imp.tx.Exec(queries[raceBrandInsert], raceID, brand); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// raceByExternalID reads every field of the race with the given external ID, returning nil when there is none.
+func (imp *cardImport) raceByExternalID(externalID string) (*racing.Race, error) {
+	rows, err := imp.tx.Query(fmt.Sprintf(getRaceCardQueries()[raceByExternalID], selectList(raceColumns)), externalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	races, err := imp.r.scanRaces(rows, raceColumns)
+	if err != nil || len(races) == 0 {
+		return nil, err
+	}
+
+	return races[0], nil
+}
+
+// record notes a change made by the import. IDs of records a dry run would create are left out, as they won't be
+// the IDs the records are eventually given.
+func (imp *cardImport) record(entity racing.ImportEntity, externalID string, id int64, action racing.ImportAction, changed fieldChanges) {
+	if imp.dryRun && action == racing.ImportAction_IMPORT_ACTION_CREATED {
+		id = 0
+	}
+
+	change := &racing.ImportChange{
+		Entity:       entity,
+		ExternalId:   externalID,
+		Id:           id,
+		Action:       action,
+		FieldChanges: changed,
+	}
+	for _, fieldChange := range changed {
+		change.ChangedFields = append(change.ChangedFields, fieldChange.Field)
+	}
+
+	imp.changes = append(imp.changes, change)
+}
+
+// fieldChanges are the changes an update makes to the fields of a record.
+type fieldChanges []*racing.ImportFieldChange
+
+// compare notes a change to a field should its old and new values differ, reporting whether they do.
+func (c *fieldChanges) compare(field string, oldValue, newValue interface{}) bool {
+	o, n := formatFieldValue(oldValue), formatFieldValue(newValue)
+	if o == n {
+		return false
+	}
+
+	*c = append(*c, &racing.ImportFieldChange{Field: field, OldValue: o, NewValue: n})
+
+	return true
+}
+
+// formatFieldValue formats the value of a field as text, with times to the second in UTC and brands separated by
+// commas.
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(filterpkg.TimestampLayout)
+	case []string:
+		return strings.Join(v, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
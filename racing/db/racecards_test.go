@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// testCard returns a card holding a single race with two runners.
+func testCard() *racing.RaceCard {
+	start, _ := ptypes.TimestampProto(time.Date(2026, 10, 20, 4, 30, 0, 0, time.UTC))
+
+	return &racing.RaceCard{
+		Meetings: []*racing.RaceCardMeeting{{
+			ExternalId: "FLEM-20261020",
+			Name:       "Flemington",
+			RaceType:   racing.RaceType_RACE_TYPE_THOROUGHBRED,
+			Country:    "AU",
+			Races: []*racing.RaceCardRace{{
+				ExternalId:          "FLEM-20261020-R1",
+				Number:              1,
+				Name:                "Melbourne Cup",
+				AdvertisedStartTime: start,
+				Visible:             true,
+				Brands:              []string{"neds"},
+				Runners: []*racing.RaceCardRunner{
+					{ExternalId: "FLEM-20261020-R1-1", Number: 1, Name: "Vow And Declare"},
+					{ExternalId: "FLEM-20261020-R1-2", Number: 2, Name: "Verry Elleegant"},
+				},
+			}},
+		}},
+	}
+}
+
+// importCard imports a card, failing the test should the import fail.
+func importCard(t *testing.T, racesRepo RacesRepo, card *racing.RaceCard, dryRun bool) map[string]*racing.ImportChange {
+	t.Helper()
+
+	changes, err := racesRepo.Import(card, dryRun, time.Now())
+	if err != nil {
+		t.Fatalf("importing card: %s", err)
+	}
+
+	byExternalID := make(map[string]*racing.ImportChange, len(changes))
+	for _, change := range changes {
+		byExternalID[change.ExternalId] = change
+	}
+
+	return byExternalID
+}
+
+// runnerNumbers returns the numbers of the runners with the given external IDs.
+func runnerNumbers(t *testing.T, racingDB *sql.DB, externalIDs ...string) []int64 {
+	t.Helper()
+
+	numbers := make([]int64, len(externalIDs))
+	for i, externalID := range externalIDs {
+		if err := racingDB.QueryRow(`SELECT number FROM runners WHERE external_id = ?`, externalID).Scan(&numbers[i]); err != nil {
+			t.Fatalf("reading runner %s: %s", externalID, err)
+		}
+	}
+
+	return numbers
+}
+
+func TestImportCreatesThenLeavesUnchanged(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+
+	changes := importCard(t, racesRepo, testCard(), false)
+	if len(changes) != 4 {
+		t.Fatalf("got %d changes, want 4", len(changes))
+	}
+	for externalID, change := range changes {
+		if change.Action != racing.ImportAction_IMPORT_ACTION_CREATED || change.Id == 0 {
+			t.Errorf("%s got %v, want created with an ID", externalID, change)
+		}
+	}
+
+	race, err := racesRepo.Get(changes["FLEM-20261020-R1"].Id, nil)
+	if err != nil {
+		t.Fatalf("getting imported race: %s", err)
+	}
+	if race.Name != "Melbourne Cup" || race.Country != "AU" || len(race.Brands) != 1 || race.Brands[0] != "neds" {
+		t.Errorf("imported race is %v", race)
+	}
+
+	for externalID, change := range importCard(t, racesRepo, testCard(), false) {
+		if change.Action != racing.ImportAction_IMPORT_ACTION_UNCHANGED || change.Id != changes[externalID].Id {
+			t.Errorf("%s got %v on reimport, want unchanged", externalID, change)
+		}
+	}
+}
+
+func TestImportReportsOldAndNewValues(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+	importCard(t, racesRepo, testCard(), false)
+
+	card := testCard()
+	race := card.Meetings[0].Races[0]
+	race.Name = "The Melbourne Cup"
+	race.AdvertisedStartTime.Seconds += 600
+	race.Brands = []string{"neds", "ladbrokes"}
+	race.Runners[1].Scratched = true
+
+	changes := importCard(t, racesRepo, card, false)
+
+	want := map[string][]*racing.ImportFieldChange{
+		"FLEM-20261020": nil,
+		"FLEM-20261020-R1": {
+			{Field: "name", OldValue: "Melbourne Cup", NewValue: "The Melbourne Cup"},
+			{Field: "advertised_start_time", OldValue: "2026-10-20T04:30:00Z", NewValue: "2026-10-20T04:40:00Z"},
+			{Field: "brands", OldValue: "neds", NewValue: "ladbrokes,neds"},
+		},
+		"FLEM-20261020-R1-1": nil,
+		"FLEM-20261020-R1-2": {
+			{Field: "scratched", OldValue: "false", NewValue: "true"},
+		},
+	}
+
+	for externalID, fieldChanges := range want {
+		change := changes[externalID]
+
+		action := racing.ImportAction_IMPORT_ACTION_UNCHANGED
+		if len(fieldChanges) > 0 {
+			action = racing.ImportAction_IMPORT_ACTION_UPDATED
+		}
+		if change.Action != action {
+			t.Errorf("%s was %s, want %s", externalID, change.Action, action)
+		}
+
+		if len(change.FieldChanges) != len(fieldChanges) || len(change.ChangedFields) != len(fieldChanges) {
+			t.Errorf("%s changed %v, want %v", externalID, change.FieldChanges, fieldChanges)
+			continue
+		}
+		for i := range fieldChanges {
+			if !proto.Equal(change.FieldChanges[i], fieldChanges[i]) || change.ChangedFields[i] != fieldChanges[i].Field {
+				t.Errorf("%s changed %v, want %v", externalID, change.FieldChanges[i], fieldChanges[i])
+			}
+		}
+	}
+}
+
+func TestImportSwapsRunnerNumbers(t *testing.T) {
+	racingDB, racesRepo := openTestRepo(t)
+	importCard(t, racesRepo, testCard(), false)
+
+	card := testCard()
+	runners := card.Meetings[0].Races[0].Runners
+	runners[0].Number, runners[1].Number = 2, 1
+
+	changes := importCard(t, racesRepo, card, false)
+	if change := changes["FLEM-20261020-R1-1"]; len(change.FieldChanges) != 1 || change.FieldChanges[0].OldValue != "1" || change.FieldChanges[0].NewValue != "2" {
+		t.Errorf("first runner changed %v, want number 1 to 2", change.FieldChanges)
+	}
+
+	if numbers := runnerNumbers(t, racingDB, "FLEM-20261020-R1-1", "FLEM-20261020-R1-2"); numbers[0] != 2 || numbers[1] != 1 {
+		t.Errorf("runners have numbers %v, want [2 1]", numbers)
+	}
+}
+
+func TestImportRejectsTakenRunnerNumbers(t *testing.T) {
+	racingDB, racesRepo := openTestRepo(t)
+	importCard(t, racesRepo, testCard(), false)
+
+	tests := map[string]struct {
+		runners []*racing.RaceCardRunner
+		field   string
+	}{
+		"held by a runner missing from the card": {
+			runners: []*racing.RaceCardRunner{
+				{ExternalId: "FLEM-20261020-R1-1", Number: 3, Name: "Vow And Declare"},
+				{ExternalId: "FLEM-20261020-R1-3", Number: 2, Name: "Twilight Payment"},
+			},
+			field: "card.meetings[0].races[0].runners[1].number",
+		},
+		"given twice on the card": {
+			runners: []*racing.RaceCardRunner{
+				{ExternalId: "FLEM-20261020-R1-1", Number: 2, Name: "Vow And Declare"},
+				{ExternalId: "FLEM-20261020-R1-2", Number: 2, Name: "Verry Elleegant"},
+			},
+			field: "card.meetings[0].races[0].runners[1].number",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			card := testCard()
+			card.Meetings[0].Races[0].Runners = test.runners
+
+			_, err := racesRepo.Import(card, false, time.Now())
+
+			var invalid *InvalidArgumentError
+			if !errors.As(err, &invalid) || invalid.Field != test.field {
+				t.Fatalf("got error %v, want an invalid %s", err, test.field)
+			}
+
+			// Nothing the import changed before failing is kept.
+			if numbers := runnerNumbers(t, racingDB, "FLEM-20261020-R1-1", "FLEM-20261020-R1-2"); numbers[0] != 1 || numbers[1] != 2 {
+				t.Errorf("runners have numbers %v, want [1 2]", numbers)
+			}
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	racingDB, racesRepo := openTestRepo(t)
+
+	for externalID, change := range importCard(t, racesRepo, testCard(), true) {
+		if change.Action != racing.ImportAction_IMPORT_ACTION_CREATED || change.Id != 0 {
+			t.Errorf("%s got %v, want created without an ID", externalID, change)
+		}
+	}
+
+	var meetings int
+	if err := racingDB.QueryRow(`SELECT COUNT(*) FROM meetings`).Scan(&meetings); err != nil {
+		t.Fatalf("counting meetings: %s", err)
+	}
+	if meetings != 0 {
+		t.Errorf("dry run created %d meetings", meetings)
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/golang/protobuf/ptypes"
 	_ "github.com/mattn/go-sqlite3"
 
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
 	"git.neds.sh/matty/entain/racing/proto/racing"
 )
 
@@ -18,17 +20,88 @@ type RacesRepo interface {
 	Init() error
 
 	// List will return a list of races.
-	List(filter *racing.ListRacesRequestFilter) ([]*racing.Race, error)
+	List(query ListRacesQuery) ([]*racing.Race, error)
+
+	// Facets will return the number of races matching the query, along with counts of them by meeting, visibility
+	// and status. The query's limit, offset and fields are ignored.
+	Facets(query ListRacesQuery) (int32, *racing.RaceFacets, error)
+
+	// Get will return a single race, reading only the given fields, or every field when none are given.
+	Get(id int64, fields []string) (*racing.Race, error)
+
+	// Transition will move a race from one status to another, recording the change. ErrConflict is returned should
+	// the race no longer be in the status it's being moved from.
+	Transition(transition *racing.RaceStatusTransition) error
+
+	// Transitions will return the status changes recorded for a race, oldest first. ErrNotFound is returned should
+	// there be no such race.
+	Transitions(raceID int64) ([]*racing.RaceStatusTransition, error)
+
+	// Runners will return the runners of a race, in number order. ErrNotFound is returned should there be no such
+	// race among those the repository reads.
+	Runners(raceID int64) ([]*racing.Runner, error)
+
+	// GetMany will return the races with the given IDs in no particular order, leaving out those which don't exist.
+	// Only the given fields and the ID of each race are read, or every field when no fields are given.
+	GetMany(ids []int64, fields []string) ([]*racing.Race, error)
+
+	// Export will call fn with each race matching the query in turn, as they're read, stopping early should fn return
+	// an error. The query's limit and offset are ignored.
+	Export(query ListRacesQuery, fn func(race *racing.Race) error) error
+
+	// Revision will return the revision races are at, with the next start being the earliest advertised start time
+	// of the races with one of the given statuses.
+	Revision(statuses []racing.RaceStatus) (Revision, error)
+
+	// Scoped will return the repository with its reads of races limited to those within the scope. Races are
+	// changed, and revisions read, regardless of scope.
+	Scoped(scope BrandScope) RacesRepo
+
+	// Excluding will return the repository with the races matching the exclusion left out of its reads, alongside
+	// any it already leaves out.
+	Excluding(exclusion Exclusion) RacesRepo
+
+	// Import will create or update the meetings, races and runners of a race card, keyed on their external IDs, and
+	// return the changes made. A dry run returns the changes that would be made, without making them.
+	Import(card *racing.RaceCard, dryRun bool, importedAt time.Time) ([]*racing.ImportChange, error)
+}
+
+// ListRacesQuery describes which races a List call should return.
+type ListRacesQuery struct {
+	// Filter narrows down the races returned.
+	Filter *racing.ListRacesRequestFilter
+	// Expression further narrows down the races returned, using the AIP-160 filter language.
+	Expression string
+	// Limit caps the number of races returned, zero meaning no cap.
+	Limit int
+	// Offset skips over that many races before returning any.
+	Offset int
+	// ByStart orders races by their advertised start time, rather than by ID.
+	ByStart bool
+	// Fields lists the fields of each race to read, every field being read when empty.
+	Fields []string
+}
+
+// Revision identifies the state races are in, changing whenever any of them do.
+type Revision struct {
+	// Version increases with each change made to a race, as it's the ID of the latest race event recorded.
+	Version int64
+	// NextStart is the earliest advertised start time of the races asked about, or zero when there are none.
+	NextStart time.Time
 }
 
 type racesRepo struct {
-	db   *sql.DB
-	init sync.Once
+	db         *sql.DB
+	dummyData  bool
+	init       *sync.Once
+	scope      BrandScope
+	exclusions []Exclusion
 }
 
-// NewRacesRepo creates a new races repository.
-func NewRacesRepo(db *sql.DB) RacesRepo {
-	return &racesRepo{db: db}
+// NewRacesRepo creates a new races repository, which is seeded with dummy races when dummyData is set. It reads
+// races across every brand until scoped.
+func NewRacesRepo(db *sql.DB, dummyData bool) RacesRepo {
+	return &racesRepo{db: db, dummyData: dummyData, init: new(sync.Once), scope: AllBrands}
 }
 
 // Init prepares the race repository dummy data.
@@ -36,83 +109,740 @@ func (r *racesRepo) Init() error {
 	var err error
 
 	r.init.Do(func() {
+		if err = migrate(r.db); err != nil {
+			return
+		}
+
 		// For test/example purposes, we seed the DB with some dummy races.
-		err = r.seed()
+		if r.dummyData {
+			err = r.seed()
+		}
 	})
 
 	return err
 }
 
-func (r *racesRepo) List(filter *racing.ListRacesRequestFilter) ([]*racing.Race, error) {
+func (r *racesRepo) List(q ListRacesQuery) ([]*racing.Race, error) {
 	var (
 		err   error
 		query string
 		args  []interface{}
 	)
 
-	query = getRaceQueries()[racesList]
+	columns, err := selectColumns(q.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(getRaceQueries()[racesList], selectList(columns))
+
+	query, args, err = r.applyFilter(query, q.Filter, q.Expression)
+	if err != nil {
+		return nil, err
+	}
 
-	query, args = r.applyFilter(query, filter)
+	query, args = r.applyPaging(query, args, q.ByStart, q.Limit, q.Offset)
 
 	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	races, err := r.scanRaces(rows, columns)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return races, nil
+}
+
+func (r *racesRepo) Facets(q ListRacesQuery) (int32, *racing.RaceFacets, error) {
+	// Counts are made within a transaction, so that they all agree with one another.
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, wrapError(err)
+	}
+	defer tx.Rollback()
+
+	var (
+		total  int32
+		facets = &racing.RaceFacets{}
+	)
+
+	err = r.count(tx, q, "", func(rows *sql.Rows) error {
+		return rows.Scan(&total)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = r.count(tx, q, "meeting_id", func(rows *sql.Rows) error {
+		var facet racing.MeetingFacet
+		if err := rows.Scan(&facet.MeetingId, &facet.Count); err != nil {
+			return err
+		}
+
+		facets.Meetings = append(facets.Meetings, &facet)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = r.count(tx, q, "visible", func(rows *sql.Rows) error {
+		var facet racing.VisibleFacet
+		if err := rows.Scan(&facet.Visible, &facet.Count); err != nil {
+			return err
+		}
+
+		facets.Visible = append(facets.Visible, &facet)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = r.count(tx, q, "status", func(rows *sql.Rows) error {
+		var facet racing.StatusFacet
+		if err := rows.Scan(&facet.Status, &facet.Count); err != nil {
+			return err
+		}
+
+		facets.Statuses = append(facets.Statuses, &facet)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, facets, nil
+}
+
+// count counts the races matching the query, grouped by the given column unless it's empty, handing each row of
+// counts to scan in turn.
+func (r *racesRepo) count(tx *sql.Tx, q ListRacesQuery, groupBy string, scan func(rows *sql.Rows) error) error {
+	columns := "COUNT(*)"
+	if groupBy != "" {
+		columns = groupBy + ", " + columns
+	}
+
+	query, args, err := r.applyFilter(fmt.Sprintf(getRaceQueries()[racesList], columns), q.Filter, q.Expression)
+	if err != nil {
+		return err
+	}
+
+	if groupBy != "" {
+		query += " GROUP BY " + groupBy + " ORDER BY " + groupBy
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return wrapError(err)
+		}
+	}
+
+	return wrapError(rows.Err())
+}
+
+func (r *racesRepo) Export(q ListRacesQuery, fn func(race *racing.Race) error) error {
+	columns, err := selectColumns(q.Fields)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := r.applyFilter(fmt.Sprintf(getRaceQueries()[racesList], selectList(columns)), q.Filter, q.Expression)
+	if err != nil {
+		return err
+	}
+
+	query, args = r.applyPaging(query, args, q.ByStart, 0, 0)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer rows.Close()
+
+	// Races are handed over straight from the cursor, so that exports of any size are held in memory one at a time.
+	for rows.Next() {
+		race, err := r.scanRace(rows, columns)
+		if err != nil {
+			return wrapError(err)
+		}
+
+		if err := fn(race); err != nil {
+			return err
+		}
+	}
+
+	return wrapError(rows.Err())
+}
+
+func (r *racesRepo) Get(id int64, fields []string) (*racing.Race, error) {
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := r.applyScope(fmt.Sprintf(getRaceQueries()[raceGet], selectList(columns)), []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	races, err := r.scanRaces(rows, columns)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if len(races) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return races[0], nil
+}
+
+func (r *racesRepo) Revision(statuses []racing.RaceStatus) (Revision, error) {
+	placeholders := make([]string, len(statuses))
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		placeholders[i] = "?"
+		args[i] = status
+	}
+
+	var (
+		revision  Revision
+		nextStart sql.NullString
+	)
+
+	query := fmt.Sprintf(getRaceQueries()[racesRevision], strings.Join(placeholders, ", "))
+	if err := r.db.QueryRow(query, args...).Scan(&revision.Version, &nextStart); err != nil {
+		return Revision{}, wrapError(err)
+	}
+
+	// Aggregates lose the declared type of their column, so come back as text rather than a time.
+	if nextStart.Valid {
+		t, err := time.Parse(filterpkg.TimestampLayout, nextStart.String)
+		if err != nil {
+			return Revision{}, err
+		}
+
+		revision.NextStart = t
+	}
+
+	return revision, nil
+}
+
+func (r *racesRepo) Transition(transition *racing.RaceStatusTransition) error {
+	transitionedAt, err := ptypes.Timestamp(transition.TransitionedAt)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return wrapError(err)
+	}
+	defer tx.Rollback()
+
+	queries := getRaceQueries()
+
+	// Only move the race on should nothing else have moved it since its status was read.
+	res, err := tx.Exec(queries[raceSetStatus], transition.To, transition.RaceId, transition.From)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return wrapError(err)
+	}
+
+	if updated == 0 {
+		var current racing.RaceStatus
+		err := tx.QueryRow(queries[raceStatus], transition.RaceId).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+
+		return ErrConflict
+	}
+
+	_, err = tx.Exec(
+		queries[raceTransitionAdd],
+		transition.RaceId,
+		transition.From,
+		transition.To,
+		transition.Actor,
+		transition.Reason,
+		transitionedAt.UTC().Format(filterpkg.TimestampLayout),
+	)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	race, err := r.getRace(tx, transition.RaceId)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	err = addEvent(tx, &racing.RaceEvent{
+		Type:       racing.RaceEventType_RACE_EVENT_TYPE_STATUS_CHANGED,
+		RaceId:     transition.RaceId,
+		Race:       race,
+		Transition: transition,
+		OccurredAt: transition.TransitionedAt,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return wrapError(tx.Commit())
+}
+
+func (r *racesRepo) Transitions(raceID int64) ([]*racing.RaceStatusTransition, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer tx.Rollback()
+
+	queries := getRaceQueries()
+
+	var current racing.RaceStatus
+	err = tx.QueryRow(queries[raceStatus], raceID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	rows, err := tx.Query(queries[raceTransitions], raceID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var transitions []*racing.RaceStatusTransition
+	for rows.Next() {
+		var (
+			transition     racing.RaceStatusTransition
+			transitionedAt time.Time
+		)
+		err := rows.Scan(
+			&transition.RaceId,
+			&transition.From,
+			&transition.To,
+			&transition.Actor,
+			&transition.Reason,
+			&transitionedAt,
+		)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		if transition.TransitionedAt, err = ptypes.TimestampProto(transitionedAt); err != nil {
+			return nil, err
+		}
+
+		transitions = append(transitions, &transition)
+	}
+
+	return transitions, wrapError(rows.Err())
+}
+
+func (r *racesRepo) Runners(raceID int64) ([]*racing.Runner, error) {
+	// The race is read first, so that the runners of races out of scope or excluded aren't found either.
+	if _, err := r.Get(raceID, []string{"id"}); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(getRaceQueries()[raceRunners], raceID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	var runners []*racing.Runner
+	for rows.Next() {
+		var runner racing.Runner
+		if err := rows.Scan(&runner.Number, &runner.Name, &runner.Scratched); err != nil {
+			return nil, wrapError(err)
+		}
+
+		runners = append(runners, &runner)
+	}
+
+	return runners, wrapError(rows.Err())
+}
+
+// getRace reads every field of a race within a transaction.
+func (r *racesRepo) getRace(tx *sql.Tx, id int64) (*racing.Race, error) {
+	rows, err := tx.Query(fmt.Sprintf(getRaceQueries()[raceGet], selectList(raceColumns)), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	races, err := r.scanRaces(rows, raceColumns)
 	if err != nil {
 		return nil, err
 	}
 
-	return r.scanRaces(rows)
+	if len(races) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return races[0], nil
 }
 
-func (r *racesRepo) applyFilter(query string, filter *racing.ListRacesRequestFilter) (string, []interface{}) {
+func (r *racesRepo) GetMany(ids []int64, fields []string) ([]*racing.Race, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Races are matched back up with their IDs, so the ID is always read.
+	if len(fields) > 0 {
+		fields = append([]string{"id"}, fields...)
+	}
+
+	columns, err := selectColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	query, args, err := r.applyScope(fmt.Sprintf(getRaceQueries()[racesGetMany], selectList(columns), placeholders), args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer rows.Close()
+
+	races, err := r.scanRaces(rows, columns)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return races, nil
+}
+
+func (r *racesRepo) Scoped(scope BrandScope) RacesRepo {
+	scoped := *r
+	scoped.scope = scope
+
+	return &scoped
+}
+
+func (r *racesRepo) Excluding(exclusion Exclusion) RacesRepo {
+	if exclusion.Expr == nil {
+		return r
+	}
+
+	excluding := *r
+	excluding.exclusions = append(append([]Exclusion(nil), r.exclusions...), exclusion)
+
+	return &excluding
+}
+
+// ValidateRaceFields checks that each of the given fields can be read from a race.
+func ValidateRaceFields(fields []string) error {
+	_, err := selectColumns(fields)
+	return err
+}
+
+// selectColumns returns the columns needed to read the given fields of a race, or every column when none are given.
+func selectColumns(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return raceColumns, nil
+	}
+
+	needed := make(map[string]bool)
+	for _, field := range fields {
+		columns, ok := raceFieldColumns[field]
+		if !ok {
+			return nil, &InvalidArgumentError{Field: "read_mask", Description: fmt.Sprintf("races have no field %q", field)}
+		}
+
+		for _, column := range columns {
+			needed[column] = true
+		}
+	}
+
+	var columns []string
+	for _, column := range raceColumns {
+		if needed[column] {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns, nil
+}
+
+// selectList returns the list of expressions the given columns of races are selected with.
+func selectList(columns []string) string {
+	exprs := make([]string, len(columns))
+	for i, column := range columns {
+		if expr, ok := raceColumnExprs[column]; ok {
+			column = expr
+		}
+
+		exprs[i] = column
+	}
+
+	return strings.Join(exprs, ", ")
+}
+
+// applyFilter narrows the query down to the races matching both the structured filter and the filter expression.
+func (r *racesRepo) applyFilter(query string, filter *racing.ListRacesRequestFilter, expression string) (string, []interface{}, error) {
+	parsed, err := filterpkg.Parse(expression)
+	if err != nil {
+		return "", nil, &InvalidArgumentError{Field: "filter_expression", Description: err.Error()}
+	}
+
+	structured, err := structuredFilter(filter, time.Now())
+	if err != nil {
+		return "", nil, err
+	}
+
+	clause, args, err := filterpkg.Compile(filterpkg.AllOf(structured, parsed), raceFilterSchema)
+	if err != nil {
+		return "", nil, &InvalidArgumentError{Field: "filter_expression", Description: err.Error()}
+	}
+
+	scope, scopeArgs, err := r.scopeClause()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scope != "" {
+		if clause != "" {
+			clause = "(" + clause + ") AND "
+		}
+		clause += scope
+		args = append(args, scopeArgs...)
+	}
+
+	if clause != "" {
+		query += " WHERE " + clause
+	}
+
+	return query, args, nil
+}
+
+// applyScope narrows a query, which must already have a WHERE clause, down to the races within the repository's
+// scope.
+func (r *racesRepo) applyScope(query string, args []interface{}) (string, []interface{}, error) {
+	scope, scopeArgs, err := r.scopeClause()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scope != "" {
+		query += " AND " + scope
+		args = append(args, scopeArgs...)
+	}
+
+	return query, args, nil
+}
+
+// scopeClause returns the condition matching the races within the repository's scope and not excluded from it,
+// which is empty when it's for all brands and excludes none.
+func (r *racesRepo) scopeClause() (string, []interface{}, error) {
 	var (
 		clauses []string
 		args    []interface{}
 	)
 
+	if !r.scope.All {
+		clauses = append(clauses, strings.TrimSpace(getRaceQueries()[raceBrandScope]))
+		args = append(args, r.scope.Brand)
+	}
+
+	for _, exclusion := range r.exclusions {
+		clause, exclusionArgs, err := filterpkg.Compile(exclusion.Expr, raceFilterSchema)
+		if err != nil {
+			return "", nil, fmt.Errorf("compiling exclusion %s: %w", exclusion.Name, err)
+		}
+
+		if clause != "" {
+			clauses = append(clauses, "NOT ("+clause+")")
+			args = append(args, exclusionArgs...)
+		}
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+// structuredFilter expresses the fields of a ListRacesRequestFilter as a filter expression, with relative times
+// taken from now.
+func structuredFilter(filter *racing.ListRacesRequestFilter, now time.Time) (filterpkg.Expr, error) {
 	if filter == nil {
-		return query, args
+		return nil, nil
+	}
+
+	var meetings []filterpkg.Expr
+	for _, meetingID := range filter.MeetingIds {
+		meetings = append(meetings, filterpkg.Compare("meeting_id", filterpkg.Equal, filterpkg.Int(meetingID)))
 	}
 
-	if len(filter.MeetingIds) > 0 {
-		clauses = append(clauses, "meeting_id IN ("+strings.Repeat("?,", len(filter.MeetingIds)-1)+"?)")
+	terms := []filterpkg.Expr{filterpkg.AnyOf(meetings...)}
 
-		for _, meetingID := range filter.MeetingIds {
-			args = append(args, meetingID)
+	if filter.AdvertisedStartTimeFrom != nil {
+		from, err := ptypes.Timestamp(filter.AdvertisedStartTimeFrom)
+		if err != nil {
+			return nil, &InvalidArgumentError{Field: "filter.advertised_start_time_from", Description: err.Error()}
 		}
+
+		terms = append(terms, startsAt(filterpkg.GreaterOrEqual, from))
 	}
 
-	if len(clauses) != 0 {
-		query += " WHERE " + strings.Join(clauses, " AND ")
+	if filter.AdvertisedStartTimeTo != nil {
+		to, err := ptypes.Timestamp(filter.AdvertisedStartTimeTo)
+		if err != nil {
+			return nil, &InvalidArgumentError{Field: "filter.advertised_start_time_to", Description: err.Error()}
+		}
+
+		terms = append(terms, startsAt(filterpkg.Less, to))
+	}
+
+	if filter.StartsWithin != nil {
+		within, err := ptypes.Duration(filter.StartsWithin)
+		if err != nil || within < 0 {
+			return nil, &InvalidArgumentError{Field: "filter.starts_within", Description: "must be a positive duration"}
+		}
+
+		terms = append(terms, startsAt(filterpkg.GreaterOrEqual, now), startsAt(filterpkg.LessOrEqual, now.Add(within)))
+	}
+
+	return filterpkg.AllOf(terms...), nil
+}
+
+// startsAt compares the advertised start time of races against t, which the advertised start time index serves.
+func startsAt(op filterpkg.Operator, t time.Time) filterpkg.Expr {
+	return filterpkg.Compare("advertised_start_time", op, filterpkg.Time(t))
+}
+
+// applyPaging orders the query by race ID so that pages are stable, first ordering by advertised start time when
+// byStart is set, and limits it to the requested window.
+func (r *racesRepo) applyPaging(query string, args []interface{}, byStart bool, limit, offset int) (string, []interface{}) {
+	if byStart {
+		query += " ORDER BY advertised_start_time, id"
+	} else {
+		query += " ORDER BY id"
+	}
+
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	} else if offset > 0 {
+		// SQLite only accepts an OFFSET alongside a LIMIT, where a negative LIMIT means no limit.
+		query += " LIMIT -1 OFFSET ?"
+		args = append(args, offset)
 	}
 
 	return query, args
 }
 
+// scanRaces reads races from rows holding the given columns.
 func (m *racesRepo) scanRaces(
 	rows *sql.Rows,
+	columns []string,
 ) ([]*racing.Race, error) {
 	var races []*racing.Race
 
 	for rows.Next() {
-		var race racing.Race
-		var advertisedStart time.Time
+		race, err := m.scanRace(rows, columns)
+		if err != nil {
+			return nil, err
+		}
 
-		if err := rows.Scan(&race.Id, &race.MeetingId, &race.Name, &race.Number, &race.Visible, &advertisedStart); err != nil {
-			if err == sql.ErrNoRows {
-				return nil, nil
-			}
+		races = append(races, race)
+	}
 
-			return nil, err
+	return races, rows.Err()
+}
+
+// scanRace reads the race in the current row of rows holding the given columns.
+func (m *racesRepo) scanRace(
+	rows *sql.Rows,
+	columns []string,
+) (*racing.Race, error) {
+	var race racing.Race
+	var advertisedStart *time.Time
+	var brands *sql.NullString
+
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = &race.Id
+		case "meeting_id":
+			dest[i] = &race.MeetingId
+		case "name":
+			dest[i] = &race.Name
+		case "number":
+			dest[i] = &race.Number
+		case "visible":
+			dest[i] = &race.Visible
+		case "advertised_start_time":
+			advertisedStart = new(time.Time)
+			dest[i] = advertisedStart
+		case "race_type":
+			dest[i] = &race.RaceType
+		case "status":
+			dest[i] = &race.Status
+		case "brands":
+			brands = new(sql.NullString)
+			dest[i] = brands
+		case "country":
+			dest[i] = &race.Country
+		default:
+			return nil, fmt.Errorf("unknown race column %q", column)
 		}
+	}
 
-		ts, err := ptypes.TimestampProto(advertisedStart)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if advertisedStart != nil {
+		ts, err := ptypes.TimestampProto(*advertisedStart)
 		if err != nil {
 			return nil, err
 		}
 
 		race.AdvertisedStartTime = ts
+	}
 
-		races = append(races, &race)
+	if brands != nil {
+		race.Brands = splitBrands(brands.String)
 	}
 
-	return races, nil
+	return &race, nil
 }
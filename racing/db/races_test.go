@@ -0,0 +1,286 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// openTestDB opens a scratch database without migrating it.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	racingDB, err := Open(filepath.Join(t.TempDir(), "racing.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { racingDB.Close() })
+
+	return racingDB
+}
+
+// openTestRepo opens a races repository over a scratch database, seeded with 100 dummy races with IDs 1 to 100.
+func openTestRepo(t *testing.T) (*sql.DB, RacesRepo) {
+	t.Helper()
+
+	racingDB := openTestDB(t)
+
+	racesRepo := NewRacesRepo(racingDB, true)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("initialising races: %s", err)
+	}
+
+	return racingDB, racesRepo
+}
+
+func TestMigrationFinalisesPastRaces(t *testing.T) {
+	racingDB := openTestDB(t)
+
+	backfill := -1
+	for i, migration := range migrations {
+		if strings.HasPrefix(migration, "INSERT INTO race_status_transitions") {
+			backfill = i
+		}
+	}
+	if backfill < 0 {
+		t.Fatal("backfill migration not found")
+	}
+
+	for i := 0; i < backfill; i++ {
+		if err := applyMigration(racingDB, i); err != nil {
+			t.Fatalf("applying migration %d: %s", i+1, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	starts := map[int64]time.Time{
+		1: now.AddDate(0, 0, -3),
+		2: now.Add(-time.Hour),
+		3: now.Add(time.Hour),
+	}
+	for id, start := range starts {
+		_, err := racingDB.Exec(
+			`INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type) VALUES (?,1,'',1,1,?,1)`,
+			id,
+			start.Format(time.RFC3339),
+		)
+		if err != nil {
+			t.Fatalf("inserting race %d: %s", id, err)
+		}
+	}
+
+	// A race moved on already keeps its status.
+	if _, err := racingDB.Exec(`INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type, status) VALUES (4,1,'',1,1,?,1,7)`, now.AddDate(0, 0, -3).Format(time.RFC3339)); err != nil {
+		t.Fatalf("inserting race 4: %s", err)
+	}
+
+	racesRepo := NewRacesRepo(racingDB, false)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("migrating: %s", err)
+	}
+
+	want := map[int64]racing.RaceStatus{
+		1: racing.RaceStatus_RACE_STATUS_FINAL,
+		2: racing.RaceStatus_RACE_STATUS_OPEN,
+		3: racing.RaceStatus_RACE_STATUS_OPEN,
+		4: racing.RaceStatus_RACE_STATUS_ABANDONED,
+	}
+	for id, status := range want {
+		race, err := racesRepo.Get(id, []string{"status"})
+		if err != nil {
+			t.Fatalf("getting race %d: %s", id, err)
+		}
+		if race.Status != status {
+			t.Errorf("race %d has status %s, want %s", id, race.Status, status)
+		}
+
+		transitions, err := racesRepo.Transitions(id)
+		if err != nil {
+			t.Fatalf("listing transitions of race %d: %s", id, err)
+		}
+
+		recorded := status == racing.RaceStatus_RACE_STATUS_FINAL
+		if got := len(transitions) == 1; got != recorded {
+			t.Fatalf("race %d has transitions %v, want recorded %t", id, transitions, recorded)
+		}
+		if recorded && (transitions[0].From != racing.RaceStatus_RACE_STATUS_OPEN || transitions[0].To != status || transitions[0].Actor != "migration") {
+			t.Errorf("race %d has transition %v", id, transitions[0])
+		}
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+
+	race, err := racesRepo.Get(1, []string{"status"})
+	if err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	steps := []racing.RaceStatus{racing.RaceStatus_RACE_STATUS_SUSPENDED, racing.RaceStatus_RACE_STATUS_ABANDONED}
+
+	from := race.Status
+	for i, to := range steps {
+		transitionedAt, _ := ptypes.TimestampProto(at.Add(time.Duration(i) * time.Minute))
+
+		err := racesRepo.Transition(&racing.RaceStatusTransition{
+			RaceId:         1,
+			From:           from,
+			To:             to,
+			Actor:          "steward",
+			Reason:         "weather",
+			TransitionedAt: transitionedAt,
+		})
+		if err != nil {
+			t.Fatalf("moving race to %s: %s", to, err)
+		}
+
+		from = to
+	}
+
+	transitions, err := racesRepo.Transitions(1)
+	if err != nil {
+		t.Fatalf("listing transitions: %s", err)
+	}
+	if len(transitions) != len(steps) {
+		t.Fatalf("got %d transitions, want %d", len(transitions), len(steps))
+	}
+
+	for i, transition := range transitions {
+		transitionedAt, err := ptypes.Timestamp(transition.TransitionedAt)
+		if err != nil {
+			t.Fatalf("reading transition time: %s", err)
+		}
+
+		if transition.To != steps[i] || transition.Actor != "steward" || !transitionedAt.Equal(at.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("transition %d is %v", i, transition)
+		}
+	}
+
+	if transitions, err := racesRepo.Transitions(2); err != nil || len(transitions) != 0 {
+		t.Errorf("race without transitions got %v, %v", transitions, err)
+	}
+
+	if _, err := racesRepo.Transitions(1000); err != ErrNotFound {
+		t.Errorf("missing race got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRunners(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+
+	// Dummy races are seeded with runners.
+	runners, err := racesRepo.Runners(1)
+	if err != nil {
+		t.Fatalf("listing runners: %s", err)
+	}
+	if len(runners) != dummyRunners || runners[0].Number != 1 || runners[dummyRunners-1].Number != dummyRunners {
+		t.Errorf("dummy race has runners %v", runners)
+	}
+
+	card := testCard()
+	race := card.Meetings[0].Races[0]
+	race.Runners[0].Number, race.Runners[1].Number = 3, 1
+	race.Runners[0].Scratched = true
+	id := importCard(t, racesRepo, card, false)["FLEM-20261020-R1"].Id
+
+	runners, err = racesRepo.Runners(id)
+	if err != nil {
+		t.Fatalf("listing runners: %s", err)
+	}
+	if len(runners) != 2 || runners[0].Number != 1 || runners[0].Name != "Verry Elleegant" || runners[0].Scratched ||
+		runners[1].Number != 3 || !runners[1].Scratched {
+		t.Errorf("imported race has runners %v, want them in number order", runners)
+	}
+
+	// The runners of races the repository doesn't read aren't found either.
+	if _, err := racesRepo.Scoped(ForBrand("ladbrokes")).Runners(id); err != ErrNotFound {
+		t.Errorf("listing runners of a race of another brand got %v, want ErrNotFound", err)
+	}
+	if _, err := racesRepo.Runners(1000); err != ErrNotFound {
+		t.Errorf("listing runners of a missing race got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMigrationGivesDummyRacesRunners(t *testing.T) {
+	racingDB := openTestDB(t)
+
+	backfill := -1
+	for i, migration := range migrations {
+		if strings.Contains(migration, "INSERT INTO runners") {
+			backfill = i
+		}
+	}
+	if backfill < 0 {
+		t.Fatal("backfill migration not found")
+	}
+
+	for i := 0; i < backfill; i++ {
+		if err := applyMigration(racingDB, i); err != nil {
+			t.Fatalf("applying migration %d: %s", i+1, err)
+		}
+	}
+
+	for id, externalID := range map[int64]interface{}{1: nil, 2: "FLEM-20261020-R1"} {
+		_, err := racingDB.Exec(
+			`INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type, external_id) VALUES (?,1,'',1,1,'2026-10-20T04:30:00Z',1,?)`,
+			id,
+			externalID,
+		)
+		if err != nil {
+			t.Fatalf("inserting race %d: %s", id, err)
+		}
+	}
+
+	racesRepo := NewRacesRepo(racingDB, false)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("migrating: %s", err)
+	}
+
+	for id, want := range map[int64]int{1: dummyRunners, 2: 0} {
+		runners, err := racesRepo.Runners(id)
+		if err != nil {
+			t.Fatalf("listing runners of race %d: %s", id, err)
+		}
+		if len(runners) != want {
+			t.Errorf("race %d has %d runners, want %d", id, len(runners), want)
+		}
+	}
+}
+
+func TestExportDoesNotHoldUpWrites(t *testing.T) {
+	_, racesRepo := openTestRepo(t)
+
+	// Races change while a slow client is still being sent them, without waiting for the export to finish.
+	exported := 0
+	err := racesRepo.Export(ListRacesQuery{}, func(race *racing.Race) error {
+		if exported == 0 {
+			start := time.Now()
+			transition(t, racesRepo, 100, racing.RaceStatus_RACE_STATUS_CLOSED)
+
+			if took := time.Since(start); took > busyTimeout/2 {
+				t.Errorf("write took %s during an export", took)
+			}
+		}
+
+		exported++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exporting races: %s", err)
+	}
+
+	if exported != 100 {
+		t.Errorf("exported %d races, want 100", exported)
+	}
+	if status := getStatus(t, racesRepo, 100); status != racing.RaceStatus_RACE_STATUS_CLOSED {
+		t.Errorf("race 100 has status %s, want CLOSED", status)
+	}
+}
@@ -0,0 +1,187 @@
+// Package errs maps errors raised within the racing service onto gRPC statuses, following the rich error model.
+//
+// Every status carries a google.rpc.ErrorInfo detail with a machine readable reason, and argument errors also carry
+// a google.rpc.BadRequest detail naming the offending fields. Messages never include the underlying error text, as
+// that may leak SQL or other internals to clients.
+package errs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/db"
+)
+
+// Domain is the ErrorInfo domain of errors raised by the racing service.
+const Domain = "racing.entain"
+
+// Reasons reported in the ErrorInfo detail of an error.
+const (
+	ReasonNotFound          = "NOT_FOUND"
+	ReasonInvalidArgument   = "INVALID_ARGUMENT"
+	ReasonUnavailable       = "BACKEND_UNAVAILABLE"
+	ReasonDeadlineExceeded  = "DEADLINE_EXCEEDED"
+	ReasonCanceled          = "CANCELED"
+	ReasonInternal          = "INTERNAL"
+	ReasonConflict          = "CONFLICT"
+	ReasonRateLimited       = "RATE_LIMITED"
+	ReasonIllegalTransition = "ILLEGAL_TRANSITION"
+)
+
+// FieldViolation describes a single invalid request field.
+type FieldViolation struct {
+	// Field is the path of the invalid field, such as "filter.meeting_ids".
+	Field string
+	// Description explains why the field is invalid.
+	Description string
+}
+
+// InvalidArgument returns an InvalidArgument status reporting a single invalid field.
+func InvalidArgument(field, description string) error {
+	return InvalidArguments(FieldViolation{Field: field, Description: description})
+}
+
+// InvalidArguments returns an InvalidArgument status reporting each of the given invalid fields.
+func InvalidArguments(violations ...FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	message := "request is invalid"
+	if len(violations) == 1 {
+		message = violations[0].Field + ": " + violations[0].Description
+	}
+
+	return newStatus(codes.InvalidArgument, message, ReasonInvalidArgument, nil, badRequest)
+}
+
+// NotFound returns a NotFound status for the given resource, such as "race", and its ID.
+func NotFound(resource, id string) error {
+	return newStatus(codes.NotFound, resource+" not found", ReasonNotFound, map[string]string{
+		"resource": resource,
+		"id":       id,
+	})
+}
+
+// FailedPrecondition returns a FailedPrecondition status for the given reason, such as "ILLEGAL_TRANSITION",
+// describing the precondition the subject failed.
+func FailedPrecondition(reason, subject, description string, metadata map[string]string) error {
+	failure := &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        reason,
+			Subject:     subject,
+			Description: description,
+		}},
+	}
+
+	return newStatus(codes.FailedPrecondition, description, reason, metadata, failure)
+}
+
+// ResourceExhausted returns a ResourceExhausted status for a call over its rate limit, telling the caller how long
+// to wait before retrying.
+func ResourceExhausted(description string, retryDelay time.Duration) error {
+	return newStatus(codes.ResourceExhausted, description, ReasonRateLimited, nil, &errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(retryDelay),
+	})
+}
+
+// FromRepo maps an error returned by a repository onto a gRPC status. Errors which are already a status are
+// returned unchanged.
+func FromRepo(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var invalidArg *db.InvalidArgumentError
+	switch {
+	case errors.As(err, &invalidArg):
+		return InvalidArgument(invalidArg.Field, invalidArg.Description)
+	case errors.Is(err, db.ErrNotFound):
+		return newStatus(codes.NotFound, "not found", ReasonNotFound, nil)
+	case errors.Is(err, db.ErrConflict):
+		return newStatus(codes.Aborted, "conflicting change, retry", ReasonConflict, nil)
+	case errors.Is(err, db.ErrUnavailable):
+		return newStatus(codes.Unavailable, "service temporarily unavailable", ReasonUnavailable, nil)
+	case errors.Is(err, context.DeadlineExceeded):
+		return newStatus(codes.DeadlineExceeded, "deadline exceeded", ReasonDeadlineExceeded, nil)
+	case errors.Is(err, context.Canceled):
+		return newStatus(codes.Canceled, "request canceled", ReasonCanceled, nil)
+	}
+
+	return newStatus(codes.Internal, "internal error", ReasonInternal, nil)
+}
+
+// UnaryServerInterceptor maps any error returned by a handler onto a gRPC status via FromRepo, logging the
+// original error where it would otherwise be lost.
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		err = mapAndLog(info.FullMethod, err)
+	}
+
+	return resp, err
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	err := handler(srv, ss)
+	if err != nil {
+		err = mapAndLog(info.FullMethod, err)
+	}
+
+	return err
+}
+
+func mapAndLog(method string, err error) error {
+	mapped := FromRepo(err)
+
+	if code := status.Code(mapped); code == codes.Internal || code == codes.Unavailable {
+		log.Printf("%s failed: %s\n", method, err)
+	}
+
+	return mapped
+}
+
+func newStatus(code codes.Code, message, reason string, metadata map[string]string, details ...proto.Message) error {
+	st := status.New(code, message)
+
+	info := &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   Domain,
+		Metadata: metadata,
+	}
+
+	withDetails, err := st.WithDetails(append([]proto.Message{info}, details...)...)
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,144 @@
+// Package filter implements the subset of the AIP-160 filtering language used by list calls, such as:
+//
+//	visible = true AND advertised_start_time > "2026-10-16T00:00:00Z" AND number <= 4
+//
+// Expressions are parsed into an AST, which is then validated against a Schema of the fields that may be filtered
+// on and compiled into a parameterised SQL clause.
+//
+// See: https://google.aip.dev/160
+package filter
+
+import (
+	"strconv"
+	"time"
+)
+
+// Expr is a node of a filter expression.
+type Expr interface {
+	expr()
+}
+
+// And matches when all of its terms match.
+type And struct {
+	Terms []Expr
+}
+
+// Or matches when any of its terms match.
+type Or struct {
+	Terms []Expr
+}
+
+// Not matches when its term does not.
+type Not struct {
+	Term Expr
+}
+
+// Comparison compares a field against a literal value, such as `number <= 4`.
+type Comparison struct {
+	// Field is the name of the field being compared.
+	Field string
+	// Op is the comparison operator.
+	Op Operator
+	// Value is the literal the field is compared against.
+	Value Literal
+	// Pos is the offset of the comparison within the parsed expression.
+	Pos int
+}
+
+func (*And) expr()        {}
+func (*Or) expr()         {}
+func (*Not) expr()        {}
+func (*Comparison) expr() {}
+
+// Operator is a comparison operator.
+type Operator string
+
+// Supported comparison operators.
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "!="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+	Has            Operator = ":"
+)
+
+// LiteralKind is the lexical kind of a literal.
+type LiteralKind int
+
+// Kinds of literal.
+const (
+	// TextLiteral is an unquoted word, such as true.
+	TextLiteral LiteralKind = iota
+	// StringLiteral is a quoted string.
+	StringLiteral
+	// NumberLiteral is a number.
+	NumberLiteral
+)
+
+// Literal is a value appearing in an expression. It is only given a type once compared against a field.
+type Literal struct {
+	Kind LiteralKind
+	Text string
+}
+
+// Int returns a number literal.
+func Int(v int64) Literal {
+	return Literal{Kind: NumberLiteral, Text: strconv.FormatInt(v, 10)}
+}
+
+// Bool returns a boolean literal.
+func Bool(v bool) Literal {
+	return Literal{Kind: TextLiteral, Text: strconv.FormatBool(v)}
+}
+
+// String returns a string literal.
+func String(v string) Literal {
+	return Literal{Kind: StringLiteral, Text: v}
+}
+
+// Enum returns an enum value literal, such as RACE_STATUS_OPEN.
+func Enum(name string) Literal {
+	return Literal{Kind: TextLiteral, Text: name}
+}
+
+// Time returns a timestamp literal.
+func Time(v time.Time) Literal {
+	return Literal{Kind: StringLiteral, Text: v.UTC().Format(time.RFC3339Nano)}
+}
+
+// Compare returns a comparison of the given field against a value.
+func Compare(field string, op Operator, value Literal) *Comparison {
+	return &Comparison{Field: field, Op: op, Value: value}
+}
+
+// AllOf returns an expression matching when every given expression matches, ignoring nil expressions.
+// It returns nil when there is nothing to match on.
+func AllOf(exprs ...Expr) Expr {
+	return join(exprs, func(terms []Expr) Expr { return &And{Terms: terms} })
+}
+
+// AnyOf returns an expression matching when any given expression matches, ignoring nil expressions.
+// It returns nil when there is nothing to match on.
+func AnyOf(exprs ...Expr) Expr {
+	return join(exprs, func(terms []Expr) Expr { return &Or{Terms: terms} })
+}
+
+func join(exprs []Expr, fn func([]Expr) Expr) Expr {
+	var terms []Expr
+	for _, e := range exprs {
+		if e != nil {
+			terms = append(terms, e)
+		}
+	}
+
+	switch len(terms) {
+	case 0:
+		return nil
+	case 1:
+		return terms[0]
+	}
+
+	return fn(terms)
+}
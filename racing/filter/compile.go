@@ -0,0 +1,198 @@
+package filter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a filterable field.
+type Type int
+
+// Types of filterable field.
+const (
+	IntType Type = iota
+	BoolType
+	StringType
+	TimestampType
+	EnumType
+)
+
+// TimestampLayout is the layout timestamps are stored in, and so compared against. Timestamps are compared to the
+// second, with bounds between seconds rounded so that comparisons hold as they would for the exact time.
+const TimestampLayout = "2006-01-02T15:04:05Z"
+
+// Field describes a filterable field.
+type Field struct {
+	// Column is the SQL expression the field maps onto.
+	Column string
+	// Type is the type of the field.
+	Type Type
+	// Values maps the names of an enum field's values onto the numbers they're stored as.
+	Values map[string]int32
+}
+
+// Schema maps the names of the fields which may be filtered on to their description.
+type Schema map[string]Field
+
+// Compile validates an expression against the schema, and compiles it into a parameterised SQL clause suitable for
+// use in a WHERE clause. A nil expression compiles to an empty clause.
+func Compile(expr Expr, schema Schema) (string, []interface{}, error) {
+	if expr == nil {
+		return "", nil, nil
+	}
+
+	c := &compiler{schema: schema}
+	if err := c.compile(expr); err != nil {
+		return "", nil, err
+	}
+
+	return c.sql.String(), c.args, nil
+}
+
+type compiler struct {
+	schema Schema
+	sql    strings.Builder
+	args   []interface{}
+}
+
+func (c *compiler) compile(expr Expr) error {
+	switch e := expr.(type) {
+	case *And:
+		return c.compileTerms(e.Terms, " AND ")
+	case *Or:
+		return c.compileTerms(e.Terms, " OR ")
+	case *Not:
+		c.sql.WriteString("NOT ")
+		return c.compileTerms([]Expr{e.Term}, "")
+	case *Comparison:
+		return c.compileComparison(e)
+	}
+
+	return errorf(0, "unsupported expression %T", expr)
+}
+
+func (c *compiler) compileTerms(terms []Expr, sep string) error {
+	c.sql.WriteString("(")
+	for i, term := range terms {
+		if i > 0 {
+			c.sql.WriteString(sep)
+		}
+
+		if err := c.compile(term); err != nil {
+			return err
+		}
+	}
+	c.sql.WriteString(")")
+
+	return nil
+}
+
+func (c *compiler) compileComparison(cmp *Comparison) error {
+	field, ok := c.schema[cmp.Field]
+	if !ok {
+		return errorf(cmp.Pos, "cannot filter on %q, must be one of %s", cmp.Field, strings.Join(c.schema.names(), ", "))
+	}
+
+	switch cmp.Op {
+	case Equal, NotEqual:
+	case Less, LessOrEqual, Greater, GreaterOrEqual:
+		if field.Type == BoolType || field.Type == EnumType {
+			return errorf(cmp.Pos, "%q can only be compared with = or !=", cmp.Field)
+		}
+	default:
+		return errorf(cmp.Pos, "operator %q is not supported", cmp.Op)
+	}
+
+	arg, err := convert(cmp, field)
+	if err != nil {
+		return err
+	}
+
+	c.sql.WriteString(field.Column + " " + string(cmp.Op) + " ?")
+	c.args = append(c.args, arg)
+
+	return nil
+}
+
+// convert converts the literal of a comparison into an SQL argument of the field's type.
+func convert(cmp *Comparison, field Field) (interface{}, error) {
+	v := cmp.Value
+
+	switch field.Type {
+	case IntType:
+		if v.Kind == NumberLiteral {
+			if n, err := strconv.ParseInt(v.Text, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+
+		return nil, errorf(cmp.Pos, "%q must be compared with an integer", cmp.Field)
+	case BoolType:
+		if v.Kind == TextLiteral && (v.Text == "true" || v.Text == "false") {
+			return v.Text == "true", nil
+		}
+
+		return nil, errorf(cmp.Pos, "%q must be compared with true or false", cmp.Field)
+	case StringType:
+		if v.Kind == StringLiteral || v.Kind == TextLiteral {
+			return v.Text, nil
+		}
+
+		return nil, errorf(cmp.Pos, "%q must be compared with a string", cmp.Field)
+	case TimestampType:
+		if v.Kind == StringLiteral {
+			if ts, err := time.Parse(time.RFC3339Nano, v.Text); err == nil {
+				return wholeSecond(cmp, ts.UTC())
+			}
+		}
+
+		return nil, errorf(cmp.Pos, "%q must be compared with a quoted RFC 3339 timestamp", cmp.Field)
+	case EnumType:
+		if v.Kind == TextLiteral || v.Kind == StringLiteral {
+			if n, ok := field.Values[v.Text]; ok {
+				return n, nil
+			}
+		}
+
+		names := make([]string, 0, len(field.Values))
+		for name := range field.Values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, errorf(cmp.Pos, "%q must be compared with one of %s", cmp.Field, strings.Join(names, ", "))
+	}
+
+	return nil, errorf(cmp.Pos, "%q has an unsupported type", cmp.Field)
+}
+
+// wholeSecond returns the stored timestamp a timestamp is compared against. Stored timestamps are whole seconds, so
+// a bound between seconds is rounded up for < and >= and down for > and <=, which match the same stored timestamps
+// as the exact bound does. Timestamps between seconds never equal a stored one, so can't be compared with = or !=.
+func wholeSecond(cmp *Comparison, ts time.Time) (interface{}, error) {
+	second := ts.Truncate(time.Second)
+	if second.Equal(ts) {
+		return ts.Format(TimestampLayout), nil
+	}
+
+	switch cmp.Op {
+	case Less, GreaterOrEqual:
+		return second.Add(time.Second).Format(TimestampLayout), nil
+	case Greater, LessOrEqual:
+		return second.Format(TimestampLayout), nil
+	}
+
+	return nil, errorf(cmp.Pos, "%q can only be compared with = or != to a whole second", cmp.Field)
+}
+
+func (s Schema) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,232 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSchema is a schema with a field of each type.
+var testSchema = Schema{
+	"id":      {Column: "id", Type: IntType},
+	"name":    {Column: "name", Type: StringType},
+	"visible": {Column: "visible", Type: BoolType},
+	"start":   {Column: "advertised_start_time", Type: TimestampType},
+	"status":  {Column: "status", Type: EnumType, Values: map[string]int32{"OPEN": 1, "CLOSED": 2}},
+}
+
+// compile parses and compiles an expression against the test schema.
+func compile(expr string) (string, []interface{}, error) {
+	parsed, err := Parse(expr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return Compile(parsed, testSchema)
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name: "empty",
+			expr: "  ",
+		},
+		{
+			name:     "single comparison",
+			expr:     "id = 4",
+			wantSQL:  "id = ?",
+			wantArgs: []interface{}{int64(4)},
+		},
+		{
+			name:     "every operator",
+			expr:     "id = 1 AND id != 2 AND id < 3 AND id <= 4 AND id > 5 AND id >= 6",
+			wantSQL:  "(id = ? AND id != ? AND id < ? AND id <= ? AND id > ? AND id >= ?)",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6)},
+		},
+		{
+			name:     "negative number",
+			expr:     "id > -3",
+			wantSQL:  "id > ?",
+			wantArgs: []interface{}{int64(-3)},
+		},
+		{
+			name:     "OR binds more tightly than AND",
+			expr:     "id = 1 OR id = 2 AND id = 3",
+			wantSQL:  "((id = ? OR id = ?) AND id = ?)",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "AND after OR",
+			expr:     "id = 1 AND id = 2 OR id = 3",
+			wantSQL:  "(id = ? AND (id = ? OR id = ?))",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "implicit AND",
+			expr:     "id = 1 visible = true",
+			wantSQL:  "(id = ? AND visible = ?)",
+			wantArgs: []interface{}{int64(1), true},
+		},
+		{
+			name:     "parentheses",
+			expr:     "(id = 1 AND id = 2) OR id = 3",
+			wantSQL:  "((id = ? AND id = ?) OR id = ?)",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:     "NOT",
+			expr:     "NOT visible = true",
+			wantSQL:  "NOT (visible = ?)",
+			wantArgs: []interface{}{true},
+		},
+		{
+			name:     "minus negates",
+			expr:     "-id = 1",
+			wantSQL:  "NOT (id = ?)",
+			wantArgs: []interface{}{int64(1)},
+		},
+		{
+			name:     "NOT of nested OR within AND",
+			expr:     "visible = false AND NOT (id = 1 OR (id = 2 AND status = CLOSED))",
+			wantSQL:  "(visible = ? AND NOT ((id = ? OR (id = ? AND status = ?))))",
+			wantArgs: []interface{}{false, int64(1), int64(2), int32(2)},
+		},
+		{
+			name:     "double quoted string with escapes",
+			expr:     `name = "say \"hi\" \\ bye"`,
+			wantSQL:  "name = ?",
+			wantArgs: []interface{}{`say "hi" \ bye`},
+		},
+		{
+			name:     "single quoted string",
+			expr:     `name = 'it\'s "here"'`,
+			wantSQL:  "name = ?",
+			wantArgs: []interface{}{`it's "here"`},
+		},
+		{
+			name:     "unquoted string",
+			expr:     "name = Flemington",
+			wantSQL:  "name = ?",
+			wantArgs: []interface{}{"Flemington"},
+		},
+		{
+			name:     "enum by name",
+			expr:     `status = OPEN OR status = "CLOSED"`,
+			wantSQL:  "(status = ? OR status = ?)",
+			wantArgs: []interface{}{int32(1), int32(2)},
+		},
+		{
+			name:     "timestamp in UTC",
+			expr:     `start >= "2026-10-20T12:00:00+10:00"`,
+			wantSQL:  "advertised_start_time >= ?",
+			wantArgs: []interface{}{"2026-10-20T02:00:00Z"},
+		},
+		{
+			name:     "sub-second bounds keep races starting within the second",
+			expr:     `start < "2026-10-20T10:00:00.5Z" AND start >= "2026-10-20T09:00:00.5Z"`,
+			wantSQL:  "(advertised_start_time < ? AND advertised_start_time >= ?)",
+			wantArgs: []interface{}{"2026-10-20T10:00:01Z", "2026-10-20T09:00:01Z"},
+		},
+		{
+			name:     "sub-second bounds leave out races starting within the second",
+			expr:     `start > "2026-10-20T10:00:00.5Z" AND start <= "2026-10-20T11:00:00.5Z"`,
+			wantSQL:  "(advertised_start_time > ? AND advertised_start_time <= ?)",
+			wantArgs: []interface{}{"2026-10-20T10:00:00Z", "2026-10-20T11:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := compile(tt.expr)
+			if err != nil {
+				t.Fatalf("compile(%q) failed: %s", tt.expr, err)
+			}
+
+			if sql != tt.wantSQL {
+				t.Errorf("compile(%q) SQL = %q, want %q", tt.expr, sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("compile(%q) args = %#v, want %#v", tt.expr, args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "too long", expr: "name = \"" + strings.Repeat("a", MaxLength) + "\"", wantErr: "must not be longer than"},
+		{name: "too deep", expr: strings.Repeat("(", maxDepth+1) + "id = 1" + strings.Repeat(")", maxDepth+1), wantErr: "must not nest more than"},
+		{name: "has", expr: "name:foo", wantErr: `operator ":" is not supported`},
+		{name: "unknown field", expr: "colour = red", wantErr: `cannot filter on "colour"`},
+		{name: "unterminated string", expr: `name = "foo`, wantErr: "unterminated string"},
+		{name: "bang", expr: "id ! 1", wantErr: `did you mean "!="`},
+		{name: "missing value", expr: "id =", wantErr: "expected a value"},
+		{name: "missing comparison", expr: "id", wantErr: "expected a comparison"},
+		{name: "keyword as field", expr: "AND = 1", wantErr: "expected a field"},
+		{name: "unbalanced", expr: "(id = 1", wantErr: `expected ")"`},
+		{name: "trailing", expr: "id = 1)", wantErr: "unexpected"},
+		{name: "integer field", expr: `id = "one"`, wantErr: "must be compared with an integer"},
+		{name: "boolean field", expr: "visible = yes", wantErr: "must be compared with true or false"},
+		{name: "ordered boolean", expr: "visible < true", wantErr: "can only be compared with = or !="},
+		{name: "ordered enum", expr: "status > OPEN", wantErr: "can only be compared with = or !="},
+		{name: "unknown enum", expr: "status = SHUT", wantErr: "must be compared with one of CLOSED, OPEN"},
+		{name: "unquoted timestamp", expr: "start > 2026", wantErr: "quoted RFC 3339 timestamp"},
+		{name: "sub-second equality", expr: `start = "2026-10-20T10:00:00.5Z"`, wantErr: "to a whole second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := compile(tt.expr)
+			if err == nil {
+				t.Fatalf("compile(%q) succeeded, want an error containing %q", tt.expr, tt.wantErr)
+			}
+
+			if _, ok := err.(*Error); !ok {
+				t.Errorf("compile(%q) error is a %T, want a *Error", tt.expr, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compile(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	if _, err := Parse("name = \"" + strings.Repeat("a", MaxLength-9) + "\""); err != nil {
+		t.Errorf("Parse of a filter of the maximum length failed: %s", err)
+	}
+
+	deepest := strings.Repeat("(", maxDepth) + "id = 1" + strings.Repeat(")", maxDepth)
+	if _, err := Parse(deepest); err != nil {
+		t.Errorf("Parse of a filter nested %d levels deep failed: %s", maxDepth, err)
+	}
+}
+
+func TestCompileHelpers(t *testing.T) {
+	expr := AllOf(nil, Compare("id", Greater, Int(3)), AnyOf(Compare("name", Equal, String("a")), nil))
+
+	sql, args, err := Compile(expr, testSchema)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+
+	if want := "(id > ? AND name = ?)"; sql != want {
+		t.Errorf("Compile SQL = %q, want %q", sql, want)
+	}
+	if want := []interface{}{int64(3), "a"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Compile args = %#v, want %#v", args, want)
+	}
+
+	if AllOf(nil, nil) != nil {
+		t.Errorf("AllOf of nothing isn't nil")
+	}
+}
@@ -0,0 +1,330 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxLength is the longest expression Parse accepts, in bytes.
+	MaxLength = 2048
+
+	// maxDepth bounds how deeply expressions may nest, so that hostile input cannot exhaust the stack.
+	maxDepth = 32
+)
+
+// Error is returned when an expression cannot be parsed or compiled.
+type Error struct {
+	// Pos is the offset within the expression at which the error was found.
+	Pos int
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (at offset %d)", e.Msg, e.Pos)
+}
+
+func errorf(pos int, format string, args ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses a filter expression. An empty expression parses to a nil Expr, which matches everything.
+//
+// The grammar follows AIP-160, where OR binds more tightly than AND, and terms separated only by whitespace are
+// implicitly ANDed:
+//
+//	expression  = sequence { "AND" sequence }
+//	sequence    = factor { factor }
+//	factor      = term { "OR" term }
+//	term        = [ "NOT" | "-" ] simple
+//	simple      = restriction | "(" expression ")"
+//	restriction = field comparator value
+func Parse(s string) (Expr, error) {
+	if len(s) > MaxLength {
+		return nil, errorf(MaxLength, "filter must not be longer than %d bytes", MaxLength)
+	}
+
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, nil
+	}
+
+	expr, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errorf(tok.pos, "unexpected %s", tok)
+	}
+
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenComparator
+	tokenMinus
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '-':
+			tokens = append(tokens, token{kind: tokenMinus, text: "-", pos: i})
+			i++
+		case c == '=' || c == ':':
+			tokens = append(tokens, token{kind: tokenComparator, text: string(c), pos: i})
+			i++
+		case c == '<' || c == '>' || c == '!':
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, errorf(i, "unexpected %q, did you mean \"!=\"", op)
+			}
+			tokens = append(tokens, token{kind: tokenComparator, text: op, pos: i})
+			i += len(op)
+		case c == '"' || c == '\'':
+			text, n, err := lexString(s[i:], i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: i})
+			i += n
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[start:i], pos: start})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(s) && (s[i] == '_' || s[i] == '.' || unicode.IsLetter(rune(s[i])) || unicode.IsDigit(rune(s[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[start:i], pos: start})
+		default:
+			return nil, errorf(i, "unexpected character %q", c)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+// lexString reads a quoted string from the start of s, returning its unescaped value and quoted length.
+func lexString(s string, pos int) (string, int, error) {
+	quote := s[0]
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, errorf(pos, "unterminated string")
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+
+	return tok
+}
+
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && tok.text == word
+}
+
+func (p *parser) parseExpression(depth int) (Expr, error) {
+	if depth > maxDepth {
+		return nil, errorf(p.peek().pos, "filter must not nest more than %d levels deep", maxDepth)
+	}
+
+	var terms []Expr
+	for {
+		seq, err := p.parseSequence(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, seq)
+
+		if !p.keyword("AND") {
+			return AllOf(terms...), nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseSequence(depth int) (Expr, error) {
+	var terms []Expr
+	for {
+		factor, err := p.parseFactor(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, factor)
+
+		switch tok := p.peek(); {
+		case tok.kind == tokenEOF, tok.kind == tokenRParen, p.keyword("AND"):
+			return AllOf(terms...), nil
+		}
+	}
+}
+
+func (p *parser) parseFactor(depth int) (Expr, error) {
+	var terms []Expr
+	for {
+		term, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		if !p.keyword("OR") {
+			return AnyOf(terms...), nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseTerm(depth int) (Expr, error) {
+	if p.keyword("NOT") || p.peek().kind == tokenMinus {
+		p.next()
+
+		simple, err := p.parseSimple(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Not{Term: simple}, nil
+	}
+
+	return p.parseSimple(depth)
+}
+
+func (p *parser) parseSimple(depth int) (Expr, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenLParen:
+		expr, err := p.parseExpression(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, errorf(closing.pos, "expected \")\" but found %s", closing)
+		}
+
+		return expr, nil
+	case tokenIdent:
+		if tok.text == "AND" || tok.text == "OR" || tok.text == "NOT" {
+			break
+		}
+
+		return p.parseRestriction(tok)
+	}
+
+	return nil, errorf(tok.pos, "expected a field or \"(\" but found %s", tok)
+}
+
+func (p *parser) parseRestriction(field token) (Expr, error) {
+	op := p.next()
+	if op.kind != tokenComparator {
+		return nil, errorf(op.pos, "expected a comparison after %q but found %s", field.text, op)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Comparison{Field: field.text, Op: Operator(op.text), Value: value, Pos: field.pos}, nil
+}
+
+func (p *parser) parseValue() (Literal, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenString:
+		return Literal{Kind: StringLiteral, Text: tok.text}, nil
+	case tokenNumber:
+		return Literal{Kind: NumberLiteral, Text: tok.text}, nil
+	case tokenIdent:
+		return Literal{Kind: TextLiteral, Text: tok.text}, nil
+	case tokenMinus:
+		if num := p.peek(); num.kind == tokenNumber && num.pos == tok.pos+1 {
+			p.next()
+			return Literal{Kind: NumberLiteral, Text: "-" + num.text}, nil
+		}
+	}
+
+	return Literal{}, errorf(tok.pos, "expected a value but found %s", tok)
+}
@@ -3,6 +3,7 @@ module git.neds.sh/matty/entain/racing
 go 1.16
 
 require (
+	git.neds.sh/matty/entain/tokenbucket v0.0.0
 	github.com/golang/protobuf v1.4.3
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.3.0
 	github.com/mattn/go-sqlite3 v1.14.28
@@ -13,3 +14,5 @@ require (
 	google.golang.org/protobuf v1.25.1-0.20201208041424-160c7477e0e8
 	syreclabs.com/go/faker v1.2.3
 )
+
+replace git.neds.sh/matty/entain/tokenbucket => ../tokenbucket
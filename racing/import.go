@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/nexttojump"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+	"git.neds.sh/matty/entain/racing/racecard"
+	"git.neds.sh/matty/entain/racing/service"
+)
+
+// runImport imports a race card feed straight into the racing database, reporting the changes made.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Report the changes the import would make, without making them")
+	format := fs.String("format", "", "Format of the feed, json or csv, told from its file extension when not given")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [flags] <feed>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a single feed to import")
+	}
+	path := fs.Arg(0)
+
+	feedFormat := racecard.Format(*format)
+	if feedFormat == "" {
+		var err error
+		if feedFormat, err = racecard.FormatOf(path); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	card, err := racecard.Read(f, feedFormat)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	racingDB, err := db.Open(databasePath)
+	if err != nil {
+		return err
+	}
+
+	racesRepo := db.NewRacesRepo(racingDB, false)
+	if err := racesRepo.Init(); err != nil {
+		return err
+	}
+
+	// Nothing serves the next to jump or reads races here, so the index is never run and no rules are needed.
+	racingService := service.NewRacingService(racesRepo, nexttojump.NewIndex(racesRepo, *nextToJumpInterval), nil)
+
+	resp, err := racingService.ImportRaceCard(context.Background(), &racing.ImportRaceCardRequest{
+		Card:   card,
+		DryRun: *dryRun,
+	})
+	if err != nil {
+		return describeImportError(err)
+	}
+
+	printImportChanges(resp)
+
+	return nil
+}
+
+// printImportChanges prints a line for each record created or updated, followed by a summary of every change.
+func printImportChanges(resp *racing.ImportRaceCardResponse) {
+	counts := make(map[racing.ImportAction]int)
+
+	for _, change := range resp.Changes {
+		counts[change.Action]++
+
+		entity := racing.ImportEntity_name[int32(change.Entity)][len("IMPORT_ENTITY_"):]
+
+		switch change.Action {
+		case racing.ImportAction_IMPORT_ACTION_CREATED:
+			fmt.Printf("+ %-7s %s\n", entity, change.ExternalId)
+		case racing.ImportAction_IMPORT_ACTION_UPDATED:
+			fields := make([]string, 0, len(change.FieldChanges))
+			for _, fieldChange := range change.FieldChanges {
+				fields = append(fields, fmt.Sprintf("%s %q -> %q", fieldChange.Field, fieldChange.OldValue, fieldChange.NewValue))
+			}
+
+			fmt.Printf("~ %-7s %s (id %d): %s\n", entity, change.ExternalId, change.Id, strings.Join(fields, ", "))
+		}
+	}
+
+	fmt.Printf(
+		"%d created, %d updated, %d unchanged",
+		counts[racing.ImportAction_IMPORT_ACTION_CREATED],
+		counts[racing.ImportAction_IMPORT_ACTION_UPDATED],
+		counts[racing.ImportAction_IMPORT_ACTION_UNCHANGED],
+	)
+	if resp.DryRun {
+		fmt.Print(" (dry run, nothing was changed)")
+	}
+	fmt.Println()
+}
+
+// describeImportError spells out each invalid field of an import which was rejected.
+func describeImportError(err error) error {
+	// Run in-process, errors from the repository haven't been through the interceptor mapping them onto statuses.
+	var invalidArg *db.InvalidArgumentError
+	if errors.As(err, &invalidArg) {
+		err = errs.FromRepo(err)
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	msg := st.Message()
+	for _, detail := range st.Details() {
+		// A single invalid field is already spelled out by the message.
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok && len(badRequest.FieldViolations) > 1 {
+			for _, v := range badRequest.FieldViolations {
+				msg += fmt.Sprintf("\n  %s: %s", v.Field, v.Description)
+			}
+		}
+	}
+
+	return errors.New(msg)
+}
@@ -0,0 +1,272 @@
+// Package jurisdiction decides which races callers may be shown or bet on, by the jurisdiction they're calling from.
+// Jurisdictions are named by a country code, such as AU, optionally followed by a state, such as AU-SA, with the
+// rules of a state applying alongside those of its country.
+package jurisdiction
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// countryPattern matches the ISO 3166-1 alpha-2 codes races' countries are given by.
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Rules are the policies races are shown and bet on by. The default policy applies to every jurisdiction, those of
+// countries to each of their states, and those of states to the state alone.
+type Rules struct {
+	Default       Policy            `json:"default"`
+	Jurisdictions map[string]Policy `json:"jurisdictions"`
+}
+
+// Policy is what a jurisdiction may not be shown or bet on.
+type Policy struct {
+	// Name is the jurisdiction the policy was built for, or default when no rules were set for it.
+	Name string `json:"-"`
+	// Hide lists races which must not be shown at all.
+	Hide []Rule `json:"hide"`
+	// Restrict lists races which may be shown, but not bet on.
+	Restrict []Rule `json:"restrict"`
+}
+
+// Rule matches races by race type, country or meeting. A race matches when it matches every criterion given, and
+// any value of each.
+type Rule struct {
+	// RaceTypes are the names of race types, with or without their RACE_TYPE_ prefix.
+	RaceTypes  []string `json:"race_types"`
+	Countries  []string `json:"countries"`
+	MeetingIDs []int64  `json:"meeting_ids"`
+	// Reason is why races are restricted, which restricted races are annotated with.
+	Reason string `json:"reason"`
+}
+
+// Load reads rules from a JSON file, checking each is valid.
+func Load(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &rules, nil
+}
+
+func (r *Rules) validate() error {
+	if err := r.Default.validate("default"); err != nil {
+		return err
+	}
+
+	for name, policy := range r.Jurisdictions {
+		if normalize(name) != name || !countryPattern.MatchString(country(name)) {
+			return fmt.Errorf("jurisdiction %q must be an uppercase country code, optionally followed by - and a state", name)
+		}
+
+		if err := policy.validate(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) validate(name string) error {
+	for i := range p.Hide {
+		if err := p.Hide[i].validate(); err != nil {
+			return fmt.Errorf("%s: hide[%d]: %w", name, i, err)
+		}
+	}
+
+	for i := range p.Restrict {
+		if err := p.Restrict[i].validate(); err != nil {
+			return fmt.Errorf("%s: restrict[%d]: %w", name, i, err)
+		}
+		if strings.TrimSpace(p.Restrict[i].Reason) == "" {
+			return fmt.Errorf("%s: restrict[%d]: must give a reason", name, i)
+		}
+	}
+
+	return nil
+}
+
+// validate checks a rule matches on something, normalizing its race types to their full names.
+func (r *Rule) validate() error {
+	if len(r.RaceTypes) == 0 && len(r.Countries) == 0 && len(r.MeetingIDs) == 0 {
+		return fmt.Errorf("must match on race types, countries or meetings")
+	}
+
+	for i, name := range r.RaceTypes {
+		name = strings.ToUpper(name)
+		if !strings.HasPrefix(name, "RACE_TYPE_") {
+			name = "RACE_TYPE_" + name
+		}
+
+		if v, ok := racing.RaceType_value[name]; !ok || v == int32(racing.RaceType_RACE_TYPE_UNSPECIFIED) {
+			return fmt.Errorf("race type %q is unknown", r.RaceTypes[i])
+		}
+
+		r.RaceTypes[i] = name
+	}
+
+	for _, c := range r.Countries {
+		if !countryPattern.MatchString(c) {
+			return fmt.Errorf("country %q must be an uppercase two letter code", c)
+		}
+	}
+
+	return nil
+}
+
+// For returns the policy of a jurisdiction, combining the default policy with those of its country and itself.
+// Rules may be nil, in which case nothing is hidden or restricted.
+func (r *Rules) For(jurisdiction string) Policy {
+	policy := Policy{Name: "default"}
+	if r == nil {
+		return policy
+	}
+
+	policy.add(r.Default)
+
+	jurisdiction = normalize(jurisdiction)
+	if jurisdiction == "" {
+		return policy
+	}
+
+	if c := country(jurisdiction); c != jurisdiction {
+		if p, ok := r.Jurisdictions[c]; ok {
+			policy.Name = c
+			policy.add(p)
+		}
+	}
+
+	if p, ok := r.Jurisdictions[jurisdiction]; ok {
+		policy.Name = jurisdiction
+		policy.add(p)
+	}
+
+	return policy
+}
+
+func (p *Policy) add(other Policy) {
+	p.Hide = append(p.Hide, other.Hide...)
+	p.Restrict = append(p.Restrict, other.Restrict...)
+}
+
+// Hidden returns an expression matching the races the policy hides, which is nil when it hides none.
+func (p Policy) Hidden() filterpkg.Expr {
+	exprs := make([]filterpkg.Expr, len(p.Hide))
+	for i, rule := range p.Hide {
+		exprs[i] = rule.Expr()
+	}
+
+	return filterpkg.AnyOf(exprs...)
+}
+
+// Hides reports whether the policy hides a race.
+func (p Policy) Hides(race *racing.Race) bool {
+	for _, rule := range p.Hide {
+		if rule.Matches(race) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Restrictions returns the reasons a race may not be bet on, each given once, which is empty when it may be.
+func (p Policy) Restrictions(race *racing.Race) []string {
+	var (
+		reasons []string
+		seen    = make(map[string]bool)
+	)
+
+	for _, rule := range p.Restrict {
+		if rule.Matches(race) && !seen[rule.Reason] {
+			reasons = append(reasons, rule.Reason)
+			seen[rule.Reason] = true
+		}
+	}
+
+	return reasons
+}
+
+// Expr returns an expression matching the races the rule does.
+func (r Rule) Expr() filterpkg.Expr {
+	criteria := make([]filterpkg.Expr, 0, 3)
+
+	if len(r.RaceTypes) > 0 {
+		exprs := make([]filterpkg.Expr, len(r.RaceTypes))
+		for i, name := range r.RaceTypes {
+			exprs[i] = filterpkg.Compare("race_type", filterpkg.Equal, filterpkg.Enum(name))
+		}
+		criteria = append(criteria, filterpkg.AnyOf(exprs...))
+	}
+
+	if len(r.Countries) > 0 {
+		exprs := make([]filterpkg.Expr, len(r.Countries))
+		for i, c := range r.Countries {
+			exprs[i] = filterpkg.Compare("country", filterpkg.Equal, filterpkg.String(c))
+		}
+		criteria = append(criteria, filterpkg.AnyOf(exprs...))
+	}
+
+	if len(r.MeetingIDs) > 0 {
+		exprs := make([]filterpkg.Expr, len(r.MeetingIDs))
+		for i, id := range r.MeetingIDs {
+			exprs[i] = filterpkg.Compare("meeting_id", filterpkg.Equal, filterpkg.Int(id))
+		}
+		criteria = append(criteria, filterpkg.AnyOf(exprs...))
+	}
+
+	return filterpkg.AllOf(criteria...)
+}
+
+// Matches reports whether the rule matches a race, which must have been read with its race type, country and
+// meeting.
+func (r Rule) Matches(race *racing.Race) bool {
+	return (len(r.RaceTypes) == 0 || containsString(r.RaceTypes, race.RaceType.String())) &&
+		(len(r.Countries) == 0 || containsString(r.Countries, race.Country)) &&
+		(len(r.MeetingIDs) == 0 || containsInt(r.MeetingIDs, race.MeetingId))
+}
+
+// normalize returns a jurisdiction as it's named in rules, such as AU-SA for au-sa.
+func normalize(jurisdiction string) string {
+	return strings.ToUpper(strings.TrimSpace(jurisdiction))
+}
+
+// country returns the country of a jurisdiction, which is the jurisdiction itself when it isn't a state.
+func country(jurisdiction string) string {
+	return strings.SplitN(jurisdiction, "-", 2)[0]
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(values []int64, v int64) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package jurisdiction
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// loadExample loads the example rules, failing the test should they not load.
+func loadExample(t *testing.T) *Rules {
+	t.Helper()
+
+	rules, err := Load(filepath.Join("examples", "rules.json"))
+	if err != nil {
+		t.Fatalf("loading example rules: %s", err)
+	}
+
+	return rules
+}
+
+func TestLoad(t *testing.T) {
+	rules := loadExample(t)
+
+	// Race types are normalized to their full names.
+	if got := rules.Jurisdictions["AU-SA"].Restrict[0].RaceTypes[0]; got != "RACE_TYPE_GREYHOUND" {
+		t.Errorf("got race type %s, want RACE_TYPE_GREYHOUND", got)
+	}
+
+	tests := map[string]string{
+		"malformed":             `{"default": []}`,
+		"lowercase":             `{"jurisdictions": {"au": {}}}`,
+		"not a country":         `{"jurisdictions": {"AUS": {}}}`,
+		"matching nothing":      `{"default": {"hide": [{}]}}`,
+		"unknown race type":     `{"default": {"hide": [{"race_types": ["CAMEL"]}]}}`,
+		"unspecified race type": `{"default": {"hide": [{"race_types": ["UNSPECIFIED"]}]}}`,
+		"lowercase country":     `{"default": {"hide": [{"countries": ["au"]}]}}`,
+		"restricting no reason": `{"jurisdictions": {"AU": {"restrict": [{"countries": ["HK"], "reason": " "}]}}}`,
+	}
+
+	for name, data := range tests {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("writing rules: %s", err)
+		}
+
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: loaded %s, want an error", name, data)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	rules := loadExample(t)
+
+	tests := map[string]struct {
+		rules        *Rules
+		jurisdiction string
+		name         string
+		hide         int
+		restrict     int
+	}{
+		"no rules":        {nil, "AU-SA", "default", 0, 0},
+		"no jurisdiction": {rules, "", "default", 0, 1},
+		"no rules of its": {rules, "GB", "default", 0, 1},
+		"country":         {rules, "AU", "AU", 1, 1},
+		"state":           {rules, " au-sa ", "AU-SA", 1, 2},
+		"other state":     {rules, "AU-VIC", "AU", 1, 1},
+	}
+
+	for name, test := range tests {
+		policy := test.rules.For(test.jurisdiction)
+		if policy.Name != test.name || len(policy.Hide) != test.hide || len(policy.Restrict) != test.restrict {
+			t.Errorf("%s: got policy %s hiding %d and restricting %d, want %s hiding %d and restricting %d",
+				name, policy.Name, len(policy.Hide), len(policy.Restrict), test.name, test.hide, test.restrict)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{
+		Hide: []Rule{
+			{RaceTypes: []string{"RACE_TYPE_HARNESS"}, Countries: []string{"AU"}},
+			{MeetingIDs: []int64{7}},
+		},
+		Restrict: []Rule{
+			{Countries: []string{"HK"}, Reason: "offshore"},
+			{MeetingIDs: []int64{3}, Reason: "offshore"},
+			{RaceTypes: []string{"RACE_TYPE_GREYHOUND"}, Reason: "greyhounds"},
+		},
+	}
+
+	tests := map[string]struct {
+		race         *racing.Race
+		hidden       bool
+		restrictions []string
+	}{
+		"matching every criterion": {
+			race:   &racing.Race{RaceType: racing.RaceType_RACE_TYPE_HARNESS, Country: "AU"},
+			hidden: true,
+		},
+		"matching some criteria": {
+			race: &racing.Race{RaceType: racing.RaceType_RACE_TYPE_HARNESS, Country: "NZ"},
+		},
+		"matching any rule": {
+			race:   &racing.Race{MeetingId: 7},
+			hidden: true,
+		},
+		"restricted once per reason": {
+			race:         &racing.Race{RaceType: racing.RaceType_RACE_TYPE_GREYHOUND, Country: "HK", MeetingId: 3},
+			restrictions: []string{"offshore", "greyhounds"},
+		},
+	}
+
+	for name, test := range tests {
+		if got := policy.Hides(test.race); got != test.hidden {
+			t.Errorf("%s: hidden is %t, want %t", name, got, test.hidden)
+		}
+		if got := policy.Restrictions(test.race); strings.Join(got, ",") != strings.Join(test.restrictions, ",") {
+			t.Errorf("%s: got restrictions %v, want %v", name, got, test.restrictions)
+		}
+	}
+
+	if (Policy{}).Hidden() != nil {
+		t.Error("policy hiding nothing has an expression")
+	}
+}
@@ -1,23 +1,59 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"expvar"
 	"flag"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"time"
 
 	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/nexttojump"
+	"git.neds.sh/matty/entain/racing/outbox"
 	"git.neds.sh/matty/entain/racing/proto/racing"
+	"git.neds.sh/matty/entain/racing/ratelimit"
+	"git.neds.sh/matty/entain/racing/scheduler"
 	"git.neds.sh/matty/entain/racing/service"
+	"git.neds.sh/matty/entain/racing/validate"
+	"git.neds.sh/matty/entain/tokenbucket"
 	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
-	grpcEndpoint = flag.String("grpc-endpoint", "localhost:9000", "gRPC server endpoint")
+	grpcEndpoint       = flag.String("grpc-endpoint", ":9000", "Address the gRPC server listens on, on every interface when no host is given")
+	nextToJumpInterval = flag.Duration("next-to-jump-interval", 30*time.Second, "How often the next to jump index is refreshed")
+	schedulerInterval  = flag.Duration("scheduler-interval", time.Minute, "How often the scheduler checks for races to jump, at most")
+	outboxInterval     = flag.Duration("outbox-interval", time.Second, "How often the outbox is checked for race events to publish")
+	eventsFile         = flag.String("events-file", "", "File to append race events to as newline delimited JSON, if any")
+	dummyData          = flag.Bool("dummy-data", true, "Seed the database with dummy races, rather than races imported from race cards")
+	racesCacheSize     = flag.Int("races-cache-size", 1000, "How many reads of races are cached, at most, with zero turning the cache off")
+	racesCacheTTL      = flag.Duration("races-cache-ttl", 5*time.Second, "How long reads of races are cached for, at most")
+	rateLimit          = flag.String("rate-limit", "0/s", "How many calls each method may take across every caller, such as 500/s, as a backstop to the gateway's limits, with zero meaning no limit")
+	debugEndpoint      = flag.String("debug-endpoint", "", "HTTP endpoint serving metrics, such as those of the races cache, at /debug/vars, if any")
+	jurisdictionRules  = flag.String("jurisdiction-rules", "", "JSON file of the races hidden or restricted in each jurisdiction, if any")
 )
 
+// databasePath is the path of the racing database.
+const databasePath = "./db/racing.db"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatalf("failed importing race card: %s\n", err)
+		}
+
+		return
+	}
+
 	flag.Parse()
 
 	if err := run(); err != nil {
@@ -26,30 +62,126 @@ func main() {
 }
 
 func run() error {
-	conn, err := net.Listen("tcp", ":9000")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.Listen("tcp", *grpcEndpoint)
 	if err != nil {
 		return err
 	}
 
-	racingDB, err := sql.Open("sqlite3", "./db/racing.db")
+	racingDB, err := db.Open(databasePath)
 	if err != nil {
 		return err
 	}
 
-	racesRepo := db.NewRacesRepo(racingDB)
+	uncachedRacesRepo := db.NewRacesRepo(racingDB, *dummyData)
+	racesRepo := db.NewCachedRacesRepo(uncachedRacesRepo, *racesCacheSize, *racesCacheTTL)
 	if err := racesRepo.Init(); err != nil {
 		return err
 	}
 
-	grpcServer := grpc.NewServer()
+	expvar.Publish("races_cache", expvar.Func(func() interface{} { return racesRepo.Stats() }))
+
+	pricesRepo := db.NewPricesRepo(racingDB)
+	if err := pricesRepo.Init(); err != nil {
+		return err
+	}
+
+	outboxRepo := db.NewOutboxRepo(racingDB)
+	if err := outboxRepo.Init(); err != nil {
+		return err
+	}
+
+	// The index reads races as they are, as it asks for those from the time of each refresh, which the cache would
+	// only ever hold once.
+	nextToJumpIdx := nexttojump.NewIndex(uncachedRacesRepo, *nextToJumpInterval)
+	go nextToJumpIdx.Run(ctx)
+
+	bus := outbox.NewBus()
+	bus.Subscribe(func(*racing.RaceEvent) { racesRepo.Invalidate() })
+	bus.Subscribe(func(*racing.RaceEvent) { nextToJumpIdx.Invalidate() })
+
+	var publisher outbox.Publisher = bus
+	if *eventsFile != "" {
+		publisher = outbox.Publishers{bus, outbox.NewFilePublisher(*eventsFile)}
+	}
+
+	relay := outbox.NewRelay(outboxRepo, publisher, *outboxInterval)
+	go relay.Run(ctx)
+
+	// The scheduler reads races as they are, as the cache only catches up once the changes are relayed.
+	raceScheduler := scheduler.NewScheduler(
+		uncachedRacesRepo,
+		scheduler.NewSystemClock(),
+		*schedulerInterval,
+		func(*racing.RaceStatusTransition) { relay.Notify() },
+	)
+	go raceScheduler.Run(ctx)
+
+	limit, err := tokenbucket.ParseLimit(*rateLimit)
+	if err != nil {
+		return fmt.Errorf("parsing -rate-limit: %w", err)
+	}
+	limiter := ratelimit.NewLimiter(limit)
+
+	var rules *jurisdiction.Rules
+	if *jurisdictionRules != "" {
+		if rules, err = jurisdiction.Load(*jurisdictionRules); err != nil {
+			return fmt.Errorf("loading -jurisdiction-rules: %w", err)
+		}
+	}
+
+	validator, err := validate.NewValidator(service.Rules)
+	if err != nil {
+		return fmt.Errorf("building validator: %w", err)
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			errs.UnaryServerInterceptor,
+			limiter.UnaryServerInterceptor,
+			validator.UnaryServerInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			errs.StreamServerInterceptor,
+			limiter.StreamServerInterceptor,
+			validator.StreamServerInterceptor,
+		),
+	)
 
 	racing.RegisterRacingServer(
 		grpcServer,
 		service.NewRacingService(
 			racesRepo,
+			nextToJumpIdx,
+			rules,
 		),
 	)
 
+	racing.RegisterPricingServer(
+		grpcServer,
+		service.NewPricingService(
+			racesRepo,
+			pricesRepo,
+			rules,
+		),
+	)
+
+	// The gateway balances requests across replicas which report themselves as serving.
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	if *debugEndpoint != "" {
+		// Importing expvar serves its metrics at /debug/vars on the default mux.
+		go func() {
+			log.Printf("debug server listening on: %s\n", *debugEndpoint)
+
+			if err := http.ListenAndServe(*debugEndpoint, nil); err != nil {
+				log.Printf("failed running debug server: %s\n", err)
+			}
+		}()
+	}
+
 	log.Printf("gRPC server listening on: %s\n", *grpcEndpoint)
 
 	if err := grpcServer.Serve(conn); err != nil {
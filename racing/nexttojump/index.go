@@ -0,0 +1,145 @@
+// Package nexttojump keeps an in-memory index of the upcoming visible races, so the next races to jump can be
+// served without querying the database on every call.
+package nexttojump
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Index serves the next races to jump.
+type Index interface {
+	// Run keeps the index up to date until the context is done.
+	Run(ctx context.Context)
+
+	// Invalidate asks for the index to be refreshed, as races have changed.
+	Invalidate()
+
+	// Next returns up to limit of the races included yet to jump as of now, soonest first. Races of any type are
+	// returned for RACE_TYPE_UNSPECIFIED.
+	Next(now time.Time, limit int, raceType racing.RaceType, include func(race *racing.Race) bool) []*racing.Race
+}
+
+// entry is an indexed race, alongside its parsed start time.
+type entry struct {
+	race  *racing.Race
+	start time.Time
+}
+
+type index struct {
+	racesRepo  db.RacesRepo
+	interval   time.Duration
+	invalidate chan struct{}
+
+	mu      sync.RWMutex
+	entries []entry
+}
+
+// NewIndex creates a new index of races from the races repository, refreshed at least every interval.
+func NewIndex(racesRepo db.RacesRepo, interval time.Duration) Index {
+	return &index{
+		racesRepo:  racesRepo,
+		interval:   interval,
+		invalidate: make(chan struct{}, 1),
+	}
+}
+
+func (i *index) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.refresh(time.Now()); err != nil {
+			log.Printf("failed refreshing next to jump index: %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-i.invalidate:
+		}
+	}
+}
+
+func (i *index) Invalidate() {
+	// A refresh that's already pending will pick up these changes too.
+	select {
+	case i.invalidate <- struct{}{}:
+	default:
+	}
+}
+
+func (i *index) Next(now time.Time, limit int, raceType racing.RaceType, include func(race *racing.Race) bool) []*racing.Race {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	// Races which have jumped since the last refresh are skipped, rather than waiting for them to be dropped.
+	first := sort.Search(len(i.entries), func(n int) bool {
+		return !i.entries[n].start.Before(now)
+	})
+
+	var races []*racing.Race
+	for _, e := range i.entries[first:] {
+		if len(races) == limit {
+			break
+		}
+
+		if (raceType == racing.RaceType_RACE_TYPE_UNSPECIFIED || e.race.RaceType == raceType) && include(e.race) {
+			races = append(races, e.race)
+		}
+	}
+
+	return races
+}
+
+// indexedExpression matches the visible races which are still expected to jump as advertised.
+const indexedExpression = "visible = true AND (status = RACE_STATUS_OPEN OR status = RACE_STATUS_SUSPENDED)"
+
+// refresh reloads the index with the visible races yet to jump.
+func (i *index) refresh(now time.Time) error {
+	from, err := ptypes.TimestampProto(now)
+	if err != nil {
+		return err
+	}
+
+	races, err := i.racesRepo.List(db.ListRacesQuery{
+		Filter:     &racing.ListRacesRequestFilter{AdvertisedStartTimeFrom: from},
+		Expression: indexedExpression,
+	})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]entry, 0, len(races))
+	for _, race := range races {
+		start, err := ptypes.Timestamp(race.AdvertisedStartTime)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry{race: race, start: start})
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].start.Equal(entries[b].start) {
+			return entries[a].race.Id < entries[b].race.Id
+		}
+
+		return entries[a].start.Before(entries[b].start)
+	})
+
+	i.mu.Lock()
+	i.entries = entries
+	i.mu.Unlock()
+
+	return nil
+}
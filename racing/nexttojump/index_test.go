@@ -0,0 +1,183 @@
+package nexttojump
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// testRace is a race to insert into a scratch database.
+type testRace struct {
+	start    time.Time
+	status   racing.RaceStatus
+	raceType racing.RaceType
+	visible  bool
+}
+
+// openTestRepo opens a races repository over a scratch database holding the given races.
+func openTestRepo(t *testing.T, races map[int64]testRace) (*sql.DB, db.RacesRepo) {
+	t.Helper()
+
+	racingDB, err := db.Open(filepath.Join(t.TempDir(), "racing.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { racingDB.Close() })
+
+	racesRepo := db.NewRacesRepo(racingDB, false)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("initialising races: %s", err)
+	}
+
+	for id, race := range races {
+		insertRace(t, racingDB, id, race)
+	}
+
+	return racingDB, racesRepo
+}
+
+func insertRace(t *testing.T, racingDB *sql.DB, id int64, race testRace) {
+	t.Helper()
+
+	_, err := racingDB.Exec(
+		`INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type, status) VALUES (?,1,'',1,?,?,?,?)`,
+		id,
+		race.visible,
+		race.start.UTC().Format(time.RFC3339),
+		race.raceType,
+		race.status,
+	)
+	if err != nil {
+		t.Fatalf("inserting race %d: %s", id, err)
+	}
+}
+
+// ids returns the IDs of races, in order.
+func ids(races []*racing.Race) []int64 {
+	ids := make([]int64, len(races))
+	for i, race := range races {
+		ids[i] = race.Id
+	}
+
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func includeAll(*racing.Race) bool { return true }
+
+func TestNext(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var (
+		open         = racing.RaceStatus_RACE_STATUS_OPEN
+		thoroughbred = racing.RaceType_RACE_TYPE_THOROUGHBRED
+		greyhound    = racing.RaceType_RACE_TYPE_GREYHOUND
+		harness      = racing.RaceType_RACE_TYPE_HARNESS
+	)
+
+	_, racesRepo := openTestRepo(t, map[int64]testRace{
+		1: {now.Add(10 * time.Minute), open, thoroughbred, true},
+		2: {now.Add(5 * time.Minute), racing.RaceStatus_RACE_STATUS_SUSPENDED, greyhound, true},
+		3: {now.Add(time.Minute), racing.RaceStatus_RACE_STATUS_CLOSED, thoroughbred, true},
+		4: {now.Add(time.Minute), open, thoroughbred, false},
+		5: {now.Add(-time.Minute), open, thoroughbred, true},
+		6: {now.Add(5 * time.Minute), open, harness, true},
+		7: {now.Add(time.Minute), racing.RaceStatus_RACE_STATUS_POSTPONED, greyhound, true},
+		8: {now.Add(time.Hour), open, greyhound, true},
+	})
+
+	i := NewIndex(racesRepo, time.Hour).(*index)
+	if err := i.refresh(now); err != nil {
+		t.Fatalf("refreshing index: %s", err)
+	}
+
+	tests := map[string]struct {
+		now      time.Time
+		limit    int
+		raceType racing.RaceType
+		include  func(*racing.Race) bool
+		want     []int64
+	}{
+		// Only visible races which are open or suspended are indexed, soonest first, then by ID.
+		"every race": {now, 10, racing.RaceType_RACE_TYPE_UNSPECIFIED, includeAll, []int64{2, 6, 1, 8}},
+		"limited":    {now, 2, racing.RaceType_RACE_TYPE_UNSPECIFIED, includeAll, []int64{2, 6}},
+		"race type":  {now, 10, greyhound, includeAll, []int64{2, 8}},
+		"included": {now, 2, racing.RaceType_RACE_TYPE_UNSPECIFIED, func(race *racing.Race) bool {
+			return race.Id != 6
+		}, []int64{2, 1}},
+		// Races which have jumped since the last refresh are skipped.
+		"jumped since": {now.Add(7 * time.Minute), 10, racing.RaceType_RACE_TYPE_UNSPECIFIED, includeAll, []int64{1, 8}},
+	}
+
+	for name, test := range tests {
+		if got := ids(i.Next(test.now, test.limit, test.raceType, test.include)); !equalIDs(got, test.want) {
+			t.Errorf("%s: got races %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestRunRefreshesWhenInvalidated(t *testing.T) {
+	now := time.Now()
+	open := racing.RaceStatus_RACE_STATUS_OPEN
+
+	racingDB, racesRepo := openTestRepo(t, map[int64]testRace{
+		1: {now.Add(time.Hour), open, racing.RaceType_RACE_TYPE_THOROUGHBRED, true},
+	})
+
+	i := NewIndex(racesRepo, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		i.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// waitFor waits for the index to hold the races wanted.
+	waitFor := func(want []int64) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := ids(i.Next(time.Now(), 10, racing.RaceType_RACE_TYPE_UNSPECIFIED, includeAll))
+			if equalIDs(got, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("index holds races %v, want %v", got, want)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor([]int64{1})
+
+	insertRace(t, racingDB, 2, testRace{now.Add(30 * time.Minute), open, racing.RaceType_RACE_TYPE_GREYHOUND, true})
+	i.Invalidate()
+
+	waitFor([]int64{2, 1})
+}
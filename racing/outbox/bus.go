@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Handler handles a race event published on a bus.
+type Handler func(event *racing.RaceEvent)
+
+// Bus is a publisher handing events to handlers within the same process.
+type Bus interface {
+	Publisher
+
+	// Subscribe will hand every event published from now on to the handler.
+	Subscribe(handler Handler)
+}
+
+type bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus creates a new in-process bus.
+func NewBus() Bus {
+	return &bus{}
+}
+
+func (b *bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *bus) Publish(ctx context.Context, events []*racing.RaceEvent) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, event := range events {
+		for _, handler := range b.handlers {
+			handler(event)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+type filePublisher struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFilePublisher creates a publisher appending events to the file at path as newline delimited JSON, creating
+// the file if need be.
+func NewFilePublisher(path string) Publisher {
+	return &filePublisher{path: path}
+}
+
+func (p *filePublisher) Publish(ctx context.Context, events []*racing.RaceEvent) error {
+	var lines []byte
+	for _, event := range events {
+		line, err := protojson.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		lines = append(append(lines, line...), '\n')
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(lines); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Events are only marked as published once they're safely on disk.
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,32 @@
+// Package outbox relays the race events recorded in the outbox on to publishers, giving downstream consumers a
+// reliable feed of changes to races.
+//
+// Events are delivered at least once and in order, so consumers should skip any event whose ID they've already
+// seen. An event which can't be published is dead lettered, and skipped over, once it has failed too many times,
+// staying in the outbox with the error it failed with until it's queued again.
+package outbox
+
+import (
+	"context"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Publisher publishes race events.
+type Publisher interface {
+	// Publish will publish the given events, in order. The events are retried should an error be returned.
+	Publish(ctx context.Context, events []*racing.RaceEvent) error
+}
+
+// Publishers publishes events to each of its publishers in turn.
+type Publishers []Publisher
+
+func (p Publishers) Publish(ctx context.Context, events []*racing.RaceEvent) error {
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"git.neds.sh/matty/entain/racing/db"
+)
+
+const (
+	// relayBatchSize is the most events published at once.
+	relayBatchSize = 100
+	// relayMaxAttempts is how many times an event is published before it's dead lettered, should it keep failing.
+	relayMaxAttempts = 10
+	// relayInitialBackoff is how long is waited before publishing again after failing the first time, doubling with
+	// each failure after.
+	relayInitialBackoff = time.Second
+	// relayMaxBackoff is the longest that's waited before publishing again after failing.
+	relayMaxBackoff = time.Minute
+)
+
+// Relay publishes the events recorded in the outbox.
+type Relay interface {
+	// Run publishes events until the context is done.
+	Run(ctx context.Context)
+
+	// Notify asks for pending events to be published, as more have been recorded.
+	Notify()
+}
+
+type relay struct {
+	outboxRepo     db.OutboxRepo
+	publisher      Publisher
+	interval       time.Duration
+	notify         chan struct{}
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// failures counts how many times in a row publishing the oldest pending event has failed.
+	failures int
+}
+
+// NewRelay creates a new relay of events from the outbox repository to the publisher, checking for events at least
+// every interval. Failures are retried with a growing backoff, and an event which still can't be published after
+// several attempts on its own is dead lettered, so that the events behind it aren't held up for good.
+func NewRelay(outboxRepo db.OutboxRepo, publisher Publisher, interval time.Duration) Relay {
+	return &relay{
+		outboxRepo:     outboxRepo,
+		publisher:      publisher,
+		interval:       interval,
+		notify:         make(chan struct{}, 1),
+		maxAttempts:    relayMaxAttempts,
+		initialBackoff: relayInitialBackoff,
+		maxBackoff:     relayMaxBackoff,
+	}
+}
+
+func (r *relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	backoff := r.initialBackoff
+
+	for {
+		if err := r.drain(ctx); err != nil {
+			log.Printf("failed relaying race events: %s\n", err)
+
+			// Newly recorded events are left waiting too, rather than retrying as soon as they're recorded.
+			if !sleep(ctx, backoff) {
+				return
+			}
+
+			if backoff *= 2; backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+			continue
+		}
+
+		backoff = r.initialBackoff
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+	}
+}
+
+func (r *relay) Notify() {
+	// A drain that's already pending will pick up these events too.
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain publishes pending events until none remain. Events are only marked as published once the publisher has
+// accepted them, so are published again should marking them fail.
+func (r *relay) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// Once publishing has failed, the oldest event is published alone until it succeeds, so that an event which
+		// can never be published is told apart from those behind it.
+		limit := relayBatchSize
+		if r.failures > 0 {
+			limit = 1
+		}
+
+		events, err := r.outboxRepo.Pending(limit)
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := r.publisher.Publish(ctx, events); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+
+			if r.failures++; len(events) > 1 || r.failures < r.maxAttempts {
+				return err
+			}
+
+			log.Printf("dead lettering race event %d after %d failed attempts: %s\n", events[0].Id, r.failures, err)
+
+			if err := r.outboxRepo.MarkFailed(events[0].Id, err.Error(), time.Now()); err != nil {
+				return err
+			}
+
+			r.failures = 0
+			continue
+		}
+
+		r.failures = 0
+
+		if err := r.outboxRepo.MarkPublished(events[len(events)-1].Id, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sleep waits for a while, returning false early should the context be done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
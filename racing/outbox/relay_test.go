@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// openTestOutbox opens an outbox over a scratch database, holding the creation events of 100 dummy races with IDs
+// 1 to 100.
+func openTestOutbox(t *testing.T) (*sql.DB, db.OutboxRepo) {
+	t.Helper()
+
+	racingDB, err := db.Open(filepath.Join(t.TempDir(), "racing.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { racingDB.Close() })
+
+	if err := db.NewRacesRepo(racingDB, true).Init(); err != nil {
+		t.Fatalf("initialising races: %s", err)
+	}
+
+	outboxRepo := db.NewOutboxRepo(racingDB)
+	if err := outboxRepo.Init(); err != nil {
+		t.Fatalf("initialising outbox: %s", err)
+	}
+
+	return racingDB, outboxRepo
+}
+
+// flakyPublisher fails to publish batches holding the event it's told to, and the first few batches of all.
+type flakyPublisher struct {
+	Publisher
+
+	mu       sync.Mutex
+	failures int
+	poison   int64
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, events []*racing.RaceEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("publisher unavailable")
+	}
+
+	for _, event := range events {
+		if event.Id == p.poison {
+			return errors.New("event rejected")
+		}
+	}
+
+	return p.Publisher.Publish(ctx, events)
+}
+
+// runRelay runs a relay, retrying quickly, until the test ends.
+func runRelay(t *testing.T, outboxRepo db.OutboxRepo, publisher Publisher, maxAttempts int) {
+	t.Helper()
+
+	r := NewRelay(outboxRepo, publisher, time.Hour).(*relay)
+	r.maxAttempts = maxAttempts
+	r.initialBackoff = time.Millisecond
+	r.maxBackoff = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// readEventIDs waits for the file to hold n events, returning their IDs in the order they were published.
+func readEventIDs(t *testing.T, path string, n int) []int64 {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var ids []int64
+
+		// The relay may be part way through writing a line, so only whole lines are read.
+		if buf, err := ioutil.ReadFile(path); err == nil {
+			buf = buf[:bytes.LastIndexByte(buf, '\n')+1]
+
+			scanner := bufio.NewScanner(bytes.NewReader(buf))
+			for scanner.Scan() {
+				var event racing.RaceEvent
+				if err := protojson.Unmarshal(scanner.Bytes(), &event); err != nil {
+					t.Fatalf("reading event: %s", err)
+				}
+
+				ids = append(ids, event.Id)
+			}
+		}
+
+		if len(ids) >= n {
+			return ids
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events, want %d", len(ids), n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkPending fails the test should any events be left pending, once the relay has had a chance to mark those it
+// has published.
+func checkPending(t *testing.T, outboxRepo db.OutboxRepo) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		pending, err := outboxRepo.Pending(relayBatchSize)
+		if err != nil {
+			t.Fatalf("reading pending events: %s", err)
+		}
+
+		if len(pending) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events are still pending", len(pending))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	_, outboxRepo := openTestOutbox(t)
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	runRelay(t, outboxRepo, NewFilePublisher(path), relayMaxAttempts)
+
+	ids := readEventIDs(t, path, 100)
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("event %d has ID %d, want %d", i, id, i+1)
+		}
+	}
+
+	checkPending(t, outboxRepo)
+}
+
+func TestRelayRetriesFailures(t *testing.T) {
+	_, outboxRepo := openTestOutbox(t)
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	// Failing fewer times than the attempts allowed dead letters nothing.
+	runRelay(t, outboxRepo, &flakyPublisher{Publisher: NewFilePublisher(path), failures: 4}, 5)
+
+	ids := readEventIDs(t, path, 100)
+	if len(ids) != 100 || ids[0] != 1 || ids[99] != 100 {
+		t.Errorf("got events %v, want 1 to 100", ids)
+	}
+
+	checkPending(t, outboxRepo)
+}
+
+func TestRelayDeadLettersEventsWhichKeepFailing(t *testing.T) {
+	racingDB, outboxRepo := openTestOutbox(t)
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	runRelay(t, outboxRepo, &flakyPublisher{Publisher: NewFilePublisher(path), poison: 3}, 3)
+
+	// The events either side of the poison event are still published, in order.
+	ids := readEventIDs(t, path, 99)
+
+	var want []int64
+	for id := int64(1); id <= 100; id++ {
+		if id != 3 {
+			want = append(want, id)
+		}
+	}
+
+	var published []int64
+	seen := make(map[int64]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			published = append(published, id)
+		}
+	}
+
+	if len(published) != len(want) {
+		t.Fatalf("published events %v, want %v", published, want)
+	}
+	for i := range want {
+		if published[i] != want[i] {
+			t.Fatalf("published events %v, want %v", published, want)
+		}
+	}
+
+	checkPending(t, outboxRepo)
+
+	var failure string
+	if err := racingDB.QueryRow(`SELECT failure FROM outbox WHERE id = 3 AND failed_at IS NOT NULL AND published_at IS NULL`).Scan(&failure); err != nil {
+		t.Fatalf("reading dead lettered event: %s", err)
+	}
+	if failure != "event rejected" {
+		t.Errorf("event failed with %q, want %q", failure, "event rejected")
+	}
+}
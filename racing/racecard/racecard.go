@@ -0,0 +1,337 @@
+// Package racecard reads race cards from the feeds they're imported from.
+//
+// A JSON feed is a racing.RaceCard in its JSON form, such as:
+//
+//	{
+//	  "meetings": [{
+//	    "external_id": "FLEM-20261020",
+//	    "name": "Flemington",
+//	    "race_type": "RACE_TYPE_THOROUGHBRED",
+//	    "country": "AU",
+//	    "races": [{
+//	      "external_id": "FLEM-20261020-R1",
+//	      "number": 1,
+//	      "name": "Maiden Plate",
+//	      "advertised_start_time": "2026-10-20T02:10:00Z",
+//	      "visible": true,
+//	      "brands": ["neds", "ladbrokes"],
+//	      "runners": [
+//	        {"external_id": "FLEM-20261020-R1-1", "number": 1, "name": "Fast Eddie"},
+//	        {"external_id": "FLEM-20261020-R1-2", "number": 2, "name": "Slow Sally", "scratched": true}
+//	      ]
+//	    }]
+//	  }]
+//	}
+//
+// A CSV feed has a row for each runner, with a header row naming its columns, which may come in any order:
+//
+//	meeting_external_id,meeting_name,race_type,meeting_country,race_external_id,race_number,race_name,advertised_start_time,visible,race_brands,runner_external_id,runner_number,runner_name,scratched
+//
+// The meeting and race columns are repeated on the row of each of their runners, and must agree across rows. A race
+// without runners has a single row with its runner columns left empty. Race types may leave off their RACE_TYPE_
+// prefix, and visible and scratched are true or false, with empty meaning false. An optional race_brands column lists
+// the brands a race is shown on separated by |, such as neds|ladbrokes, with empty meaning every brand, and an
+// optional meeting_country column the country code of the meeting, such as AU.
+package racecard
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// Format is the format of a feed.
+type Format string
+
+// Supported feed formats.
+const (
+	JSON Format = "json"
+	CSV  Format = "csv"
+)
+
+// csvColumns lists the columns of a CSV feed.
+var csvColumns = []string{
+	"meeting_external_id",
+	"meeting_name",
+	"race_type",
+	"race_external_id",
+	"race_number",
+	"race_name",
+	"advertised_start_time",
+	"visible",
+	"runner_external_id",
+	"runner_number",
+	"runner_name",
+	"scratched",
+}
+
+const (
+	// brandsColumn is the optional column of a CSV feed listing the brands of a race.
+	brandsColumn = "race_brands"
+	// countryColumn is the optional column of a CSV feed giving the country of a meeting.
+	countryColumn = "meeting_country"
+)
+
+// FormatOf returns the format of a feed from its file extension.
+func FormatOf(path string) (Format, error) {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); Format(ext) {
+	case JSON, CSV:
+		return Format(ext), nil
+	default:
+		return "", fmt.Errorf("cannot tell the format of %q, expected a .json or .csv file", path)
+	}
+}
+
+// Read reads a race card from a feed of the given format. The card is only checked to be well formed, not valid.
+func Read(r io.Reader, format Format) (*racing.RaceCard, error) {
+	switch format {
+	case JSON:
+		return readJSON(r)
+	case CSV:
+		return readCSV(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q, must be json or csv", format)
+	}
+}
+
+func readJSON(r io.Reader) (*racing.RaceCard, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var card racing.RaceCard
+	if err := protojson.Unmarshal(data, &card); err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
+
+func readCSV(r io.Reader) (*racing.RaceCard, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.TrimSpace(column)] = i
+	}
+	for _, column := range csvColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("missing %q column", column)
+		}
+	}
+
+	var (
+		card     racing.RaceCard
+		meetings = make(map[string]*racing.RaceCardMeeting)
+		races    = make(map[string]*racing.RaceCardRace)
+	)
+
+	// Rows are numbered from the header row, which is the first.
+	for n := 2; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := csvRow{record: record, index: index, n: n}
+
+		meeting, err := row.meeting()
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := meetings[meeting.ExternalId]; ok {
+			if existing.Name != meeting.Name || existing.RaceType != meeting.RaceType || existing.Country != meeting.Country {
+				return nil, row.errorf("meeting %q differs from earlier rows", meeting.ExternalId)
+			}
+			meeting = existing
+		} else {
+			meetings[meeting.ExternalId] = meeting
+			card.Meetings = append(card.Meetings, meeting)
+		}
+
+		race, err := row.race()
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := races[race.ExternalId]; ok {
+			if !sameRace(existing, race) {
+				return nil, row.errorf("race %q differs from earlier rows", race.ExternalId)
+			}
+			race = existing
+		} else {
+			races[race.ExternalId] = race
+			meeting.Races = append(meeting.Races, race)
+		}
+
+		runner, err := row.runner()
+		if err != nil {
+			return nil, err
+		}
+		if runner != nil {
+			race.Runners = append(race.Runners, runner)
+		}
+	}
+
+	return &card, nil
+}
+
+// sameRace reports whether two races read from separate rows agree on their details.
+func sameRace(a, b *racing.RaceCardRace) bool {
+	return a.Number == b.Number &&
+		a.Name == b.Name &&
+		a.Visible == b.Visible &&
+		strings.Join(a.Brands, "|") == strings.Join(b.Brands, "|") &&
+		a.AdvertisedStartTime.GetSeconds() == b.AdvertisedStartTime.GetSeconds() &&
+		a.AdvertisedStartTime.GetNanos() == b.AdvertisedStartTime.GetNanos()
+}
+
+// csvRow is a row of a CSV feed.
+type csvRow struct {
+	record []string
+	index  map[string]int
+	n      int
+}
+
+func (r csvRow) get(column string) string {
+	return strings.TrimSpace(r.record[r.index[column]])
+}
+
+func (r csvRow) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("row %d: %s", r.n, fmt.Sprintf(format, args...))
+}
+
+func (r csvRow) meeting() (*racing.RaceCardMeeting, error) {
+	raceType := strings.ToUpper(r.get("race_type"))
+	if raceType != "" && !strings.HasPrefix(raceType, "RACE_TYPE_") {
+		raceType = "RACE_TYPE_" + raceType
+	}
+
+	value, ok := racing.RaceType_value[raceType]
+	if !ok && raceType != "" {
+		return nil, r.errorf("unknown race_type %q", r.get("race_type"))
+	}
+
+	meeting := &racing.RaceCardMeeting{
+		ExternalId: r.get("meeting_external_id"),
+		Name:       r.get("meeting_name"),
+		RaceType:   racing.RaceType(value),
+	}
+
+	if _, ok := r.index[countryColumn]; ok {
+		meeting.Country = strings.ToUpper(r.get(countryColumn))
+	}
+
+	return meeting, nil
+}
+
+func (r csvRow) race() (*racing.RaceCardRace, error) {
+	number, err := r.int("race_number")
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := r.bool("visible")
+	if err != nil {
+		return nil, err
+	}
+
+	race := &racing.RaceCardRace{
+		ExternalId: r.get("race_external_id"),
+		Number:     number,
+		Name:       r.get("race_name"),
+		Visible:    visible,
+	}
+
+	if _, ok := r.index[brandsColumn]; ok {
+		for _, brand := range strings.Split(r.get(brandsColumn), "|") {
+			if brand = strings.TrimSpace(brand); brand != "" {
+				race.Brands = append(race.Brands, brand)
+			}
+		}
+	}
+
+	if start := r.get("advertised_start_time"); start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, r.errorf("advertised_start_time must be an RFC 3339 timestamp")
+		}
+
+		if race.AdvertisedStartTime, err = ptypes.TimestampProto(t); err != nil {
+			return nil, r.errorf("advertised_start_time %s", err)
+		}
+	}
+
+	return race, nil
+}
+
+// runner returns the runner of the row, or nil for a race without runners.
+func (r csvRow) runner() (*racing.RaceCardRunner, error) {
+	if r.get("runner_external_id") == "" && r.get("runner_number") == "" && r.get("runner_name") == "" {
+		return nil, nil
+	}
+
+	number, err := r.int("runner_number")
+	if err != nil {
+		return nil, err
+	}
+
+	scratched, err := r.bool("scratched")
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.RaceCardRunner{
+		ExternalId: r.get("runner_external_id"),
+		Number:     number,
+		Name:       r.get("runner_name"),
+		Scratched:  scratched,
+	}, nil
+}
+
+func (r csvRow) int(column string) (int64, error) {
+	value := r.get(column)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, r.errorf("%s must be an integer", column)
+	}
+
+	return n, nil
+}
+
+func (r csvRow) bool(column string) (bool, error) {
+	switch strings.ToLower(r.get(column)) {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	default:
+		return false, r.errorf("%s must be true or false", column)
+	}
+}
@@ -0,0 +1,95 @@
+// Package ratelimit limits how often each method of the racing service may be called, as a backstop to the limits
+// the gateway applies to each of its clients.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/tokenbucket"
+)
+
+// Limiter limits the calls made of each method, across every caller.
+type Limiter interface {
+	// UnaryServerInterceptor fails unary calls over the limit with ResourceExhausted.
+	UnaryServerInterceptor(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error)
+
+	// StreamServerInterceptor fails streaming calls over the limit with ResourceExhausted.
+	StreamServerInterceptor(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error
+}
+
+type limiter struct {
+	limit tokenbucket.Limit
+
+	mu      sync.Mutex
+	buckets map[string]*tokenbucket.Bucket
+}
+
+// NewLimiter creates a limiter allowing each method to be called up to the limit, unless the limit is zero.
+func NewLimiter(limit tokenbucket.Limit) Limiter {
+	return &limiter{limit: limit, buckets: make(map[string]*tokenbucket.Bucket)}
+}
+
+func (l *limiter) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := l.take(info.FullMethod, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (l *limiter) StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := l.take(info.FullMethod, time.Now()); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
+
+// take takes a token from the bucket of a method, or returns the error to fail the call with when there's none.
+func (l *limiter) take(method string, now time.Time) error {
+	if l.limit.Requests <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[method]
+	if !ok {
+		b = tokenbucket.NewBucket(l.limit, now)
+		l.buckets[method] = b
+	}
+	b.Refill(now)
+
+	if !b.Take() {
+		return errs.ResourceExhausted(fmt.Sprintf("rate limit of %s exceeded for %s", l.limit, method), b.Until(1))
+	}
+
+	return nil
+}
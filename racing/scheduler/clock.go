@@ -0,0 +1,27 @@
+package scheduler
+
+import "time"
+
+// Clock tells the scheduler the time, so that it can be driven by something other than the wall clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel receiving the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+// NewSystemClock creates a clock reading the system's wall clock.
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,164 @@
+// Package scheduler moves races on as their advertised start times pass, so clients needn't work out for themselves
+// whether a race has jumped.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+const (
+	// Actor is recorded against the transitions the scheduler makes.
+	Actor = "scheduler"
+	// jumpReason is recorded against the transitions the scheduler makes.
+	jumpReason = "advertised start time reached"
+)
+
+// jumpableStatuses are the statuses of races which jump once their advertised start time is reached. Postponed
+// races are left alone until they're reopened.
+var jumpableStatuses = []racing.RaceStatus{
+	racing.RaceStatus_RACE_STATUS_OPEN,
+	racing.RaceStatus_RACE_STATUS_CLOSED,
+	racing.RaceStatus_RACE_STATUS_SUSPENDED,
+}
+
+// Listener is told of each transition the scheduler makes.
+type Listener func(transition *racing.RaceStatusTransition)
+
+// Scheduler jumps races at their advertised start time.
+type Scheduler interface {
+	// Run jumps races as they start until the context is done. Races whose start was missed, such as while the
+	// service was down, are jumped straight away.
+	Run(ctx context.Context)
+}
+
+type scheduler struct {
+	racesRepo db.RacesRepo
+	clock     Clock
+	interval  time.Duration
+	listeners []Listener
+}
+
+// NewScheduler creates a new scheduler of the races in the races repository. Races are checked at least every
+// interval, so that changes to their start times or statuses are picked up.
+func NewScheduler(racesRepo db.RacesRepo, clock Clock, interval time.Duration, listeners ...Listener) Scheduler {
+	return &scheduler{
+		racesRepo: racesRepo,
+		clock:     clock,
+		interval:  interval,
+		listeners: listeners,
+	}
+}
+
+func (s *scheduler) Run(ctx context.Context) {
+	for {
+		now := s.clock.Now()
+
+		if err := s.jumpDue(now); err != nil {
+			log.Printf("failed jumping races: %s\n", err)
+		}
+
+		wait := s.interval
+		if next, err := s.nextStart(now); err != nil {
+			log.Printf("failed finding next race to jump: %s\n", err)
+		} else if !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(wait):
+		}
+	}
+}
+
+// jumpDue jumps every race whose advertised start time is no later than now.
+func (s *scheduler) jumpDue(now time.Time) error {
+	// Start times are stored to the second, so include the whole of the current second.
+	to, err := ptypes.TimestampProto(now.Truncate(time.Second).Add(time.Second))
+	if err != nil {
+		return err
+	}
+
+	races, err := s.racesRepo.List(db.ListRacesQuery{
+		Filter:     &racing.ListRacesRequestFilter{AdvertisedStartTimeTo: to},
+		Expression: jumpableExpression(),
+		Fields:     []string{"id", "status"},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, race := range races {
+		transitionedAt, err := ptypes.TimestampProto(now)
+		if err != nil {
+			return err
+		}
+
+		transition := &racing.RaceStatusTransition{
+			RaceId:         race.Id,
+			From:           race.Status,
+			To:             racing.RaceStatus_RACE_STATUS_JUMPED,
+			Actor:          Actor,
+			Reason:         jumpReason,
+			TransitionedAt: transitionedAt,
+		}
+
+		err = s.racesRepo.Transition(transition)
+		if errors.Is(err, db.ErrConflict) || errors.Is(err, db.ErrNotFound) {
+			// The race was changed since it was listed, so is reconsidered on the next pass.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, listener := range s.listeners {
+			listener(transition)
+		}
+	}
+
+	return nil
+}
+
+// nextStart returns the earliest advertised start time after now of a race yet to jump, or the zero time when
+// there is none.
+func (s *scheduler) nextStart(now time.Time) (time.Time, error) {
+	// Start times are stored to the second, and races starting within the current second are due already.
+	from, err := ptypes.TimestampProto(now.Truncate(time.Second).Add(time.Second))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	races, err := s.racesRepo.List(db.ListRacesQuery{
+		Filter:     &racing.ListRacesRequestFilter{AdvertisedStartTimeFrom: from},
+		Expression: jumpableExpression(),
+		Limit:      1,
+		ByStart:    true,
+		Fields:     []string{"advertised_start_time"},
+	})
+	if err != nil || len(races) == 0 {
+		return time.Time{}, err
+	}
+
+	return ptypes.Timestamp(races[0].AdvertisedStartTime)
+}
+
+// jumpableExpression is a filter expression matching races with a jumpable status.
+func jumpableExpression() string {
+	terms := make([]string, 0, len(jumpableStatuses))
+	for _, status := range jumpableStatuses {
+		terms = append(terms, "status = "+status.String())
+	}
+
+	return strings.Join(terms, " OR ")
+}
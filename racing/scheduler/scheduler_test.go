@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// fakeClock is a clock which only moves on when told to, reporting each wait the scheduler starts.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waits: make(chan time.Duration), fire: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+// wait returns how long the scheduler waits next, once it's checked for races to jump.
+func (c *fakeClock) wait(t *testing.T) time.Duration {
+	t.Helper()
+
+	select {
+	case d := <-c.waits:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler never waited")
+		return 0
+	}
+}
+
+// advance moves the clock on, waking the scheduler.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	c.mu.Unlock()
+
+	c.fire <- now
+}
+
+// openTestRepo opens a races repository over a scratch database holding races starting at the given times, with
+// the given statuses.
+func openTestRepo(t *testing.T, starts map[int64]time.Time, statuses map[int64]racing.RaceStatus) db.RacesRepo {
+	t.Helper()
+
+	racingDB, err := db.Open(filepath.Join(t.TempDir(), "racing.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { racingDB.Close() })
+
+	racesRepo := db.NewRacesRepo(racingDB, false)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("initialising races: %s", err)
+	}
+
+	for id, start := range starts {
+		_, err := racingDB.Exec(
+			`INSERT INTO races(id, meeting_id, name, number, visible, advertised_start_time, race_type, status) VALUES (?,1,'',1,1,?,1,?)`,
+			id,
+			start.UTC().Format(time.RFC3339),
+			statuses[id],
+		)
+		if err != nil {
+			t.Fatalf("inserting race %d: %s", id, err)
+		}
+	}
+
+	return racesRepo
+}
+
+// checkStatuses fails the test should any of the races not have the status wanted of it.
+func checkStatuses(t *testing.T, racesRepo db.RacesRepo, want map[int64]racing.RaceStatus) {
+	t.Helper()
+
+	for id, status := range want {
+		race, err := racesRepo.Get(id, []string{"status"})
+		if err != nil {
+			t.Fatalf("getting race %d: %s", id, err)
+		}
+		if race.Status != status {
+			t.Errorf("race %d has status %s, want %s", id, race.Status, status)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 500*int(time.Millisecond), time.UTC)
+
+	var (
+		open      = racing.RaceStatus_RACE_STATUS_OPEN
+		suspended = racing.RaceStatus_RACE_STATUS_SUSPENDED
+		jumped    = racing.RaceStatus_RACE_STATUS_JUMPED
+		postponed = racing.RaceStatus_RACE_STATUS_POSTPONED
+		abandoned = racing.RaceStatus_RACE_STATUS_ABANDONED
+	)
+
+	racesRepo := openTestRepo(t, map[int64]time.Time{
+		1: now.Add(-time.Hour),
+		2: now.Add(-time.Hour),
+		3: now.Add(5 * time.Minute),
+		4: now.Add(10*time.Minute - 500*time.Millisecond),
+		5: now.Add(30*time.Minute - 500*time.Millisecond),
+	}, map[int64]racing.RaceStatus{
+		1: open,
+		2: postponed,
+		3: abandoned,
+		4: open,
+		5: suspended,
+	})
+
+	var (
+		mu          sync.Mutex
+		transitions []*racing.RaceStatusTransition
+	)
+	listener := func(transition *racing.RaceStatusTransition) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		transitions = append(transitions, transition)
+	}
+
+	clock := newFakeClock(now)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewScheduler(racesRepo, clock, time.Hour, listener).Run(ctx)
+	}()
+
+	// Missed starts are jumped straight away, while postponed and abandoned races are left alone, and the scheduler
+	// wakes at the next start.
+	if wait := clock.wait(t); wait != 10*time.Minute-500*time.Millisecond {
+		t.Errorf("first wait is %s, want %s", wait, 10*time.Minute-500*time.Millisecond)
+	}
+	checkStatuses(t, racesRepo, map[int64]racing.RaceStatus{1: jumped, 2: postponed, 3: abandoned, 4: open, 5: suspended})
+
+	clock.advance(10*time.Minute - 500*time.Millisecond)
+	if wait := clock.wait(t); wait != 20*time.Minute {
+		t.Errorf("second wait is %s, want %s", wait, 20*time.Minute)
+	}
+	checkStatuses(t, racesRepo, map[int64]racing.RaceStatus{4: jumped, 5: suspended})
+
+	// With no races left to jump, the scheduler waits out its interval.
+	clock.advance(20 * time.Minute)
+	if wait := clock.wait(t); wait != time.Hour {
+		t.Errorf("last wait is %s, want %s", wait, time.Hour)
+	}
+	checkStatuses(t, racesRepo, map[int64]racing.RaceStatus{5: jumped})
+
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var jumpedIDs []int64
+	for _, transition := range transitions {
+		if transition.To != jumped || transition.Actor != Actor {
+			t.Errorf("unexpected transition %v", transition)
+		}
+
+		jumpedIDs = append(jumpedIDs, transition.RaceId)
+	}
+	if len(jumpedIDs) != 3 || jumpedIDs[0] != 1 || jumpedIDs[1] != 4 || jumpedIDs[2] != 5 {
+		t.Errorf("jumped races %v, want [1 4 5]", jumpedIDs)
+	}
+}
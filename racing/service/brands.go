@@ -0,0 +1,36 @@
+package service
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"git.neds.sh/matty/entain/racing/db"
+)
+
+const (
+	// brandMetadataKey is the metadata callers name the brand they're calling for with, which the gateway sets
+	// from the X-Brand header.
+	brandMetadataKey = "x-brand"
+	// allBrandsMetadataKey is the metadata admins read races across every brand with, by setting it to true. The
+	// gateway never forwards it, so only callers reaching racing directly can.
+	allBrandsMetadataKey = "x-all-brands"
+)
+
+// brandScope returns the scope races are read in for a call. Calls naming no brand only see the races shown on
+// every brand.
+func brandScope(ctx context.Context) db.BrandScope {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(allBrandsMetadataKey); len(values) > 0 && strings.EqualFold(values[0], "true") {
+		return db.AllBrands
+	}
+
+	var brand string
+	if values := md.Get(brandMetadataKey); len(values) > 0 {
+		brand = strings.ToLower(strings.TrimSpace(values[0]))
+	}
+
+	return db.ForBrand(brand)
+}
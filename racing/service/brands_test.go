@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/nexttojump"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// headerStream takes the headers a call sets, as the gRPC server would.
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string {
+	return "/racing.Racing/Test"
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerStream) SetTrailer(metadata.MD) error {
+	return nil
+}
+
+// callContext returns the context of a call made with the given metadata pairs.
+func callContext(pairs ...string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+
+	return grpc.NewContextWithServerTransportStream(ctx, &headerStream{})
+}
+
+func TestBrandScope(t *testing.T) {
+	tests := map[string]struct {
+		pairs []string
+		want  db.BrandScope
+	}{
+		"no brand":                   {nil, db.ForBrand("")},
+		"brand":                      {[]string{brandMetadataKey, " Neds "}, db.ForBrand("neds")},
+		"all brands":                 {[]string{allBrandsMetadataKey, "TRUE", brandMetadataKey, "neds"}, db.AllBrands},
+		"all brands other than true": {[]string{allBrandsMetadataKey, "yes", brandMetadataKey, "neds"}, db.ForBrand("neds")},
+		"all brands set to false":    {[]string{allBrandsMetadataKey, "false"}, db.ForBrand("")},
+	}
+
+	for name, test := range tests {
+		if got := brandScope(callContext(test.pairs...)); got != test.want {
+			t.Errorf("%s: got scope %s, want %s", name, got, test.want)
+		}
+	}
+}
+
+func TestRacesAreScopedToTheCallersBrand(t *testing.T) {
+	racingDB, racesRepo := openTestDB(t)
+	if _, err := racingDB.Exec(`INSERT INTO race_brands(race_id, brand) VALUES (1, 'neds')`); err != nil {
+		t.Fatalf("restricting race to neds: %s", err)
+	}
+
+	s := NewRacingService(racesRepo, nexttojump.NewIndex(racesRepo, time.Hour), nil)
+
+	tests := map[string]struct {
+		pairs []string
+		want  bool
+	}{
+		"the brand":     {[]string{brandMetadataKey, "neds"}, true},
+		"another brand": {[]string{brandMetadataKey, "ladbrokes"}, false},
+		"no brand":      {nil, false},
+		"all brands":    {[]string{allBrandsMetadataKey, "true"}, true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := callContext(test.pairs...)
+
+			_, err := s.GetRace(ctx, &racing.GetRaceRequest{Id: 1})
+			if got := err == nil; got != test.want {
+				t.Errorf("getting race got %v", err)
+			}
+			if !test.want && status.Code(err) != codes.NotFound {
+				t.Errorf("getting race hidden from the brand got %v, want NotFound", err)
+			}
+
+			batch, err := s.BatchGetRaces(ctx, &racing.BatchGetRacesRequest{Ids: []int64{1, 2}})
+			if err != nil {
+				t.Fatalf("getting races: %s", err)
+			}
+			if batch.Results[0].Found != test.want || !batch.Results[1].Found {
+				t.Errorf("got results %v", batch.Results)
+			}
+
+			list, err := s.ListRaces(ctx, &racing.ListRacesRequest{FilterExpression: "id <= 2"})
+			if err != nil {
+				t.Fatalf("listing races: %s", err)
+			}
+			if got := len(list.Races) == 2; got != test.want {
+				t.Errorf("listed %d races of 2", len(list.Races))
+			}
+		})
+	}
+
+	// Admin calls act on races whichever brand they're shown on.
+	_, err := s.TransitionRace(callContext(brandMetadataKey, "ladbrokes"), &racing.TransitionRaceRequest{
+		RaceId: 1,
+		Status: racing.RaceStatus_RACE_STATUS_SUSPENDED,
+		Actor:  "test",
+		Reason: "test",
+	})
+	if err != nil {
+		t.Errorf("transitioning race of another brand: %s", err)
+	}
+}
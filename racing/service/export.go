@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+const (
+	// exportChunkSize is roughly the number of bytes of races sent in each message of an export.
+	exportChunkSize = 32 * 1024
+
+	ndjsonContentType = "application/x-ndjson"
+	csvContentType    = "text/csv"
+)
+
+func (s *racingService) ExportRaces(in *racing.ExportRacesRequest, stream racing.Racing_ExportRacesServer) error {
+	format, err := exportFormat(stream.Context(), in.Format)
+	if err != nil {
+		return err
+	}
+
+	fields := readMaskFields(in.ReadMask)
+	if err := db.ValidateRaceFields(fields); err != nil {
+		return err
+	}
+
+	w := newExportWriter(stream, format, fields)
+	policy := jurisdictionPolicy(stream.Context(), s.rules)
+
+	err = callerRaces(stream.Context(), s.racesRepo, policy).Export(db.ListRacesQuery{
+		Filter:     in.Filter,
+		Expression: in.FilterExpression,
+		Fields:     fields,
+	}, func(race *racing.Race) error {
+		annotateRestrictions(race, policy, fields)
+		return w.write(race)
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.flush()
+}
+
+// exportFormat returns the format to export races in. Requests made through the REST gateway which don't ask for a
+// format are exported in the first format their Accept header allows.
+func exportFormat(ctx context.Context, format racing.ExportFormat) (racing.ExportFormat, error) {
+	if format != racing.ExportFormat_EXPORT_FORMAT_UNSPECIFIED {
+		return format, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	accept := strings.Join(md.Get("grpcgateway-accept"), ",")
+	if strings.TrimSpace(accept) == "" {
+		return racing.ExportFormat_EXPORT_FORMAT_NDJSON, nil
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0]))
+
+		switch mediaType {
+		case ndjsonContentType, "application/jsonl", "application/*", "*/*":
+			return racing.ExportFormat_EXPORT_FORMAT_NDJSON, nil
+		case csvContentType, "text/*":
+			return racing.ExportFormat_EXPORT_FORMAT_CSV, nil
+		}
+	}
+
+	return format, errs.InvalidArgument("format", "Accept must allow "+ndjsonContentType+" or "+csvContentType)
+}
+
+// exportWriter encodes exported races a line at a time, sending them on in chunks of whole lines.
+type exportWriter struct {
+	stream      racing.Racing_ExportRacesServer
+	contentType string
+	fields      []string
+	encode      func(race *racing.Race) ([]byte, error)
+	buf         bytes.Buffer
+}
+
+func newExportWriter(stream racing.Racing_ExportRacesServer, format racing.ExportFormat, fields []string) *exportWriter {
+	w := &exportWriter{stream: stream, fields: fields}
+
+	if format == racing.ExportFormat_EXPORT_FORMAT_CSV {
+		columns := exportColumns(fields)
+
+		header := make([]string, len(columns))
+		for i, fd := range columns {
+			header[i] = string(fd.Name())
+		}
+		w.buf.Write(csvLine(header))
+
+		w.contentType = csvContentType
+		w.encode = func(race *racing.Race) ([]byte, error) {
+			return encodeCSV(race, columns), nil
+		}
+	} else {
+		w.contentType = ndjsonContentType
+		w.encode = func(race *racing.Race) ([]byte, error) {
+			applyReadMask(race, w.fields)
+			return protojson.Marshal(race)
+		}
+	}
+
+	return w
+}
+
+func (w *exportWriter) write(race *racing.Race) error {
+	line, err := w.encode(race)
+	if err != nil {
+		return err
+	}
+
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+	w.buf.Write(line)
+
+	if w.buf.Len() >= exportChunkSize {
+		return w.flush()
+	}
+
+	return nil
+}
+
+// flush sends on the lines written since the last flush, if any.
+func (w *exportWriter) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	// The chunk is copied, as the buffer is reused once it's sent.
+	err := w.stream.Send(&httpbody.HttpBody{
+		ContentType: w.contentType,
+		Data:        append([]byte(nil), w.buf.Bytes()...),
+	})
+	w.buf.Reset()
+
+	return err
+}
+
+// exportColumns returns the fields of a race to export as CSV columns, in the order they're declared.
+func exportColumns(fields []string) []protoreflect.FieldDescriptor {
+	keep := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		keep[field] = true
+	}
+
+	descriptors := (&racing.Race{}).ProtoReflect().Descriptor().Fields()
+
+	var columns []protoreflect.FieldDescriptor
+	for i := 0; i < descriptors.Len(); i++ {
+		fd := descriptors.Get(i)
+		if len(fields) == 0 || keep[string(fd.Name())] {
+			columns = append(columns, fd)
+		}
+	}
+
+	return columns
+}
+
+// encodeCSV encodes the given fields of a race as a CSV line, with enums written by name, timestamps in RFC 3339 and
+// the items of repeated fields separated by |.
+func encodeCSV(race *racing.Race, columns []protoreflect.FieldDescriptor) []byte {
+	msg := race.ProtoReflect()
+
+	record := make([]string, len(columns))
+	for i, fd := range columns {
+		v := msg.Get(fd)
+
+		if !fd.IsList() {
+			record[i] = encodeCSVValue(fd, v, msg.Has(fd))
+			continue
+		}
+
+		list := v.List()
+		items := make([]string, list.Len())
+		for j := range items {
+			items[j] = encodeCSVValue(fd, list.Get(j), true)
+		}
+		record[i] = strings.Join(items, "|")
+	}
+
+	return csvLine(record)
+}
+
+// encodeCSVValue encodes a single value of a field for a CSV line.
+func encodeCSVValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, set bool) string {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.MessageKind:
+		if ts, ok := v.Message().Interface().(*timestamp.Timestamp); ok && set {
+			if t, err := ptypes.Timestamp(ts); err == nil {
+				return t.Format(time.RFC3339)
+			}
+		}
+
+		return ""
+	default:
+		return v.String()
+	}
+}
+
+// csvLine encodes a record as a CSV line, without its trailing newline.
+func csvLine(record []string) []byte {
+	var buf bytes.Buffer
+
+	w := csv.NewWriter(&buf)
+	_ = w.Write(record)
+	w.Flush()
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
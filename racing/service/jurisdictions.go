@@ -0,0 +1,61 @@
+package service
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// jurisdictionMetadataKey is the metadata callers name the jurisdiction they're calling from with, such as AU-SA,
+// which the gateway sets from the X-Jurisdiction header.
+const jurisdictionMetadataKey = "x-jurisdiction"
+
+// jurisdictionPolicy returns the policy of the jurisdiction of a call. Calls naming no jurisdiction get the default
+// policy.
+func jurisdictionPolicy(ctx context.Context, rules *jurisdiction.Rules) jurisdiction.Policy {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var name string
+	if values := md.Get(jurisdictionMetadataKey); len(values) > 0 {
+		name = strings.TrimSpace(values[0])
+	}
+
+	return rules.For(name)
+}
+
+// callerRaces returns the races repository scoped to the brand of a call, without the races hidden from its
+// jurisdiction.
+func callerRaces(ctx context.Context, racesRepo db.RacesRepo, policy jurisdiction.Policy) db.RacesRepo {
+	return racesRepo.
+		Scoped(brandScope(ctx)).
+		Excluding(db.Exclusion{Name: policy.Name, Expr: policy.Hidden()})
+}
+
+// annotateRestrictions sets why a race can't be bet on under a policy, when the restrictions are to be read.
+func annotateRestrictions(race *racing.Race, policy jurisdiction.Policy, fields []string) {
+	if !readsField(fields, "restrictions") {
+		return
+	}
+
+	race.Restrictions = policy.Restrictions(race)
+}
+
+// readsField reports whether a field is read under the given read mask fields.
+func readsField(fields []string, field string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/nexttojump"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+func TestJurisdictionPolicy(t *testing.T) {
+	rules, err := jurisdiction.Load(filepath.Join("..", "jurisdiction", "examples", "rules.json"))
+	if err != nil {
+		t.Fatalf("loading rules: %s", err)
+	}
+
+	tests := map[string]struct {
+		pairs []string
+		want  string
+	}{
+		"no jurisdiction": {nil, "default"},
+		"state":           {[]string{jurisdictionMetadataKey, " au-sa "}, "AU-SA"},
+		"unknown":         {[]string{jurisdictionMetadataKey, "GB"}, "default"},
+	}
+
+	for name, test := range tests {
+		if got := jurisdictionPolicy(callContext(test.pairs...), rules).Name; got != test.want {
+			t.Errorf("%s: got policy %s, want %s", name, got, test.want)
+		}
+	}
+}
+
+func TestRacesAreHiddenAndRestrictedByJurisdiction(t *testing.T) {
+	racingDB, racesRepo := openTestDB(t)
+
+	// Races of the US are hidden from AU, harness races of AU from NZ, and races of HK restricted everywhere. Race
+	// types are seeded at random, so are set for each country to have races of every type.
+	if _, err := racingDB.Exec(`UPDATE races SET race_type = id % 3 + 1`); err != nil {
+		t.Fatalf("setting race types: %s", err)
+	}
+	for country, ids := range map[string]string{"US": "1, 2, 3", "AU": "4, 5, 6, 7, 8, 9", "HK": "10, 11, 12"} {
+		if _, err := racingDB.Exec(`UPDATE races SET country = ? WHERE id IN (`+ids+`)`, country); err != nil {
+			t.Fatalf("setting countries: %s", err)
+		}
+	}
+
+	rules, err := jurisdiction.Load(filepath.Join("..", "jurisdiction", "examples", "rules.json"))
+	if err != nil {
+		t.Fatalf("loading rules: %s", err)
+	}
+
+	all, err := racesRepo.List(db.ListRacesQuery{})
+	if err != nil {
+		t.Fatalf("listing races: %s", err)
+	}
+
+	s := NewRacingService(racesRepo, nexttojump.NewIndex(racesRepo, time.Hour), rules)
+
+	for _, name := range []string{"", "AU", "AU-SA", "NZ"} {
+		t.Run("jurisdiction "+name, func(t *testing.T) {
+			policy := rules.For(name)
+			ctx := callContext(jurisdictionMetadataKey, name)
+
+			resp, err := s.ListRaces(ctx, &racing.ListRacesRequest{})
+			if err != nil {
+				t.Fatalf("listing races: %s", err)
+			}
+			listed := make(map[int64]*racing.Race, len(resp.Races))
+			for _, race := range resp.Races {
+				listed[race.Id] = race
+			}
+
+			// The races hidden in the database are those the policy itself hides.
+			hidden := 0
+			for _, race := range all {
+				got, shown := listed[race.Id]
+				if shown == policy.Hides(race) {
+					t.Errorf("race %d of %s, %s is shown is %t", race.Id, race.Country, race.RaceType, shown)
+					continue
+				}
+				if !shown {
+					hidden++
+
+					if _, err := s.GetRace(ctx, &racing.GetRaceRequest{Id: race.Id}); status.Code(err) != codes.NotFound {
+						t.Errorf("getting hidden race %d got %v, want NotFound", race.Id, err)
+					}
+					continue
+				}
+
+				want := strings.Join(policy.Restrictions(race), ",")
+				if restrictions := strings.Join(got.Restrictions, ","); restrictions != want {
+					t.Errorf("race %d of %s, %s is restricted by %q, want %q", race.Id, race.Country, race.RaceType, restrictions, want)
+				}
+			}
+
+			if (hidden > 0) != (name == "AU" || name == "AU-SA" || name == "NZ") {
+				t.Errorf("%d races hidden", hidden)
+			}
+		})
+	}
+
+	// Restrictions are only set when they're read.
+	race, err := s.GetRace(callContext(), &racing.GetRaceRequest{Id: 10, ReadMask: &field_mask.FieldMask{Paths: []string{"id", "name"}}})
+	if err != nil {
+		t.Fatalf("getting race: %s", err)
+	}
+	if len(race.Restrictions) > 0 {
+		t.Errorf("race read without its restrictions has restrictions %v", race.Restrictions)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"git.neds.sh/matty/entain/racing/nexttojump"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+func TestListNextToJump(t *testing.T) {
+	racingDB, racesRepo := openTestDB(t)
+
+	// Every race is open and starts a minute apart, with even races thoroughbreds and odd ones greyhounds.
+	_, err := racingDB.Exec(`UPDATE races SET visible = 1, status = 1, race_type = id % 2 + 1,
+		advertised_start_time = strftime('%Y-%m-%dT%H:%M:%SZ', 'now', '+' || id || ' minutes')`)
+	if err != nil {
+		t.Fatalf("updating races: %s", err)
+	}
+
+	idx := nexttojump.NewIndex(racesRepo, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		idx.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	s := NewRacingService(racesRepo, idx, nil)
+
+	// The index is refreshed as it starts running.
+	var resp *racing.ListNextToJumpResponse
+	for deadline := time.Now().Add(5 * time.Second); len(resp.GetRaces()) == 0; time.Sleep(10 * time.Millisecond) {
+		if resp, err = s.ListNextToJump(callContext(), &racing.ListNextToJumpRequest{Limit: 3}); err != nil {
+			t.Fatalf("listing next to jump: %s", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("index was never refreshed")
+		}
+	}
+
+	if got := nextToJumpIDs(resp.Races); got != "1,2,3" {
+		t.Errorf("got races %s, want 1,2,3", got)
+	}
+	for _, race := range resp.Races {
+		if race.SecondsToJump <= 0 {
+			t.Errorf("race %d jumps in %ds", race.Race.Id, race.SecondsToJump)
+		}
+	}
+
+	// Grouping returns the next races of each race type there are races of, in race type order.
+	resp, err = s.ListNextToJump(callContext(), &racing.ListNextToJumpRequest{Limit: 3, GroupByRaceType: true})
+	if err != nil {
+		t.Fatalf("listing next to jump: %s", err)
+	}
+	if len(resp.Races) != 0 || len(resp.Groups) != 2 {
+		t.Fatalf("got %d races and %d groups, want 2 groups", len(resp.Races), len(resp.Groups))
+	}
+
+	want := map[racing.RaceType]string{
+		racing.RaceType_RACE_TYPE_THOROUGHBRED: "2,4,6",
+		racing.RaceType_RACE_TYPE_GREYHOUND:    "1,3,5",
+	}
+	for i, raceType := range []racing.RaceType{racing.RaceType_RACE_TYPE_THOROUGHBRED, racing.RaceType_RACE_TYPE_GREYHOUND} {
+		group := resp.Groups[i]
+		if group.RaceType != raceType {
+			t.Errorf("group %d is of %s, want %s", i, group.RaceType, raceType)
+		}
+		if got := nextToJumpIDs(group.Races); got != want[raceType] {
+			t.Errorf("got %s races %s, want %s", group.RaceType, got, want[raceType])
+		}
+	}
+}
+
+// nextToJumpIDs returns the IDs of the races, comma separated.
+func nextToJumpIDs(races []*racing.NextToJumpRace) string {
+	var ids string
+	for i, race := range races {
+		if i > 0 {
+			ids += ","
+		}
+		ids += strconv.FormatInt(race.Race.Id, 10)
+	}
+
+	return ids
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+const (
+	// maxPageSize is the largest page of races a single call can return.
+	maxPageSize = 1000
+)
+
+var errInvalidPageToken = errors.New("invalid page token")
+
+// encodePageToken returns an opaque token that resumes listing at the given offset.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodePageToken returns the offset held by a token from encodePageToken, an empty token starting at zero.
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidPageToken
+	}
+
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errInvalidPageToken
+	}
+
+	return offset, nil
+}
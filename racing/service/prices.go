@@ -0,0 +1,273 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultPriceHistoryPageSize is the number of prices ListPriceHistory returns when no page size is given.
+	defaultPriceHistoryPageSize = 100
+	// maxPriceHistoryPageSize is the most prices a single ListPriceHistory call will return.
+	maxPriceHistoryPageSize = 1000
+	// watchBatchSize is the most prices a watcher reads at once while catching up.
+	watchBatchSize = 256
+	// watchPollInterval is how often watchers check for prices published through other replicas, which they aren't
+	// woken for.
+	watchPollInterval = time.Second
+)
+
+type Pricing interface {
+	// GetPrices will return the current prices of the runners in a race.
+	GetPrices(ctx context.Context, in *racing.GetPricesRequest) (*racing.GetPricesResponse, error)
+
+	// ListPriceHistory will return the prices published for a race.
+	ListPriceHistory(ctx context.Context, in *racing.ListPriceHistoryRequest) (*racing.ListPriceHistoryResponse, error)
+
+	// WatchPrices will stream the prices of a race as they're published.
+	WatchPrices(in *racing.WatchPricesRequest, stream racing.Pricing_WatchPricesServer) error
+
+	// PublishPrices will publish new prices for runners in a race.
+	PublishPrices(ctx context.Context, in *racing.PublishPricesRequest) (*racing.PublishPricesResponse, error)
+}
+
+// pricingService implements the Pricing interface.
+type pricingService struct {
+	racesRepo  db.RacesRepo
+	pricesRepo db.PricesRepo
+	broker     *priceBroker
+	rules      *jurisdiction.Rules
+	// pollInterval is how often watchers check for prices they weren't woken for.
+	pollInterval time.Duration
+}
+
+// NewPricingService instantiates and returns a new pricingService. Rules may be nil, in which case no races are
+// hidden in any jurisdiction.
+func NewPricingService(racesRepo db.RacesRepo, pricesRepo db.PricesRepo, rules *jurisdiction.Rules) Pricing {
+	return &pricingService{racesRepo, pricesRepo, newPriceBroker(), rules, watchPollInterval}
+}
+
+func (s *pricingService) GetPrices(ctx context.Context, in *racing.GetPricesRequest) (*racing.GetPricesResponse, error) {
+	if err := s.checkRaceExists(ctx, in.RaceId); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.pricesRepo.Current(in.RaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.GetPricesResponse{Prices: prices}, nil
+}
+
+func (s *pricingService) ListPriceHistory(ctx context.Context, in *racing.ListPriceHistoryRequest) (*racing.ListPriceHistoryResponse, error) {
+	// Pages are keyed by the last sequence number returned, so prices published meanwhile don't shift them.
+	afterSequence, err := decodePageToken(in.PageToken)
+	if err != nil {
+		return nil, errs.InvalidArgument("page_token", err.Error())
+	}
+
+	pageSize := int(in.PageSize)
+	switch {
+	case pageSize == 0:
+		pageSize = defaultPriceHistoryPageSize
+	case pageSize > maxPriceHistoryPageSize:
+		pageSize = maxPriceHistoryPageSize
+	}
+
+	if err := s.checkRaceExists(ctx, in.RaceId); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.pricesRepo.History(in.RaceId, in.RunnerNumber, int64(afterSequence), pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &racing.ListPriceHistoryResponse{Prices: prices}
+	if len(prices) > pageSize {
+		resp.Prices = prices[:pageSize]
+		resp.NextPageToken = encodePageToken(int(resp.Prices[pageSize-1].Sequence))
+	}
+
+	return resp, nil
+}
+
+func (s *pricingService) WatchPrices(in *racing.WatchPricesRequest, stream racing.Pricing_WatchPricesServer) error {
+	if err := s.checkRaceExists(stream.Context(), in.RaceId); err != nil {
+		return err
+	}
+
+	// Subscribe before catching up, so that nothing published in between is missed.
+	sub := s.broker.subscribe(in.RaceId)
+	defer s.broker.unsubscribe(sub)
+
+	var (
+		backlog []*racing.Price
+		err     error
+	)
+	if in.AfterSequence > 0 {
+		backlog, err = s.pricesRepo.History(in.RaceId, 0, in.AfterSequence, -1)
+	} else {
+		backlog, err = s.pricesRepo.Current(in.RaceId)
+	}
+	if err != nil {
+		return err
+	}
+
+	sent := in.AfterSequence
+	for _, price := range backlog {
+		if err := stream.Send(price); err != nil {
+			return err
+		}
+
+		if price.Sequence > sent {
+			sent = price.Sequence
+		}
+	}
+
+	poll := time.NewTicker(s.pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-sub.wake:
+		case <-poll.C:
+		}
+
+		if sent, err = s.sendPublished(stream, in.RaceId, sent); err != nil {
+			return err
+		}
+	}
+}
+
+// sendPublished sends a watcher every price of a race published after the given sequence number, returning the last
+// sequence number sent. Prices are read back rather than handed over as they're published, so they're sent in the
+// order they were committed in, whichever replica published them.
+func (s *pricingService) sendPublished(stream racing.Pricing_WatchPricesServer, raceID, sent int64) (int64, error) {
+	for {
+		prices, err := s.pricesRepo.History(raceID, 0, sent, watchBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		for _, price := range prices {
+			if err := stream.Send(price); err != nil {
+				return sent, err
+			}
+			sent = price.Sequence
+		}
+
+		if len(prices) < watchBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+func (s *pricingService) PublishPrices(ctx context.Context, in *racing.PublishPricesRequest) (*racing.PublishPricesResponse, error) {
+	// Runner numbers are unique within a request, which the validation rules can't express.
+	var violations []errs.FieldViolation
+	seen := make(map[int64]bool, len(in.Prices))
+	for i, price := range in.Prices {
+		if seen[price.RunnerNumber] {
+			violations = append(violations, errs.FieldViolation{
+				Field:       "prices[" + strconv.Itoa(i) + "].runner_number",
+				Description: "must not be repeated",
+			})
+		}
+		seen[price.RunnerNumber] = true
+	}
+	if len(violations) > 0 {
+		return nil, errs.InvalidArguments(violations...)
+	}
+
+	prices, err := s.pricesRepo.Publish(in.RaceId, in.Prices, time.Now())
+	if err == db.ErrNotFound {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.broker.publish(in.RaceId)
+
+	return &racing.PublishPricesResponse{Prices: prices}, nil
+}
+
+// checkRaceExists returns a NotFound error when there is no such race shown to the caller.
+func (s *pricingService) checkRaceExists(ctx context.Context, raceID int64) error {
+	_, err := callerRaces(ctx, s.racesRepo, jurisdictionPolicy(ctx, s.rules)).Get(raceID, []string{"id"})
+	if err == db.ErrNotFound {
+		return errs.NotFound("race", strconv.FormatInt(raceID, 10))
+	}
+
+	return err
+}
+
+// priceBroker wakes the watchers of a race when prices are published for it through this replica.
+type priceBroker struct {
+	mu   sync.Mutex
+	subs map[int64]map[*priceSubscription]bool
+}
+
+// priceSubscription is woken when prices are published for a race. Wake-ups coming while it's already due one are
+// merged, as the watcher reads every price it hasn't yet sent when it wakes.
+type priceSubscription struct {
+	raceID int64
+	wake   chan struct{}
+}
+
+func newPriceBroker() *priceBroker {
+	return &priceBroker{subs: make(map[int64]map[*priceSubscription]bool)}
+}
+
+func (b *priceBroker) subscribe(raceID int64) *priceSubscription {
+	sub := &priceSubscription{raceID: raceID, wake: make(chan struct{}, 1)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[raceID] == nil {
+		b.subs[raceID] = make(map[*priceSubscription]bool)
+	}
+	b.subs[raceID][sub] = true
+
+	return sub
+}
+
+func (b *priceBroker) unsubscribe(sub *priceSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+func (b *priceBroker) publish(raceID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs[raceID] {
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove forgets a subscription, and must be called with the lock held.
+func (b *priceBroker) remove(sub *priceSubscription) {
+	delete(b.subs[sub.raceID], sub)
+
+	if len(b.subs[sub.raceID]) == 0 {
+		delete(b.subs, sub.raceID)
+	}
+}
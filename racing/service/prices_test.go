@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+
+	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// openTestDB opens a scratch database, seeded with 100 dummy races with IDs 1 to 100.
+func openTestDB(t *testing.T) (*sql.DB, db.RacesRepo) {
+	t.Helper()
+
+	racingDB, err := db.Open(filepath.Join(t.TempDir(), "racing.db"))
+	if err != nil {
+		t.Fatalf("opening database: %s", err)
+	}
+	t.Cleanup(func() { racingDB.Close() })
+
+	racesRepo := db.NewRacesRepo(racingDB, true)
+	if err := racesRepo.Init(); err != nil {
+		t.Fatalf("initialising races: %s", err)
+	}
+
+	return racingDB, racesRepo
+}
+
+// watchStream collects the prices sent to a watcher.
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	prices chan *racing.Price
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(price *racing.Price) error {
+	s.prices <- price
+	return nil
+}
+
+// watch starts watching the prices of a race, returning the stream prices are sent to.
+func watch(t *testing.T, s *pricingService, in *racing.WatchPricesRequest) *watchStream {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{ctx: ctx, prices: make(chan *racing.Price, 100)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.WatchPrices(in, stream)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return stream
+}
+
+// receive waits for the next prices sent to a watcher, failing should they not come.
+func (s *watchStream) receive(t *testing.T, n int) []*racing.Price {
+	t.Helper()
+
+	var prices []*racing.Price
+	for len(prices) < n {
+		select {
+		case price := <-s.prices:
+			prices = append(prices, price)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d prices, want %d", len(prices), n)
+		}
+	}
+
+	return prices
+}
+
+func newTestPricingService(t *testing.T, pollInterval time.Duration) (*pricingService, db.PricesRepo) {
+	t.Helper()
+
+	racingDB, racesRepo := openTestDB(t)
+
+	pricesRepo := db.NewPricesRepo(racingDB)
+	if err := pricesRepo.Init(); err != nil {
+		t.Fatalf("initialising prices: %s", err)
+	}
+
+	s := NewPricingService(racesRepo, pricesRepo, nil).(*pricingService)
+	s.pollInterval = pollInterval
+
+	return s, pricesRepo
+}
+
+// checkSequences checks prices were sent in commit order, without any being skipped.
+func checkSequences(t *testing.T, prices []*racing.Price, after int64) {
+	t.Helper()
+
+	for _, price := range prices {
+		if price.Sequence != after+1 {
+			t.Fatalf("sent sequence %d after %d, want %d", price.Sequence, after, after+1)
+		}
+		after = price.Sequence
+	}
+}
+
+func TestWatchPricesSendsInCommitOrder(t *testing.T) {
+	// Watchers are only woken by publishing, never polling.
+	s, pricesRepo := newTestPricingService(t, time.Hour)
+	stream := watch(t, s, &racing.WatchPricesRequest{RaceId: 1})
+
+	// Wait for the watcher to subscribe, so it's woken by the publishes below.
+	for {
+		s.broker.mu.Lock()
+		subscribed := len(s.broker.subs[1]) > 0
+		s.broker.mu.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Both are committed before the watcher is woken, as happens when publishes race.
+	for _, win := range []float64{2, 3} {
+		if _, err := pricesRepo.Publish(1, []*racing.RunnerPrice{{RunnerNumber: 1, Win: win, Place: 1.5}}, time.Now()); err != nil {
+			t.Fatalf("publishing: %s", err)
+		}
+	}
+	s.broker.publish(1)
+
+	prices := stream.receive(t, 2)
+	checkSequences(t, prices, 0)
+	if prices[0].Win != 2 || prices[1].Win != 3 {
+		t.Errorf("sent wins %v and %v, want 2 and 3", prices[0].Win, prices[1].Win)
+	}
+
+	resp, err := s.PublishPrices(context.Background(), &racing.PublishPricesRequest{
+		RaceId: 1,
+		Prices: []*racing.RunnerPrice{{RunnerNumber: 1, Win: 4, Place: 2}, {RunnerNumber: 2, Win: 5, Place: 2}},
+	})
+	if err != nil {
+		t.Fatalf("PublishPrices failed: %s", err)
+	}
+
+	checkSequences(t, stream.receive(t, 2), resp.Prices[0].Sequence-1)
+}
+
+func TestWatchPricesPollsForPricesPublishedElsewhere(t *testing.T) {
+	s, pricesRepo := newTestPricingService(t, 10*time.Millisecond)
+
+	published, err := pricesRepo.Publish(2, []*racing.RunnerPrice{{RunnerNumber: 1, Win: 2, Place: 1.5}}, time.Now())
+	if err != nil {
+		t.Fatalf("publishing: %s", err)
+	}
+
+	stream := watch(t, s, &racing.WatchPricesRequest{RaceId: 2, AfterSequence: published[0].Sequence})
+
+	// Published as another replica would, without waking this one's watchers.
+	for i := 0; i < 3; i++ {
+		if _, err := pricesRepo.Publish(2, []*racing.RunnerPrice{{RunnerNumber: 1, Win: 3, Place: 1.5}}, time.Now()); err != nil {
+			t.Fatalf("publishing: %s", err)
+		}
+	}
+
+	checkSequences(t, stream.receive(t, 3), published[0].Sequence)
+}
+
+func TestWatchPricesReplaysBacklog(t *testing.T) {
+	s, pricesRepo := newTestPricingService(t, time.Hour)
+
+	for _, runner := range []int64{1, 2, 1} {
+		if _, err := pricesRepo.Publish(3, []*racing.RunnerPrice{{RunnerNumber: runner, Win: 2, Place: 1.5}}, time.Now()); err != nil {
+			t.Fatalf("publishing: %s", err)
+		}
+	}
+
+	// Current prices are sent first, one per runner.
+	current := watch(t, s, &racing.WatchPricesRequest{RaceId: 3}).receive(t, 2)
+	if current[0].RunnerNumber == current[1].RunnerNumber {
+		t.Errorf("sent runner %d twice, want each runner's current price", current[0].RunnerNumber)
+	}
+
+	// Resuming replays everything after the sequence given.
+	checkSequences(t, watch(t, s, &racing.WatchPricesRequest{RaceId: 3, AfterSequence: 1}).receive(t, 2), 1)
+}
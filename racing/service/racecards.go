@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+var (
+	// brandPattern matches the names of brands, which are matched against the brand of calls once lowercased.
+	brandPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	// countryPattern matches the ISO 3166-1 alpha-2 codes meetings' countries are given by.
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// validateRaceCard checks that a race card can be imported, returning each problem found with it. External IDs
+// must be unique across the card, and numbers unique within their meeting or race.
+func validateRaceCard(card *racing.RaceCard) []errs.FieldViolation {
+	if len(card.GetMeetings()) == 0 {
+		return []errs.FieldViolation{{Field: "card.meetings", Description: "must not be empty"}}
+	}
+
+	var (
+		violations []errs.FieldViolation
+		meetingIDs = make(map[string]bool)
+		raceIDs    = make(map[string]bool)
+		runnerIDs  = make(map[string]bool)
+	)
+
+	violate := func(field, description string) {
+		violations = append(violations, errs.FieldViolation{Field: field, Description: description})
+	}
+
+	// checkExternalID checks an external ID is given, and hasn't already been seen.
+	checkExternalID := func(path, id string, seen map[string]bool) {
+		switch {
+		case strings.TrimSpace(id) == "":
+			violate(path+".external_id", "must not be empty")
+		case seen[id]:
+			violate(path+".external_id", "must not be repeated")
+		}
+		seen[id] = true
+	}
+
+	// checkNumber checks a number is positive, and hasn't already been seen.
+	checkNumber := func(path string, number int64, seen map[int64]bool) {
+		switch {
+		case number <= 0:
+			violate(path+".number", "must be positive")
+		case seen[number]:
+			violate(path+".number", "must not be repeated")
+		}
+		seen[number] = true
+	}
+
+	for i, meeting := range card.Meetings {
+		path := fmt.Sprintf("card.meetings[%d]", i)
+
+		checkExternalID(path, meeting.ExternalId, meetingIDs)
+		if strings.TrimSpace(meeting.Name) == "" {
+			violate(path+".name", "must not be empty")
+		}
+		if _, ok := racing.RaceType_name[int32(meeting.RaceType)]; !ok || meeting.RaceType == racing.RaceType_RACE_TYPE_UNSPECIFIED {
+			violate(path+".race_type", "must be a race type")
+		}
+		if meeting.Country != "" && !countryPattern.MatchString(meeting.Country) {
+			violate(path+".country", "must be an uppercase two letter country code")
+		}
+
+		raceNumbers := make(map[int64]bool)
+		for j, race := range meeting.Races {
+			path := fmt.Sprintf("%s.races[%d]", path, j)
+
+			checkExternalID(path, race.ExternalId, raceIDs)
+			checkNumber(path, race.Number, raceNumbers)
+			if strings.TrimSpace(race.Name) == "" {
+				violate(path+".name", "must not be empty")
+			}
+			if race.AdvertisedStartTime == nil {
+				violate(path+".advertised_start_time", "must be given")
+			} else if _, err := ptypes.Timestamp(race.AdvertisedStartTime); err != nil {
+				violate(path+".advertised_start_time", "must be a valid timestamp")
+			}
+
+			brands := make(map[string]bool)
+			for k, brand := range race.Brands {
+				switch {
+				case !brandPattern.MatchString(brand):
+					violate(fmt.Sprintf("%s.brands[%d]", path, k), "must be lowercase letters, digits and dashes")
+				case brands[brand]:
+					violate(fmt.Sprintf("%s.brands[%d]", path, k), "must not be repeated")
+				}
+				brands[brand] = true
+			}
+
+			runnerNumbers := make(map[int64]bool)
+			for k, runner := range race.Runners {
+				path := fmt.Sprintf("%s.runners[%d]", path, k)
+
+				checkExternalID(path, runner.ExternalId, runnerIDs)
+				checkNumber(path, runner.Number, runnerNumbers)
+				if strings.TrimSpace(runner.Name) == "" {
+					violate(path+".name", "must not be empty")
+				}
+			}
+		}
+	}
+
+	return violations
+}
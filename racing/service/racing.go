@@ -1,31 +1,346 @@
 package service
 
 import (
+	"strconv"
+	"time"
+
 	"git.neds.sh/matty/entain/racing/db"
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/jurisdiction"
+	"git.neds.sh/matty/entain/racing/nexttojump"
 	"git.neds.sh/matty/entain/racing/proto/racing"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	"golang.org/x/net/context"
 )
 
+const (
+	// defaultNextToJumpLimit is the number of races ListNextToJump returns when no limit is given.
+	defaultNextToJumpLimit = 10
+	// maxNextToJumpLimit is the most races ListNextToJump will return.
+	maxNextToJumpLimit = 100
+	// maxBatchGetRaces is the most races BatchGetRaces will get at once.
+	maxBatchGetRaces = 100
+)
+
+// raceTypes lists the race types ListNextToJump groups races by, in the order groups are returned.
+var raceTypes = []racing.RaceType{
+	racing.RaceType_RACE_TYPE_THOROUGHBRED,
+	racing.RaceType_RACE_TYPE_GREYHOUND,
+	racing.RaceType_RACE_TYPE_HARNESS,
+}
+
 type Racing interface {
 	// ListRaces will return a collection of races.
 	ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error)
+
+	// GetRace will return a single race by its ID.
+	GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.Race, error)
+
+	// BatchGetRaces will return the races with the given IDs, in the order asked for.
+	BatchGetRaces(ctx context.Context, in *racing.BatchGetRacesRequest) (*racing.BatchGetRacesResponse, error)
+
+	// ListRunners will return the runners of a race, in number order.
+	ListRunners(ctx context.Context, in *racing.ListRunnersRequest) (*racing.ListRunnersResponse, error)
+
+	// ExportRaces will stream every race matching the request as newline delimited JSON or CSV.
+	ExportRaces(in *racing.ExportRacesRequest, stream racing.Racing_ExportRacesServer) error
+
+	// ListNextToJump will return the next open races to jump.
+	ListNextToJump(ctx context.Context, in *racing.ListNextToJumpRequest) (*racing.ListNextToJumpResponse, error)
+
+	// TransitionRace will move a race to a new status, recording who made the change and why.
+	TransitionRace(ctx context.Context, in *racing.TransitionRaceRequest) (*racing.TransitionRaceResponse, error)
+
+	// ListRaceStatusTransitions will return the status changes of a race, oldest first.
+	ListRaceStatusTransitions(ctx context.Context, in *racing.ListRaceStatusTransitionsRequest) (*racing.ListRaceStatusTransitionsResponse, error)
+
+	// ImportRaceCard will create or update the meetings, races and runners of a race card.
+	ImportRaceCard(ctx context.Context, in *racing.ImportRaceCardRequest) (*racing.ImportRaceCardResponse, error)
 }
 
 // racingService implements the Racing interface.
 type racingService struct {
-	racesRepo db.RacesRepo
+	racesRepo     db.RacesRepo
+	nextToJumpIdx nexttojump.Index
+	rules         *jurisdiction.Rules
 }
 
-// NewRacingService instantiates and returns a new racingService.
-func NewRacingService(racesRepo db.RacesRepo) Racing {
-	return &racingService{racesRepo}
+// NewRacingService instantiates and returns a new racingService. Rules may be nil, in which case no races are hidden
+// or restricted in any jurisdiction.
+func NewRacingService(racesRepo db.RacesRepo, nextToJumpIdx nexttojump.Index, rules *jurisdiction.Rules) Racing {
+	return &racingService{racesRepo, nextToJumpIdx, rules}
 }
 
 func (s *racingService) ListRaces(ctx context.Context, in *racing.ListRacesRequest) (*racing.ListRacesResponse, error) {
-	races, err := s.racesRepo.List(in.Filter)
+	offset, err := decodePageToken(in.PageToken)
+	if err != nil {
+		return nil, errs.InvalidArgument("page_token", err.Error())
+	}
+
+	pageSize := int(in.PageSize)
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	fields := readMaskFields(in.ReadMask)
+
+	query := db.ListRacesQuery{
+		Filter:     in.Filter,
+		Expression: in.FilterExpression,
+		Offset:     offset,
+		Fields:     fields,
+	}
+	if pageSize > 0 {
+		// Ask for one race beyond the page, so we know whether another page follows.
+		query.Limit = pageSize + 1
+	}
+
+	if err := s.sendRevision(ctx); err != nil {
+		return nil, err
+	}
+
+	policy := jurisdictionPolicy(ctx, s.rules)
+	repo := callerRaces(ctx, s.racesRepo, policy)
+
+	races, err := repo.List(query)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, race := range races {
+		annotateRestrictions(race, policy, fields)
+		applyReadMask(race, fields)
+	}
+
+	resp := &racing.ListRacesResponse{Races: races}
+	if pageSize > 0 && len(races) > pageSize {
+		resp.Races = races[:pageSize]
+		resp.NextPageToken = encodePageToken(offset + pageSize)
+	}
+
+	if in.IncludeFacets {
+		resp.TotalSize, resp.Facets, err = repo.Facets(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *racingService) GetRace(ctx context.Context, in *racing.GetRaceRequest) (*racing.Race, error) {
+	fields := readMaskFields(in.ReadMask)
+
+	if err := s.sendRevision(ctx); err != nil {
+		return nil, err
+	}
+
+	policy := jurisdictionPolicy(ctx, s.rules)
+
+	race, err := callerRaces(ctx, s.racesRepo, policy).Get(in.Id, fields)
+	if err == db.ErrNotFound {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.Id, 10))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	annotateRestrictions(race, policy, fields)
+	applyReadMask(race, fields)
+
+	return race, nil
+}
+
+func (s *racingService) BatchGetRaces(ctx context.Context, in *racing.BatchGetRacesRequest) (*racing.BatchGetRacesResponse, error) {
+	// Each race is only read once, however many times it's asked for.
+	unique := make([]int64, 0, len(in.Ids))
+	seen := make(map[int64]bool, len(in.Ids))
+	for _, id := range in.Ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	fields := readMaskFields(in.ReadMask)
+
+	if err := s.sendRevision(ctx); err != nil {
+		return nil, err
+	}
+
+	policy := jurisdictionPolicy(ctx, s.rules)
+
+	races, err := callerRaces(ctx, s.racesRepo, policy).GetMany(unique, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*racing.Race, len(races))
+	for _, race := range races {
+		annotateRestrictions(race, policy, fields)
+		byID[race.Id] = race
+	}
+
+	resp := &racing.BatchGetRacesResponse{Results: make([]*racing.BatchGetRacesResult, len(in.Ids))}
+	for i, id := range in.Ids {
+		result := &racing.BatchGetRacesResult{Id: id}
+		if race, ok := byID[id]; ok {
+			// Races asked for more than once are copied, so that each result can be handed on separately.
+			result.Found, result.Race = true, maskedCopy(race, fields)
+		}
+
+		resp.Results[i] = result
+	}
+
+	return resp, nil
+}
+
+func (s *racingService) ListRunners(ctx context.Context, in *racing.ListRunnersRequest) (*racing.ListRunnersResponse, error) {
+	runners, err := callerRaces(ctx, s.racesRepo, jurisdictionPolicy(ctx, s.rules)).Runners(in.RaceId)
+	if err == db.ErrNotFound {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.ListRunnersResponse{Runners: runners}, nil
+}
+
+func (s *racingService) ListNextToJump(ctx context.Context, in *racing.ListNextToJumpRequest) (*racing.ListNextToJumpResponse, error) {
+	limit := int(in.Limit)
+	switch {
+	case limit == 0:
+		limit = defaultNextToJumpLimit
+	case limit > maxNextToJumpLimit:
+		limit = maxNextToJumpLimit
+	}
+
+	fields := readMaskFields(in.ReadMask)
+	if err := db.ValidateRaceFields(fields); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	scope := brandScope(ctx)
+	policy := jurisdictionPolicy(ctx, s.rules)
+
+	// Only the races the caller may be shown are indexed for them.
+	include := func(race *racing.Race) bool {
+		return scope.Includes(race) && !policy.Hides(race)
+	}
+
+	if !in.GroupByRaceType {
+		races := s.nextToJumpIdx.Next(now, limit, racing.RaceType_RACE_TYPE_UNSPECIFIED, include)
+		return &racing.ListNextToJumpResponse{Races: toNextToJump(now, races, policy, fields)}, nil
+	}
+
+	resp := &racing.ListNextToJumpResponse{}
+	for _, raceType := range raceTypes {
+		races := s.nextToJumpIdx.Next(now, limit, raceType, include)
+		if len(races) == 0 {
+			continue
+		}
+
+		resp.Groups = append(resp.Groups, &racing.NextToJumpGroup{
+			RaceType: raceType,
+			Races:    toNextToJump(now, races, policy, fields),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *racingService) TransitionRace(ctx context.Context, in *racing.TransitionRaceRequest) (*racing.TransitionRaceResponse, error) {
+	id := strconv.FormatInt(in.RaceId, 10)
+
+	// Admin calls act on races whichever brands they're shown on.
+	current, err := s.racesRepo.Get(in.RaceId, []string{"status"})
+	if err == db.ErrNotFound {
+		return nil, errs.NotFound("race", id)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &racing.ListRacesResponse{Races: races}, nil
+	if !canTransition(current.Status, in.Status) {
+		return nil, errs.FailedPrecondition(
+			errs.ReasonIllegalTransition,
+			"race/"+id,
+			"race cannot move from "+current.Status.String()+" to "+in.Status.String(),
+			map[string]string{"from": current.Status.String(), "to": in.Status.String()},
+		)
+	}
+
+	transition := &racing.RaceStatusTransition{
+		RaceId:         in.RaceId,
+		From:           current.Status,
+		To:             in.Status,
+		Actor:          in.Actor,
+		Reason:         in.Reason,
+		TransitionedAt: ptypes.TimestampNow(),
+	}
+	if err := s.racesRepo.Transition(transition); err != nil {
+		return nil, err
+	}
+
+	// Races leave or rejoin the next to jump as their status changes.
+	s.nextToJumpIdx.Invalidate()
+
+	race, err := s.racesRepo.Get(in.RaceId, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.TransitionRaceResponse{Race: race, Transition: transition}, nil
+}
+
+func (s *racingService) ListRaceStatusTransitions(ctx context.Context, in *racing.ListRaceStatusTransitionsRequest) (*racing.ListRaceStatusTransitionsResponse, error) {
+	// Admin calls act on races whichever brands they're shown on.
+	transitions, err := s.racesRepo.Transitions(in.RaceId)
+	if err == db.ErrNotFound {
+		return nil, errs.NotFound("race", strconv.FormatInt(in.RaceId, 10))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &racing.ListRaceStatusTransitionsResponse{Transitions: transitions}, nil
+}
+
+func (s *racingService) ImportRaceCard(ctx context.Context, in *racing.ImportRaceCardRequest) (*racing.ImportRaceCardResponse, error) {
+	if violations := validateRaceCard(in.Card); len(violations) > 0 {
+		return nil, errs.InvalidArguments(violations...)
+	}
+
+	changes, err := s.racesRepo.Import(in.Card, in.DryRun, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !in.DryRun {
+		s.nextToJumpIdx.Invalidate()
+	}
+
+	return &racing.ImportRaceCardResponse{Changes: changes, DryRun: in.DryRun}, nil
+}
+
+// toNextToJump pairs races with the number of seconds until they jump, annotating the restrictions of each race
+// under the policy and applying the read mask to it.
+func toNextToJump(now time.Time, races []*racing.Race, policy jurisdiction.Policy, fields []string) []*racing.NextToJumpRace {
+	next := make([]*racing.NextToJumpRace, 0, len(races))
+	for _, race := range races {
+		// Indexed races are shared between calls, so must be copied before being annotated or masked.
+		copied := proto.Clone(race).(*racing.Race)
+		annotateRestrictions(copied, policy, fields)
+		applyReadMask(copied, fields)
+
+		next = append(next, &racing.NextToJumpRace{
+			Race:          copied,
+			SecondsToJump: race.AdvertisedStartTime.Seconds - now.Unix(),
+		})
+	}
+
+	return next
 }
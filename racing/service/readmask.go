@@ -0,0 +1,53 @@
+package service
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// readMaskFields returns the fields named by a read mask, which is empty when every field should be read.
+func readMaskFields(mask *field_mask.FieldMask) []string {
+	return mask.GetPaths()
+}
+
+// applyReadMask clears each field of the race which isn't one of the given fields. Every field is kept when none
+// are given.
+func applyReadMask(race *racing.Race, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	keep := make(map[protoreflect.Name]bool, len(fields))
+	for _, field := range fields {
+		keep[protoreflect.Name(field)] = true
+	}
+
+	msg := race.ProtoReflect()
+
+	var clear []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !keep[fd.Name()] {
+			clear = append(clear, fd)
+		}
+		return true
+	})
+
+	for _, fd := range clear {
+		msg.Clear(fd)
+	}
+}
+
+// maskedCopy returns a copy of a shared race with the read mask applied, leaving the original untouched.
+func maskedCopy(race *racing.Race, fields []string) *racing.Race {
+	if len(fields) == 0 {
+		return race
+	}
+
+	masked := proto.Clone(race).(*racing.Race)
+	applyReadMask(masked, fields)
+
+	return masked
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+const (
+	// versionMetadataKey is the header metadata the version of races is sent as, alongside races read.
+	versionMetadataKey = "x-races-version"
+	// nextStartMetadataKey is the header metadata the next advertised start time of a race yet to jump is sent as,
+	// should there be one, as races read may change when it passes.
+	nextStartMetadataKey = "x-races-next-start"
+)
+
+// pendingStatuses are the statuses of races which are yet to jump.
+var pendingStatuses = []racing.RaceStatus{
+	racing.RaceStatus_RACE_STATUS_OPEN,
+	racing.RaceStatus_RACE_STATUS_CLOSED,
+	racing.RaceStatus_RACE_STATUS_SUSPENDED,
+}
+
+// sendRevision sends the revision races are at as header metadata, so that the gateway can tell whether clients
+// already hold the races they're asking for. It's read before the races it's sent with, so a change made between
+// the two leaves the races newer than their revision, rather than older.
+func (s *racingService) sendRevision(ctx context.Context) error {
+	revision, err := s.racesRepo.Revision(pendingStatuses)
+	if err != nil {
+		return err
+	}
+
+	md := metadata.Pairs(versionMetadataKey, strconv.FormatInt(revision.Version, 10))
+	if !revision.NextStart.IsZero() {
+		md.Append(nextStartMetadataKey, revision.NextStart.UTC().Format(time.RFC3339))
+	}
+
+	return grpc.SetHeader(ctx, md)
+}
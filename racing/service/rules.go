@@ -0,0 +1,75 @@
+package service
+
+import (
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/validate"
+)
+
+const (
+	// maxMeetingIDs is the most meetings a filter may name, keeping the queries built of them bounded.
+	maxMeetingIDs = 100
+	// maxPublishedPrices is the most runners PublishPrices will price at once.
+	maxPublishedPrices = 100
+)
+
+// Rules are the rules requests to the racing and pricing services are validated against, before reaching them.
+var Rules = validate.Rules{
+	"racing.ListRacesRequest": {
+		validate.Field("filter.meeting_ids", validate.MaxItems(maxMeetingIDs), validate.Positive()),
+		validate.Field("page_size", validate.NonNegative()),
+		validate.Field("filter_expression", validate.MaxLength(filterpkg.MaxLength)),
+	},
+	"racing.GetRaceRequest": {
+		validate.Field("id", validate.Positive()),
+	},
+	"racing.BatchGetRacesRequest": {
+		validate.Field("ids", validate.NotEmpty(), validate.MaxItems(maxBatchGetRaces), validate.Positive()),
+	},
+	"racing.ListRunnersRequest": {
+		validate.Field("race_id", validate.Positive()),
+	},
+	"racing.ListNextToJumpRequest": {
+		validate.Field("limit", validate.NonNegative()),
+	},
+	"racing.ExportRacesRequest": {
+		validate.Field("filter.meeting_ids", validate.MaxItems(maxMeetingIDs), validate.Positive()),
+		validate.Field("filter_expression", validate.MaxLength(filterpkg.MaxLength)),
+		validate.Field("format", validate.EnumOrUnspecified("an export format")),
+	},
+	"racing.TransitionRaceRequest": {
+		validate.Field("race_id", validate.Positive()),
+		validate.Field("status", validate.EnumOf("a race status")),
+		validate.Field("actor", validate.NotEmpty()),
+		validate.Field("reason", validate.NotEmpty()),
+	},
+	"racing.ListRaceStatusTransitionsRequest": {
+		validate.Field("race_id", validate.Positive()),
+	},
+	"racing.ImportRaceCardRequest": {
+		validate.Field("card.meetings", validate.NotEmpty()),
+		validate.Field("card.meetings.external_id", validate.NotEmpty()),
+		validate.Field("card.meetings.races.external_id", validate.NotEmpty()),
+		validate.Field("card.meetings.races.runners.external_id", validate.NotEmpty()),
+		validate.Field("card.meetings.races.runners.number", validate.Positive()),
+	},
+	"racing.GetPricesRequest": {
+		validate.Field("race_id", validate.Positive()),
+	},
+	"racing.ListPriceHistoryRequest": {
+		validate.Field("race_id", validate.Positive()),
+		validate.Field("runner_number", validate.NonNegative()),
+		validate.Field("page_size", validate.NonNegative()),
+	},
+	"racing.WatchPricesRequest": {
+		validate.Field("race_id", validate.Positive()),
+		validate.Field("after_sequence", validate.NonNegative()),
+	},
+	"racing.PublishPricesRequest": {
+		validate.Field("race_id", validate.Positive()),
+		validate.Field("prices", validate.NotEmpty(), validate.MaxItems(maxPublishedPrices)),
+		validate.Field("prices.runner_number", validate.Positive()),
+		// Decimal odds include the stake, so can never be below 1.
+		validate.Field("prices.win", validate.AtLeast(1)),
+		validate.Field("prices.place", validate.AtLeast(1)),
+	},
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	filterpkg "git.neds.sh/matty/entain/racing/filter"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+	"git.neds.sh/matty/entain/racing/validate"
+)
+
+func TestRulesOfImportRaceCardRequest(t *testing.T) {
+	validator, err := validate.NewValidator(Rules)
+	if err != nil {
+		t.Fatalf("creating validator: %s", err)
+	}
+
+	card := func() *racing.RaceCard {
+		return &racing.RaceCard{Meetings: []*racing.RaceCardMeeting{{
+			ExternalId: "FLEM-20261020",
+			Races: []*racing.RaceCardRace{{
+				ExternalId: "FLEM-20261020-R1",
+				Runners: []*racing.RaceCardRunner{
+					{ExternalId: "FLEM-20261020-R1-1", Number: 1},
+					{ExternalId: "FLEM-20261020-R1-2", Number: 2},
+				},
+			}},
+		}}}
+	}
+
+	tests := map[string]struct {
+		change func(card *racing.RaceCard)
+		want   []string
+	}{
+		"valid": {
+			change: func(*racing.RaceCard) {},
+		},
+		"no meetings": {
+			change: func(card *racing.RaceCard) { card.Meetings = nil },
+			want:   []string{"card.meetings"},
+		},
+		"missing external IDs": {
+			change: func(card *racing.RaceCard) {
+				card.Meetings[0].ExternalId = " "
+				card.Meetings[0].Races[0].ExternalId = ""
+				card.Meetings[0].Races[0].Runners[1].ExternalId = ""
+			},
+			want: []string{
+				"card.meetings[0].external_id",
+				"card.meetings[0].races[0].external_id",
+				"card.meetings[0].races[0].runners[1].external_id",
+			},
+		},
+		"runner numbers": {
+			change: func(card *racing.RaceCard) {
+				card.Meetings[0].Races[0].Runners[0].Number = 0
+				card.Meetings[0].Races[0].Runners[1].Number = -2
+			},
+			want: []string{
+				"card.meetings[0].races[0].runners[0].number",
+				"card.meetings[0].races[0].runners[1].number",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		c := card()
+		test.change(c)
+
+		var got []string
+		for _, violation := range validator.Validate(&racing.ImportRaceCardRequest{Card: c}) {
+			got = append(got, violation.Field)
+		}
+
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: got violations of %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestRulesOfFilterExpressions(t *testing.T) {
+	validator, err := validate.NewValidator(Rules)
+	if err != nil {
+		t.Fatalf("creating validator: %s", err)
+	}
+
+	// Expressions are held to the same length as the filter package parses, so are never rejected by one but not
+	// the other, even when multibyte.
+	quoted := len(`name = ""`)
+	for _, value := range []string{
+		strings.Repeat("a", filterpkg.MaxLength-quoted),
+		strings.Repeat("a", filterpkg.MaxLength-quoted+1),
+		strings.Repeat("é", (filterpkg.MaxLength-quoted)/2),
+		strings.Repeat("é", (filterpkg.MaxLength-quoted)/2+1),
+	} {
+		expr := `name = "` + value + `"`
+		_, err := filterpkg.Parse(expr)
+
+		violations := validator.Validate(&racing.ListRacesRequest{FilterExpression: expr})
+		if rejected := len(violations) > 0; rejected != (err != nil) {
+			t.Errorf("expression of %d bytes got violations %v, while parsing it got %v", len(expr), violations, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// raceTransitions lists the statuses a race may be moved to from each status. Final and abandoned races may not be
+// moved at all.
+var raceTransitions = map[racing.RaceStatus][]racing.RaceStatus{
+	racing.RaceStatus_RACE_STATUS_OPEN: {
+		racing.RaceStatus_RACE_STATUS_CLOSED,
+		racing.RaceStatus_RACE_STATUS_SUSPENDED,
+		racing.RaceStatus_RACE_STATUS_JUMPED,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+		racing.RaceStatus_RACE_STATUS_POSTPONED,
+	},
+	racing.RaceStatus_RACE_STATUS_CLOSED: {
+		racing.RaceStatus_RACE_STATUS_OPEN,
+		racing.RaceStatus_RACE_STATUS_SUSPENDED,
+		racing.RaceStatus_RACE_STATUS_JUMPED,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+		racing.RaceStatus_RACE_STATUS_POSTPONED,
+	},
+	racing.RaceStatus_RACE_STATUS_SUSPENDED: {
+		racing.RaceStatus_RACE_STATUS_OPEN,
+		racing.RaceStatus_RACE_STATUS_CLOSED,
+		racing.RaceStatus_RACE_STATUS_JUMPED,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+		racing.RaceStatus_RACE_STATUS_POSTPONED,
+	},
+	racing.RaceStatus_RACE_STATUS_POSTPONED: {
+		racing.RaceStatus_RACE_STATUS_OPEN,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+	},
+	racing.RaceStatus_RACE_STATUS_JUMPED: {
+		racing.RaceStatus_RACE_STATUS_INTERIM,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+	},
+	racing.RaceStatus_RACE_STATUS_INTERIM: {
+		racing.RaceStatus_RACE_STATUS_FINAL,
+		racing.RaceStatus_RACE_STATUS_ABANDONED,
+	},
+}
+
+// canTransition reports whether a race may be moved from one status to another.
+func canTransition(from, to racing.RaceStatus) bool {
+	for _, status := range raceTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
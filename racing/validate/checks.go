@@ -0,0 +1,124 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Check is a check made of a field, of its value or of each item of a repeated field, and of a repeated field as a
+// whole. Either returns why the field is invalid, or nothing when it's valid.
+type Check struct {
+	value func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string
+	list  func(list protoreflect.List) string
+}
+
+// Positive checks a number is greater than zero.
+func Positive() Check {
+	return compare(func(n float64) bool { return n > 0 }, "must be positive")
+}
+
+// NonNegative checks a number isn't below zero.
+func NonNegative() Check {
+	return compare(func(n float64) bool { return n >= 0 }, "must not be negative")
+}
+
+// AtLeast checks a number isn't below min.
+func AtLeast(min float64) Check {
+	return compare(func(n float64) bool { return n >= min }, fmt.Sprintf("must be at least %g", min))
+}
+
+// compare checks a number satisfies ok.
+func compare(ok func(n float64) bool, description string) Check {
+	return Check{value: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		var n float64
+
+		switch fd.Kind() {
+		case protoreflect.Int32Kind, protoreflect.Int64Kind,
+			protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+			protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+			n = float64(v.Int())
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+			protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			n = float64(v.Uint())
+		case protoreflect.FloatKind, protoreflect.DoubleKind:
+			n = v.Float()
+		default:
+			return ""
+		}
+
+		if !ok(n) {
+			return description
+		}
+
+		return ""
+	}}
+}
+
+// NotEmpty checks a string holds more than whitespace, or a repeated field holds an item.
+func NotEmpty() Check {
+	return Check{
+		value: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+			if fd.Kind() == protoreflect.StringKind && strings.TrimSpace(v.String()) == "" {
+				return "must not be empty"
+			}
+
+			return ""
+		},
+		list: func(list protoreflect.List) string {
+			if list.Len() == 0 {
+				return "must not be empty"
+			}
+
+			return ""
+		},
+	}
+}
+
+// MaxLength checks a string is at most max bytes long in UTF-8, as lengths are counted by the filter package.
+func MaxLength(max int) Check {
+	return Check{value: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if fd.Kind() == protoreflect.StringKind && len(v.String()) > max {
+			return fmt.Sprintf("must be at most %d bytes long", max)
+		}
+
+		return ""
+	}}
+}
+
+// MaxItems checks a repeated field holds at most max items.
+func MaxItems(max int) Check {
+	return Check{list: func(list protoreflect.List) string {
+		if list.Len() > max {
+			return fmt.Sprintf("must hold at most %d items", max)
+		}
+
+		return ""
+	}}
+}
+
+// EnumOf checks an enum is one of its values, other than the unspecified zero value. Its values are described by
+// noun, such as "a race status".
+func EnumOf(noun string) Check {
+	return enum(noun, false)
+}
+
+// EnumOrUnspecified checks an enum is one of its values, allowing the unspecified zero value.
+func EnumOrUnspecified(noun string) Check {
+	return enum(noun, true)
+}
+
+func enum(noun string, allowUnspecified bool) Check {
+	return Check{value: func(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+		if fd.Kind() != protoreflect.EnumKind {
+			return ""
+		}
+
+		if fd.Enum().Values().ByNumber(v.Enum()) == nil || (v.Enum() == 0 && !allowUnspecified) {
+			return "must be " + noun
+		}
+
+		return ""
+	}}
+}
@@ -0,0 +1,237 @@
+// Package validate checks requests against rules declared for the fields of each message, rejecting those which
+// break any of them before they reach a handler.
+//
+// Rules name their field by its path from the message, such as filter.meeting_ids. Rules of fields within a message
+// only apply when it's given, and those within repeated messages apply to each of them. Checks of a repeated scalar
+// field apply to each of its items, besides those of the field as a whole, such as MaxItems.
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"git.neds.sh/matty/entain/racing/errs"
+)
+
+// Rules maps the full names of messages, such as racing.ListRacesRequest, onto the rules of their fields.
+type Rules map[string][]Rule
+
+// Rule is the checks made of a field.
+type Rule struct {
+	Path   string
+	Checks []Check
+}
+
+// Field declares the checks made of the field at a path.
+func Field(path string, checks ...Check) Rule {
+	return Rule{Path: path, Checks: checks}
+}
+
+// Validator checks messages against their rules.
+type Validator interface {
+	// Validate will return every field of a message breaking its rules, with only the first check each field fails
+	// being reported.
+	Validate(msg proto.Message) []errs.FieldViolation
+
+	// UnaryServerInterceptor rejects requests breaking their rules with InvalidArgument.
+	UnaryServerInterceptor(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error)
+
+	// StreamServerInterceptor rejects streamed requests breaking their rules with InvalidArgument.
+	StreamServerInterceptor(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error
+}
+
+type validator struct {
+	rules map[protoreflect.FullName][]rule
+}
+
+// rule is a Rule with its path resolved.
+type rule struct {
+	path   []protoreflect.Name
+	checks []Check
+}
+
+// NewValidator creates a validator of the given rules, returning an error should any name a message or field which
+// doesn't exist.
+func NewValidator(rules Rules) (Validator, error) {
+	v := &validator{rules: make(map[protoreflect.FullName][]rule)}
+
+	for name, fieldRules := range rules {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("finding message %s: %w", name, err)
+		}
+
+		md, ok := desc.(protoreflect.MessageDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a message", name)
+		}
+
+		for _, fieldRule := range fieldRules {
+			path, err := resolve(md, fieldRule.Path)
+			if err != nil {
+				return nil, fmt.Errorf("rule of %s: %w", name, err)
+			}
+
+			v.rules[md.FullName()] = append(v.rules[md.FullName()], rule{path: path, checks: fieldRule.Checks})
+		}
+	}
+
+	return v, nil
+}
+
+// resolve checks a path names a field of a message, returning the names it's made up of.
+func resolve(md protoreflect.MessageDescriptor, path string) ([]protoreflect.Name, error) {
+	var names []protoreflect.Name
+
+	for i, part := range strings.Split(path, ".") {
+		if md == nil {
+			return nil, fmt.Errorf("%s does not name a field, as %s is not a message", path, names[i-1])
+		}
+
+		fd := md.Fields().ByName(protoreflect.Name(part))
+		if fd == nil {
+			return nil, fmt.Errorf("%s does not name a field, as %s has no field %s", path, md.FullName(), part)
+		}
+
+		names = append(names, fd.Name())
+		md = fd.Message()
+	}
+
+	return names, nil
+}
+
+func (v *validator) Validate(msg proto.Message) []errs.FieldViolation {
+	m := msg.ProtoReflect()
+
+	var violations []errs.FieldViolation
+	for _, r := range v.rules[m.Descriptor().FullName()] {
+		checkField(m, r.path, "", r.checks, &violations)
+	}
+
+	return violations
+}
+
+// checkField makes the checks of the field at a path from a message, prefixing the fields of violations found with
+// the path to the message.
+func checkField(
+	msg protoreflect.Message,
+	path []protoreflect.Name,
+	prefix string,
+	checks []Check,
+	violations *[]errs.FieldViolation,
+) {
+	fd := msg.Descriptor().Fields().ByName(path[0])
+	field := prefix + string(fd.Name())
+
+	if len(path) > 1 {
+		if !msg.Has(fd) {
+			return
+		}
+
+		if fd.IsList() {
+			list := msg.Get(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				checkField(list.Get(i).Message(), path[1:], fmt.Sprintf("%s[%d].", field, i), checks, violations)
+			}
+			return
+		}
+
+		checkField(msg.Get(fd).Message(), path[1:], field+".", checks, violations)
+		return
+	}
+
+	if field, description := checkValue(fd, msg.Get(fd), field, checks); description != "" {
+		*violations = append(*violations, errs.FieldViolation{Field: field, Description: description})
+	}
+}
+
+// checkValue makes the checks of a field's value, returning the field, or item of it, failing the first check
+// failed, along with why.
+func checkValue(fd protoreflect.FieldDescriptor, value protoreflect.Value, field string, checks []Check) (string, string) {
+	for _, check := range checks {
+		if !fd.IsList() {
+			if check.value != nil {
+				if description := check.value(fd, value); description != "" {
+					return field, description
+				}
+			}
+			continue
+		}
+
+		list := value.List()
+		if check.list != nil {
+			if description := check.list(list); description != "" {
+				return field, description
+			}
+		}
+		if check.value != nil {
+			for i := 0; i < list.Len(); i++ {
+				if description := check.value(fd, list.Get(i)); description != "" {
+					return fmt.Sprintf("%s[%d]", field, i), description
+				}
+			}
+		}
+	}
+
+	return field, ""
+}
+
+func (v *validator) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if msg, ok := req.(proto.Message); ok {
+		if violations := v.Validate(msg); len(violations) > 0 {
+			return nil, errs.InvalidArguments(violations...)
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+func (v *validator) StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return handler(srv, &validatingStream{ServerStream: ss, validator: v})
+}
+
+// validatingStream validates each message received on a stream.
+type validatingStream struct {
+	grpc.ServerStream
+	validator *validator
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if msg, ok := m.(proto.Message); ok {
+		if violations := s.validator.Validate(msg); len(violations) > 0 {
+			return errs.InvalidArguments(violations...)
+		}
+	}
+
+	return nil
+}
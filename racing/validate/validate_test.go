@@ -0,0 +1,177 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"git.neds.sh/matty/entain/racing/errs"
+	"git.neds.sh/matty/entain/racing/proto/racing"
+)
+
+// newTestValidator creates a validator of rules, failing the test should they be invalid.
+func newTestValidator(t *testing.T, rules Rules) Validator {
+	t.Helper()
+
+	v, err := NewValidator(rules)
+	if err != nil {
+		t.Fatalf("creating validator: %s", err)
+	}
+
+	return v
+}
+
+func TestChecks(t *testing.T) {
+	v := newTestValidator(t, Rules{
+		"racing.ListRacesRequest": {
+			Field("filter.meeting_ids", MaxItems(2), Positive()),
+			Field("page_size", NonNegative()),
+			Field("filter_expression", MaxLength(4)),
+		},
+		"racing.TransitionRaceRequest": {
+			Field("status", EnumOf("a race status")),
+			Field("actor", NotEmpty()),
+		},
+		"racing.BatchGetRacesRequest": {
+			Field("ids", NotEmpty()),
+		},
+		"racing.PublishPricesRequest": {
+			Field("prices.win", AtLeast(1)),
+			Field("prices.place", AtLeast(1), Positive()),
+		},
+		"racing.ExportRacesRequest": {
+			Field("format", EnumOrUnspecified("an export format")),
+		},
+	})
+
+	tests := map[string]struct {
+		msg  proto.Message
+		want []errs.FieldViolation
+	}{
+		"valid": {
+			msg: &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{MeetingIds: []int64{1, 2}}, FilterExpression: "id=1"},
+		},
+		"no filter": {
+			msg: &racing.ListRacesRequest{},
+		},
+		"negative": {
+			msg:  &racing.ListRacesRequest{PageSize: -1},
+			want: []errs.FieldViolation{{Field: "page_size", Description: "must not be negative"}},
+		},
+		"too many items": {
+			msg:  &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{MeetingIds: []int64{1, 2, 3}}},
+			want: []errs.FieldViolation{{Field: "filter.meeting_ids", Description: "must hold at most 2 items"}},
+		},
+		"item not positive": {
+			msg:  &racing.ListRacesRequest{Filter: &racing.ListRacesRequestFilter{MeetingIds: []int64{1, 0}}},
+			want: []errs.FieldViolation{{Field: "filter.meeting_ids[1]", Description: "must be positive"}},
+		},
+		"too long": {
+			msg:  &racing.ListRacesRequest{FilterExpression: "id=10"},
+			want: []errs.FieldViolation{{Field: "filter_expression", Description: "must be at most 4 bytes long"}},
+		},
+		// Lengths are counted in bytes, so two runes of two bytes each fill four bytes.
+		"multibyte": {
+			msg: &racing.ListRacesRequest{FilterExpression: "éé"},
+		},
+		"multibyte too long": {
+			msg:  &racing.ListRacesRequest{FilterExpression: "éé1"},
+			want: []errs.FieldViolation{{Field: "filter_expression", Description: "must be at most 4 bytes long"}},
+		},
+		"unspecified enum": {
+			msg:  &racing.TransitionRaceRequest{Actor: "trader"},
+			want: []errs.FieldViolation{{Field: "status", Description: "must be a race status"}},
+		},
+		"unknown enum": {
+			msg:  &racing.TransitionRaceRequest{Status: 99, Actor: "trader"},
+			want: []errs.FieldViolation{{Field: "status", Description: "must be a race status"}},
+		},
+		"blank string": {
+			msg:  &racing.TransitionRaceRequest{Status: racing.RaceStatus_RACE_STATUS_OPEN, Actor: " "},
+			want: []errs.FieldViolation{{Field: "actor", Description: "must not be empty"}},
+		},
+		"empty list": {
+			msg:  &racing.BatchGetRacesRequest{},
+			want: []errs.FieldViolation{{Field: "ids", Description: "must not be empty"}},
+		},
+		"unspecified enum allowed": {
+			msg: &racing.ExportRacesRequest{},
+		},
+		"unknown enum not allowed": {
+			msg:  &racing.ExportRacesRequest{Format: 99},
+			want: []errs.FieldViolation{{Field: "format", Description: "must be an export format"}},
+		},
+		// Each repeated message is checked, with only the first check each field fails reported.
+		"repeated messages": {
+			msg: &racing.PublishPricesRequest{Prices: []*racing.RunnerPrice{
+				{Win: 2, Place: 1.5},
+				{Win: 0.5, Place: 0},
+			}},
+			want: []errs.FieldViolation{
+				{Field: "prices[1].win", Description: "must be at least 1"},
+				{Field: "prices[1].place", Description: "must be at least 1"},
+			},
+		},
+		"messages without rules": {
+			msg: &racing.GetRaceRequest{},
+		},
+	}
+
+	for name, test := range tests {
+		got := v.Validate(test.msg)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got violations %v, want %v", name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got violations %v, want %v", name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	tests := map[string]Rules{
+		"unknown message": {"racing.Nope": {Field("id")}},
+		"not a message":   {"racing.Racing": {Field("id")}},
+		"unknown field":   {"racing.ListRacesRequest": {Field("nope")}},
+		"nested unknown":  {"racing.ListRacesRequest": {Field("filter.nope")}},
+		"through scalar":  {"racing.ListRacesRequest": {Field("page_size.value")}},
+	}
+
+	for name, rules := range tests {
+		if _, err := NewValidator(rules); err == nil {
+			t.Errorf("%s: created a validator, want an error", name)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	v := newTestValidator(t, Rules{"racing.BatchGetRacesRequest": {Field("ids", NotEmpty())}})
+
+	called := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return &racing.BatchGetRacesResponse{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/racing.Racing/BatchGetRaces"}
+
+	_, err := v.UnaryServerInterceptor(context.Background(), &racing.BatchGetRacesRequest{}, info, handler)
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(status.Convert(err).Message(), "ids") {
+		t.Errorf("got error %v, want ids to be invalid", err)
+	}
+	if called {
+		t.Error("invalid request was handled")
+	}
+
+	if _, err := v.UnaryServerInterceptor(context.Background(), &racing.BatchGetRacesRequest{Ids: []int64{1}}, info, handler); err != nil || !called {
+		t.Errorf("got error %v, want the request handled", err)
+	}
+}
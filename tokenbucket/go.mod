@@ -0,0 +1,3 @@
+module git.neds.sh/matty/entain/tokenbucket
+
+go 1.16
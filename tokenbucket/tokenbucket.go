@@ -0,0 +1,109 @@
+// Package tokenbucket holds the limits the gateway and racing rate limit requests by, and the token buckets they're
+// kept to with. Buckets refill steadily across the period of their limit, so requests can burst up to the whole
+// limit at once, after which they're spread across the period.
+package tokenbucket
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is how many requests may be made each period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit such as 10/s, 600/m or 50/100ms, with zero meaning no limit.
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("expected requests/period, got %q", s)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("requests of %q must be a whole number", s)
+	}
+
+	var period time.Duration
+	switch parts[1] {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		if period, err = time.ParseDuration(parts[1]); err != nil || period <= 0 {
+			return Limit{}, fmt.Errorf("period of %q must be s, m, h or a positive duration", s)
+		}
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// perSecond is the rate tokens are refilled at.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Bucket holds the tokens left of a limit. It isn't safe for concurrent use.
+type Bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// NewBucket creates a full bucket of the limit.
+func NewBucket(limit Limit, now time.Time) *Bucket {
+	return &Bucket{limit: limit, tokens: float64(limit.Requests), updated: now}
+}
+
+// Limit returns the limit the bucket holds tokens of.
+func (b *Bucket) Limit() Limit {
+	return b.limit
+}
+
+// Refill adds the tokens accrued since the bucket was last refilled, up to its limit.
+func (b *Bucket) Refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*b.limit.perSecond())
+	b.updated = now
+}
+
+// Tokens returns how many tokens the bucket held when last refilled, less those taken since.
+func (b *Bucket) Tokens() float64 {
+	return b.tokens
+}
+
+// Take takes a token from the bucket, should it have one, reporting whether it did.
+func (b *Bucket) Take() bool {
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// Until returns how long until the bucket holds the given number of tokens.
+func (b *Bucket) Until(tokens float64) time.Duration {
+	if b.tokens >= tokens {
+		return 0
+	}
+
+	return time.Duration((tokens - b.tokens) / b.limit.perSecond() * float64(time.Second))
+}
+
+// Idle reports whether the bucket has been left alone long enough to refill, so is no different to a new one.
+func (b *Bucket) Idle(now time.Time) bool {
+	return now.Sub(b.updated) >= b.limit.Period
+}
@@ -0,0 +1,68 @@
+package tokenbucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := map[string]Limit{
+		"10/s":     {10, time.Second},
+		"600/m":    {600, time.Minute},
+		"5/h":      {5, time.Hour},
+		"50/100ms": {50, 100 * time.Millisecond},
+		" 0/s ":    {0, time.Second},
+	}
+	for s, want := range tests {
+		got, err := ParseLimit(s)
+		if err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "10", "ten/s", "-1/s", "10/d", "10/-1s", "10/0s"} {
+		if _, err := ParseLimit(s); err == nil {
+			t.Errorf("ParseLimit(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBucket(Limit{Requests: 2, Period: time.Second}, now)
+
+	// A full bucket bursts up to its limit.
+	if !b.Take() || !b.Take() {
+		t.Fatal("full bucket refused a token")
+	}
+	if b.Take() {
+		t.Fatal("empty bucket gave a token")
+	}
+	if got := b.Until(1); got != 500*time.Millisecond {
+		t.Errorf("next token in %s, want 500ms", got)
+	}
+	if got := b.Until(2); got != time.Second {
+		t.Errorf("full in %s, want 1s", got)
+	}
+
+	// Tokens refill steadily, never beyond the limit.
+	b.Refill(now.Add(250 * time.Millisecond))
+	if got := b.Tokens(); got != 0.5 {
+		t.Errorf("got %v tokens after 250ms, want 0.5", got)
+	}
+	if b.Take() {
+		t.Error("bucket gave half a token")
+	}
+
+	b.Refill(now.Add(time.Hour))
+	if got := b.Tokens(); got != 2 {
+		t.Errorf("got %v tokens after an hour, want 2", got)
+	}
+
+	if b.Idle(now.Add(time.Hour + 999*time.Millisecond)) {
+		t.Error("bucket idle before a period has passed")
+	}
+	if !b.Idle(now.Add(time.Hour + time.Second)) {
+		t.Error("bucket not idle once a period has passed")
+	}
+}